@@ -0,0 +1,397 @@
+// Package analysis finds likely mistakes in Monkey programs without running
+// them.
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/resolver"
+	"github.com/MichaelDiBernardo/monkey/token"
+	"github.com/MichaelDiBernardo/monkey/typecheck"
+)
+
+// Rule identifies the kind of mistake a diagnostic reports. Rule IDs are
+// stable, so that they can be used to suppress diagnostics.
+type Rule string
+
+const (
+	Undefined      Rule = "undefined"       // A name used where it isn't bound.
+	DuplicateParam Rule = "duplicate-param" // A function binds the same parameter twice.
+	UnusedLet      Rule = "unused-let"      // A let binding that is never used.
+	UnusedParam    Rule = "unused-param"    // A parameter that is never used.
+	Shadow         Rule = "shadow"          // A binding that hides one from an enclosing function, or a parameter.
+	Unreachable    Rule = "unreachable"     // Statements after a return, break or continue.
+	Arity          Rule = "arity"           // A call with the wrong number of arguments to a known function.
+	Type           Rule = "type"            // An expression whose static type doesn't fit where it's used.
+)
+
+// Rules lists every rule, in the order they're documented.
+var Rules = []Rule{Undefined, DuplicateParam, UnusedLet, UnusedParam, Shadow, Unreachable, Arity, Type}
+
+// Diagnostic is one mistake found in a program. Message should be legible by
+// the program author.
+type Diagnostic struct {
+	Rule     Rule
+	Message  string
+	Location token.Location
+}
+
+func (d *Diagnostic) String() string {
+	msg := "%s [%s] (at line %d, col %d)"
+	return fmt.Sprintf(msg, d.Message, d.Rule, d.Location.LineN, d.Location.CharN)
+}
+
+// ParseRules parses a comma-separated list of rule IDs.
+func ParseRules(list string) ([]Rule, error) {
+	rules := []Rule{}
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		known := false
+		for _, r := range Rules {
+			known = known || string(r) == id
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown rule %q", id)
+		}
+
+		rules = append(rules, Rule(id))
+	}
+	return rules, nil
+}
+
+// Check analyzes program and returns its diagnostics ordered by location,
+// leaving out those for suppressed rules. Bindings whose names start with an
+// underscore are never reported as unused, and neither are the lets at the top
+// level, since they are the exports of a file that is imported as a module.
+//
+// program is resolved as part of the analysis, so it must not have been
+// resolved already.
+func Check(program *ast.Program, suppress ...Rule) []Diagnostic {
+	c := &checker{suppressed: map[Rule]bool{}, params: map[token.Location]bool{}, arity: map[token.Location]bool{}}
+	for _, r := range suppress {
+		c.suppressed[r] = true
+	}
+
+	errs := resolver.New().Resolve(program)
+
+	c.scope = newScope(nil)
+	c.visitStatements(program.Statements)
+	c.leaveScope()
+	c.checkCalls()
+	c.checkNames(errs)
+
+	// Calls with the wrong number of arguments are found by the type checker
+	// too, so they're only reported once.
+	for _, err := range typecheck.Check(program) {
+		if !c.arity[err.Location] {
+			c.report(Type, err.Location, "%s", err.Message)
+		}
+	}
+
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		li, lj := c.diags[i].Location, c.diags[j].Location
+		return li.LineN < lj.LineN || (li.LineN == lj.LineN && li.CharN < lj.CharN)
+	})
+	return c.diags
+}
+
+// binding is everything known about one slot of a scope.
+type binding struct {
+	decl  *ast.Identifier      // First let or parameter that binds the slot.
+	param bool                 // Whether decl is a parameter.
+	lets  int                  // Number of lets, for loops and assignments that bind the slot.
+	fn    *ast.FunctionLiteral // The value of the slot's only let, if it's a function literal.
+	used  bool
+
+	exported bool            // Whether a let at the top level binds the slot.
+	rebound  *ast.Identifier // First let that binds a parameter's slot again.
+}
+
+// scope is the set of slots of one function, or of the top level.
+type scope struct {
+	outer    *scope
+	bindings map[int]*binding
+	names    map[string]*binding // Bindings declared so far, by name.
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, bindings: map[int]*binding{}, names: map[string]*binding{}}
+}
+
+// at returns the binding for slot, creating it if this is the first time it has
+// been seen. Slots can be used before they're declared.
+func (s *scope) at(slot int) *binding {
+	b, ok := s.bindings[slot]
+	if !ok {
+		b = &binding{}
+		s.bindings[slot] = b
+	}
+	return b
+}
+
+// call is a call whose arity can only be checked once every binding has been
+// seen.
+type call struct {
+	node   *ast.CallExpression
+	callee *binding
+}
+
+type checker struct {
+	suppressed map[Rule]bool
+	diags      []Diagnostic
+
+	scope  *scope
+	calls  []call
+	params map[token.Location]bool // Locations of every parameter.
+	arity  map[token.Location]bool // Locations of calls with the wrong arity.
+}
+
+func (c *checker) report(rule Rule, loc token.Location, format string, a ...interface{}) {
+	if c.suppressed[rule] {
+		return
+	}
+	c.diags = append(c.diags, Diagnostic{Rule: rule, Message: fmt.Sprintf(format, a...), Location: loc})
+}
+
+// checkNames reports the names that the resolver couldn't bind. Parameters
+// are left out, since the checker reports duplicates itself.
+func (c *checker) checkNames(errs []resolver.ResolveError) {
+	for _, err := range errs {
+		if !c.params[err.Location] {
+			c.report(Undefined, err.Location, "%s", err.Message)
+		}
+	}
+}
+
+func (c *checker) visitStatements(stmts []ast.Statement) {
+	for i, s := range stmts {
+		c.visit(s)
+
+		if jump := jumpKeyword(s); jump != "" && i+1 < len(stmts) {
+			c.report(Unreachable, stmts[i+1].Token().Location, "unreachable code after %s", jump)
+			for _, dead := range stmts[i+1:] {
+				c.visit(dead)
+			}
+			return
+		}
+	}
+}
+
+// jumpKeyword returns the keyword of s if it always jumps out of the block it's
+// in, or "" if it doesn't.
+func jumpKeyword(s ast.Statement) string {
+	switch s.(type) {
+	case *ast.ReturnStatement:
+		return "return"
+	case *ast.BreakStatement:
+		return "break"
+	case *ast.ContinueStatement:
+		return "continue"
+	default:
+		return ""
+	}
+}
+
+func (c *checker) visit(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		c.visitStatements(node.Statements)
+	case *ast.LetStatement:
+		b := c.declare(node.Name, false)
+		if b != nil {
+			b.lets++
+			b.fn, _ = node.Value.(*ast.FunctionLiteral)
+			b.exported = b.exported || c.scope.outer == nil
+		}
+		c.visit(node.Value)
+
+		// A parameter that is bound again is only used if it's used before
+		// then; from then on, the slot is used if the let is.
+		if b != nil && b.param && b.rebound == nil {
+			if !b.used {
+				c.reportUnused(b.decl, true)
+			}
+			b.rebound, b.used = node.Name, false
+		}
+	case *ast.ImportStatement:
+		if b := c.declare(node.Name, false); b != nil {
+			b.lets++
+		}
+	case *ast.MemberExpression:
+		// The member names an export of a module, not a binding.
+		c.visit(node.Left)
+	case *ast.ForStatement:
+		c.visit(node.Iterable)
+		if b := c.declare(node.Variable, false); b != nil {
+			b.lets++
+		}
+		c.visit(node.Body)
+	case *ast.AssignExpression:
+		// Assigning to a name only uses it if the assignment is compound, but
+		// it does mean the name can hold something other than what its let
+		// bound it to.
+		if ident, ok := node.Target.(*ast.Identifier); ok {
+			if b := c.lookup(ident); b != nil {
+				b.lets++
+				b.used = b.used || node.Operator != "="
+			}
+		} else {
+			c.visit(node.Target)
+		}
+		c.visit(node.Value)
+	case *ast.Identifier:
+		if b := c.lookup(node); b != nil {
+			b.used = true
+		}
+	case *ast.FunctionLiteral:
+		c.scope = newScope(c.scope)
+		seen := map[string]bool{}
+		for _, param := range node.Parameters {
+			c.params[param.IdentToken.Location] = true
+			if seen[param.Value] {
+				c.report(DuplicateParam, param.IdentToken.Location, "duplicate parameter: %s", param.Value)
+				continue
+			}
+			seen[param.Value] = true
+			c.declare(param, true)
+		}
+		c.visit(node.Body)
+		c.leaveScope()
+	case *ast.CallExpression:
+		c.visit(node.Function)
+		for _, arg := range node.Arguments {
+			c.visit(arg)
+		}
+
+		switch fn := node.Function.(type) {
+		case *ast.FunctionLiteral:
+			c.checkArity(node, fn, "")
+		case *ast.Identifier:
+			if b := c.lookup(fn); b != nil {
+				c.calls = append(c.calls, call{node, b})
+			}
+		}
+	default:
+		ast.Walk(node, func(n ast.Node) bool {
+			if n == node {
+				return true
+			}
+			c.visit(n)
+			return false
+		}, nil)
+	}
+}
+
+// declare records that ident binds its slot in the current scope, and returns
+// the slot's binding. It returns nil if the resolver couldn't bind ident.
+func (c *checker) declare(ident *ast.Identifier, param bool) *binding {
+	if !ident.Binding.Resolved {
+		return nil
+	}
+
+	b := c.scope.at(ident.Binding.Slot)
+	if b.decl != nil {
+		if b.param && !param && b.lets == 0 {
+			loc := b.decl.IdentToken.Location
+			c.report(Shadow, ident.IdentToken.Location, "%s shadows the parameter %s bound at line %d, col %d", ident.Value, ident.Value, loc.LineN, loc.CharN)
+		}
+		return b
+	}
+	b.decl, b.param = ident, param
+	c.scope.names[ident.Value] = b
+
+	for s := c.scope.outer; s != nil; s = s.outer {
+		if outer, ok := s.names[ident.Value]; ok {
+			loc := outer.decl.IdentToken.Location
+			c.report(Shadow, ident.IdentToken.Location, "%s shadows the %s bound at line %d, col %d", ident.Value, ident.Value, loc.LineN, loc.CharN)
+			break
+		}
+	}
+	return b
+}
+
+// lookup returns the binding that ident refers to, or nil if the resolver
+// couldn't bind it or bound it to a builtin.
+func (c *checker) lookup(ident *ast.Identifier) *binding {
+	if !ident.Binding.Resolved || ident.Binding.Builtin {
+		return nil
+	}
+
+	s := c.scope
+	for i := 0; i < ident.Binding.Depth && s != nil; i++ {
+		s = s.outer
+	}
+	if s == nil {
+		return nil
+	}
+	return s.at(ident.Binding.Slot)
+}
+
+// leaveScope reports the unused bindings of the current scope, and makes its
+// enclosing scope current.
+func (c *checker) leaveScope() {
+	slots := []int{}
+	for slot := range c.scope.bindings {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+
+	for _, slot := range slots {
+		b := c.scope.bindings[slot]
+		if b.used || b.exported || b.decl == nil {
+			continue
+		}
+
+		if b.rebound != nil {
+			c.reportUnused(b.rebound, false)
+		} else {
+			c.reportUnused(b.decl, b.param)
+		}
+	}
+
+	c.scope = c.scope.outer
+}
+
+// reportUnused reports that the binding of ident, which is a parameter if
+// param is set, is never used.
+func (c *checker) reportUnused(ident *ast.Identifier, param bool) {
+	if strings.HasPrefix(ident.Value, "_") {
+		return
+	}
+
+	if param {
+		c.report(UnusedParam, ident.IdentToken.Location, "parameter %s is never used", ident.Value)
+	} else {
+		c.report(UnusedLet, ident.IdentToken.Location, "%s is bound but never used", ident.Value)
+	}
+}
+
+// checkCalls checks the arity of calls to names that are only ever bound to
+// one function literal.
+func (c *checker) checkCalls() {
+	for _, call := range c.calls {
+		if callee := call.callee; !callee.param && callee.lets == 1 && callee.fn != nil {
+			c.checkArity(call.node, callee.fn, callee.decl.Value)
+		}
+	}
+}
+
+func (c *checker) checkArity(node *ast.CallExpression, fn *ast.FunctionLiteral, name string) {
+	want, got := len(fn.Parameters), len(node.Arguments)
+	if want == got {
+		return
+	}
+	c.arity[node.LPToken.Location] = true
+
+	if name != "" {
+		name = " to " + name
+	}
+	c.report(Arity, node.LPToken.Location, "wrong number of arguments%s: want=%d, got=%d", name, want, got)
+}
@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/parser"
+)
+
+// expected is a diagnostic that a test expects, without its message.
+type expected struct {
+	rule Rule
+	line uint
+	char uint
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []expected
+	}{
+		{"let a = 1; a", nil},
+		{"x", []expected{{Undefined, 1, 1}}},
+		{"fn() { let a = 1;\nlet b = 2; b }()", []expected{{UnusedLet, 1, 12}}},
+		{"let a = 1;\nlet b = 2; b", nil},
+		{"let _a = 1;", nil},
+		{"let f = fn(x, y) { x }; f(1, 2)", []expected{{UnusedParam, 1, 15}}},
+		{"let f = fn(_, y) { y }; f(1, 2)", nil},
+		{"let f = fn(a, a) { a }; f(1, 2)", []expected{{DuplicateParam, 1, 15}}},
+		{"let x = 1; let f = fn(x) { x }; f(x)", []expected{{Shadow, 1, 23}}},
+		{"let f = fn() { let f = 1; f }; f()", []expected{{Shadow, 1, 20}}},
+		{"let x = 1; let x = x + 1; x", nil},
+		{"let f = fn(p) { let p = 3; p }; f(1)", []expected{{UnusedParam, 1, 12}, {Shadow, 1, 21}}},
+		{"let f = fn(p) { let p = p + 1; p }; f(1)", []expected{{Shadow, 1, 21}}},
+		{"let f = fn(p) { p; let p = 3; }; f(1)", []expected{{Shadow, 1, 24}, {UnusedLet, 1, 24}}},
+		{"let f = fn(p) { let p = 1; let p = p + 1; p }; f(1)", []expected{{UnusedParam, 1, 12}, {Shadow, 1, 21}}},
+		{"let f = fn(p) { p = 3; p }; f(1)", nil},
+		{"fn() { return 1;\n 2; 3 }()", []expected{{Unreachable, 2, 2}}},
+		{"if (true) { return 1; let a = 2; a }", []expected{{Unreachable, 1, 23}}},
+		{"let f = fn(a) { a }; f(1, 2)", []expected{{Arity, 1, 23}}},
+		{"fn(a) { a }()", []expected{{Arity, 1, 12}}},
+		{"let f = fn() { g(1) }; let g = fn() { 1 }; f()", []expected{{Arity, 1, 17}}},
+		{"let f = fn(a) { a }; let f = fn() { 1 }; f(1)", nil},
+		{"let apply = fn(g) { g(1, 2) }; apply(fn(a) { a })", nil},
+		{"let f = fn(x) { let y = 1; x }; f()", []expected{{UnusedLet, 1, 21}, {Arity, 1, 34}}},
+		{"let x: int = true; x", []expected{{Type, 1, 14}}},
+		{"while (true) { break; 1 }", []expected{{Unreachable, 1, 23}}},
+		{"for (x in [1]) { continue;\n x }", []expected{{Unreachable, 2, 2}}},
+		{"for (x in [1]) { 1 }", []expected{{UnusedLet, 1, 6}}},
+		{"for (_ in [1]) { 1 }", nil},
+		{"let f = fn(a) { a }; for (f in [1]) { f(1, 2) }", nil},
+		{"let f = fn(a: int) { a }; f(true, 1)", []expected{{Arity, 1, 28}}},
+		{"let f = fn(a: int) { a }; f(true)", []expected{{Type, 1, 29}}},
+		{"fn() { let a = 1; a = 2; }()", []expected{{UnusedLet, 1, 12}}},
+		{"let a = 1; a += 2;", nil},
+		{"let f = fn(a) { a }; f = fn() { 1 }; f(1)", nil},
+		{"x = 1", []expected{{Undefined, 1, 1}}},
+		{"fn() { let x = 1; rational(1, 2) }()", []expected{{UnusedLet, 1, 12}}},
+		{"rational = 1", []expected{{Undefined, 1, 1}}},
+		{`import "lib.monkey" as lib; lib.f(lib.x)`, nil},
+		{`import "lib.monkey" as lib;`, []expected{{UnusedLet, 1, 24}}},
+		{`lib.f; import "lib.monkey" as lib;`, []expected{{Undefined, 1, 1}, {UnusedLet, 1, 31}}},
+		// The top-level lets of a module are its exports.
+		{"let y = 1;\nlet double = fn(x) { x * 2 };", nil},
+	}
+
+	for i, tt := range tests {
+		diags := Check(parse(t, tt.input))
+		checkDiagnostics(t, i, tt.input, tt.expected, diags)
+	}
+}
+
+func TestUndefined(t *testing.T) {
+	diags := Check(parse(t, "let a = a;"))
+	exp := []expected{{Undefined, 1, 9}}
+	checkDiagnostics(t, 0, "let a = a;", exp, diags)
+
+	if msg := diags[0].Message; msg != "identifier used before definition: a" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestSuppress(t *testing.T) {
+	input := "let f = fn(x) { let a = 1; 1 }; f(1, 2)"
+
+	diags := Check(parse(t, input), UnusedLet, Arity)
+	checkDiagnostics(t, 0, input, []expected{{UnusedParam, 1, 12}}, diags)
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("shadow, unused-let,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 2 || rules[0] != Shadow || rules[1] != UnusedLet {
+		t.Errorf("expected [shadow unused-let], got %v", rules)
+	}
+
+	if _, err := ParseRules("shadow,nope"); err == nil {
+		t.Errorf("expected an error for an unknown rule")
+	}
+}
+
+func checkDiagnostics(t *testing.T, i int, input string, exp []expected, diags []Diagnostic) {
+	t.Helper()
+
+	if len(diags) != len(exp) {
+		t.Errorf("[%d] %q: expected %d diagnostics, got %d", i, input, len(exp), len(diags))
+		for _, d := range diags {
+			t.Errorf("  %s", d.String())
+		}
+		return
+	}
+
+	for j, e := range exp {
+		d := diags[j]
+		if d.Rule != e.rule || d.Location.LineN != e.line || d.Location.CharN != e.char {
+			t.Errorf("[%d] %q: expected %s at line %d col %d, got %s", i, input, e.rule, e.line, e.char, d.String())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
@@ -3,7 +3,9 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"math/big"
 	"strings"
+	"unicode"
 
 	"github.com/MichaelDiBernardo/monkey/token"
 )
@@ -33,6 +35,7 @@ type Expression interface {
 // Program is a sequence of Monkey statements.
 type Program struct {
 	Statements []Statement
+	NumSlots   int // Slots needed by top-level bindings; set by the resolver.
 }
 
 func (p *Program) Token() token.Token {
@@ -145,16 +148,142 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+// WhileStatement runs Body for as long as Condition is truthy.
+type WhileStatement struct {
+	WhileToken token.Token
+	Condition  Expression
+	Body       *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()     {}
+func (ws *WhileStatement) Token() token.Token { return ws.WhileToken }
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement runs Body once for each element of Iterable, with Variable
+// bound to the element.
+type ForStatement struct {
+	ForToken token.Token
+	Variable *Identifier // Variable is 'x' in 'for (x in xs)'
+	Iterable Expression  // Iterable is 'xs' in 'for (x in xs)'
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()     {}
+func (fs *ForStatement) Token() token.Token { return fs.ForToken }
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// BreakStatement ends the innermost loop it is in.
+type BreakStatement struct {
+	BreakToken token.Token
+}
+
+func (bs *BreakStatement) statementNode()     {}
+func (bs *BreakStatement) Token() token.Token { return bs.BreakToken }
+func (bs *BreakStatement) String() string     { return "break;" }
+
+// ContinueStatement skips to the next iteration of the innermost loop it is
+// in.
+type ContinueStatement struct {
+	ContinueToken token.Token
+}
+
+func (cs *ContinueStatement) statementNode()     {}
+func (cs *ContinueStatement) Token() token.Token { return cs.ContinueToken }
+func (cs *ContinueStatement) String() string     { return "continue;" }
+
+// ImportStatement binds Name to the module in the file at Path, like
+// `import "lib/money.monkey" as money`. Imports are only allowed at the top
+// level of a file.
+type ImportStatement struct {
+	ImportToken token.Token
+	Path        string      // Path as written; relative to the importing file.
+	Name        *Identifier // Name is 'money' in the example above.
+	Module      *Module     // The imported module; set by the loader.
+}
+
+func (is *ImportStatement) statementNode()     {}
+func (is *ImportStatement) Token() token.Token { return is.ImportToken }
+
+func (is *ImportStatement) String() string {
+	return fmt.Sprintf("import %s as %s;", QuoteString(is.Path), is.Name.String())
+}
+
+// Module is a Monkey source file that other files import. A file is loaded into
+// a single Module, however many files import it.
+type Module struct {
+	Path    string // Cleaned absolute path of the file.
+	Program *Program
+}
+
+// Exports returns the names bound by the lets at the top level of m, which
+// importers can refer to as members of the module. A name bound more than once
+// is only returned once, as the last identifier it was bound to.
+func (m *Module) Exports() []*Identifier {
+	exports := []*Identifier{}
+	index := map[string]int{}
+
+	for _, stmt := range m.Program.Statements {
+		let, ok := stmt.(*LetStatement)
+		if !ok {
+			continue
+		}
+		if i, ok := index[let.Name.Value]; ok {
+			exports[i] = let.Name
+			continue
+		}
+		index[let.Name.Value] = len(exports)
+		exports = append(exports, let.Name)
+	}
+
+	return exports
+}
+
 // Identifier is an expression composed of a single identifier.
 type Identifier struct {
 	IdentToken token.Token
-	Value      string // Same as IdentToken.Literal
+	Value      string         // Same as IdentToken.Literal
+	Type       TypeExpression // Annotated type of a let name or parameter, if any.
+	Binding    Binding        // Where the identifier's value lives; set by the resolver.
+}
+
+// Binding locates the runtime slot that a name is stored in. Every function
+// call (and the top level of the program) gets its own array of slots.
+type Binding struct {
+	Depth    int  // Number of function scopes out from the one the name is used in.
+	Slot     int  // Index of the name in that scope's slots, or of the builtin.
+	Resolved bool // False until the resolver has visited the identifier.
+	Builtin  bool // Whether the name refers to a builtin rather than a slot.
 }
 
 func (i *Identifier) expressionNode()    {}
 func (i *Identifier) Token() token.Token { return i.IdentToken }
 
 func (i *Identifier) String() string {
+	if i.Type != nil {
+		return i.Value + ": " + i.Type.String()
+	}
 	return i.Value
 }
 
@@ -162,15 +291,104 @@ func (i *Identifier) String() string {
 type IntegerLiteral struct {
 	IntToken token.Token
 	Value    int64
+	Big      *big.Int // The value of a literal too large for an int64, or nil.
 }
 
 func (il *IntegerLiteral) expressionNode()    {}
 func (il *IntegerLiteral) Token() token.Token { return il.IntToken }
 
 func (il *IntegerLiteral) String() string {
+	if il.Big != nil {
+		return il.Big.String()
+	}
 	return fmt.Sprintf("%d", il.Value)
 }
 
+// DecimalLiteral is an exact decimal number, like 12.50d. Its value is Value
+// scaled down by Scale decimal places, so that it keeps the number of places
+// it was written with.
+type DecimalLiteral struct {
+	DecimalToken token.Token
+	Value        *big.Int // Unscaled value; 1250 for 12.50d.
+	Scale        int      // Number of digits after the decimal point.
+}
+
+func (dl *DecimalLiteral) expressionNode()    {}
+func (dl *DecimalLiteral) Token() token.Token { return dl.DecimalToken }
+
+func (dl *DecimalLiteral) String() string {
+	return FormatDecimal(dl.Value, dl.Scale) + "d"
+}
+
+// StringLiteral is a string, like "hello". Value is the text between the quotes,
+// with its escapes replaced.
+type StringLiteral struct {
+	StringToken token.Token
+	Value       string
+}
+
+func (sl *StringLiteral) expressionNode()    {}
+func (sl *StringLiteral) Token() token.Token { return sl.StringToken }
+
+func (sl *StringLiteral) String() string {
+	return QuoteString(sl.Value)
+}
+
+// QuoteString returns s as a Monkey string literal, escaping its quotes,
+// backslashes and anything that isn't printable.
+func QuoteString(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case unicode.IsPrint(r):
+			out.WriteRune(r)
+		default:
+			fmt.Fprintf(&out, `\u{%x}`, r)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+// ParseDecimal parses the digits of a decimal literal, like 12.50, into its
+// unscaled value and scale. A trailing d suffix is allowed.
+func ParseDecimal(lit string) (*big.Int, int, bool) {
+	lit = strings.TrimSuffix(lit, "d")
+	whole, frac, _ := strings.Cut(lit, ".")
+	if whole == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return nil, 0, false
+	}
+
+	value, ok := new(big.Int).SetString(whole+frac, 10)
+	return value, len(frac), ok
+}
+
+// FormatDecimal writes value scaled down by scale decimal places, without a d
+// suffix.
+func FormatDecimal(value *big.Int, scale int) string {
+	digits := new(big.Int).Abs(value).String()
+	if scale > 0 {
+		if pad := scale + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if value.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
 // BooleanLiteral is an expression composed of an integer literal.
 type BooleanLiteral struct {
 	BoolToken token.Token
@@ -184,6 +402,70 @@ func (bl *BooleanLiteral) String() string {
 	return fmt.Sprintf("%t", bl.Value)
 }
 
+// ArrayLiteral is an expression composed of a list of elements in brackets.
+type ArrayLiteral struct {
+	LBToken  token.Token // The '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()    {}
+func (al *ArrayLiteral) Token() token.Token { return al.LBToken }
+
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashLiteral is an expression composed of key-value pairs in braces. Keys and
+// Values are parallel, in source order.
+type HashLiteral struct {
+	LBToken token.Token // The '{' token
+	Keys    []Expression
+	Values  []Expression
+}
+
+func (hl *HashLiteral) expressionNode()    {}
+func (hl *HashLiteral) Token() token.Token { return hl.LBToken }
+
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for i, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// IndexExpression looks up an element of an array or hash: `xs[1]`.
+type IndexExpression struct {
+	LBToken token.Token // The '[' token
+	Left    Expression
+	Index   Expression
+}
+
+func (ie *IndexExpression) expressionNode()    {}
+func (ie *IndexExpression) Token() token.Token { return ie.LBToken }
+
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+// MemberExpression looks up a name bound by an imported module: `money.round`.
+type MemberExpression struct {
+	DotToken token.Token // The '.' token
+	Left     Expression
+	Member   *Identifier // Not bound by the resolver; it names an export.
+}
+
+func (me *MemberExpression) expressionNode()    {}
+func (me *MemberExpression) Token() token.Token { return me.DotToken }
+
+func (me *MemberExpression) String() string {
+	return "(" + me.Left.String() + "." + me.Member.String() + ")"
+}
+
 type PrefixExpression struct {
 	OperatorToken token.Token
 	Operator      string
@@ -228,6 +510,33 @@ func (pe *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression stores a new value in an existing binding, or in an element
+// of an array or hash. Compound assignments like `x += 1` apply their operator
+// to the current value first.
+type AssignExpression struct {
+	OperatorToken token.Token
+	Operator      string     // "=", or a compound operator like "+="
+	Target        Expression // An *Identifier or an *IndexExpression.
+	Value         Expression
+}
+
+func (ae *AssignExpression) expressionNode()    {}
+func (ae *AssignExpression) Token() token.Token { return ae.OperatorToken }
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" ")
+	out.WriteString(ae.Operator)
+	out.WriteString(" ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type IfExpression struct {
 	IfToken     token.Token // IF token
 	Condition   Expression
@@ -257,7 +566,9 @@ func (ie *IfExpression) String() string {
 type FunctionLiteral struct {
 	FnToken    token.Token // The 'fn' token
 	Parameters []*Identifier
+	ReturnType TypeExpression // Annotated return type, if any.
 	Body       *BlockStatement
+	NumSlots   int // Slots needed by parameters and locals; set by the resolver.
 }
 
 func (fl *FunctionLiteral) expressionNode()    {}
@@ -275,6 +586,12 @@ func (fl *FunctionLiteral) String() string {
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
 
+	if fl.ReturnType != nil {
+		out.WriteString("-> ")
+		out.WriteString(fl.ReturnType.String())
+		out.WriteString(" ")
+	}
+
 	out.WriteString(fl.Body.String())
 
 	return out.String()
@@ -289,6 +606,15 @@ type CallExpression struct {
 func (ce *CallExpression) expressionNode()    {}
 func (ce *CallExpression) Token() token.Token { return ce.LPToken }
 
+// CalleeName returns the name of the function that ce calls, or "" if the
+// function isn't referred to by name.
+func (ce *CallExpression) CalleeName() string {
+	if ident, ok := ce.Function.(*Identifier); ok {
+		return ident.Value
+	}
+	return ""
+}
+
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -304,3 +630,80 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+// MacroLiteral is a macro definition: `macro(x, y) { ... }`.
+type MacroLiteral struct {
+	MacroToken token.Token // The 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+	NumSlots   int // Slots needed by parameters and locals; set by the resolver.
+}
+
+func (ml *MacroLiteral) expressionNode()    {}
+func (ml *MacroLiteral) Token() token.Token { return ml.MacroToken }
+
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
+// TypeExpression is a type written in an annotation, like `int` or
+// `fn(int) -> bool`. Annotations are only read by the type checker.
+type TypeExpression interface {
+	Node
+	typeNode()
+}
+
+// NamedType is a type referred to by name, like `int`.
+type NamedType struct {
+	NameToken token.Token
+	Name      string // Same as NameToken.Literal
+}
+
+func (nt *NamedType) typeNode()          {}
+func (nt *NamedType) Token() token.Token { return nt.NameToken }
+
+func (nt *NamedType) String() string {
+	return nt.Name
+}
+
+// FunctionType is the type of a function, like `fn(int, bool) -> int`.
+type FunctionType struct {
+	FnToken    token.Token // The 'fn' token
+	Parameters []TypeExpression
+	Return     TypeExpression // nil if the return type isn't given.
+}
+
+func (ft *FunctionType) typeNode()          {}
+func (ft *FunctionType) Token() token.Token { return ft.FnToken }
+
+func (ft *FunctionType) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+
+	if ft.Return != nil {
+		out.WriteString(" -> ")
+		out.WriteString(ft.Return.String())
+	}
+
+	return out.String()
+}
@@ -0,0 +1,683 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// jsonNode is the serialized form of any AST node. Every node is tagged with
+// its kind so that interface-typed children (statements and expressions) can
+// be rebuilt when decoding; fields that don't apply to a kind are omitted.
+type jsonNode struct {
+	Kind  string       `json:"kind"`
+	Token *token.Token `json:"token,omitempty"`
+
+	Ident    string  `json:"ident,omitempty"`    // Identifier and NamedType
+	Int      *int64  `json:"int,omitempty"`      // IntegerLiteral
+	Big      string  `json:"big,omitempty"`      // IntegerLiteral too large for Int, in decimal
+	Decimal  string  `json:"decimal,omitempty"`  // DecimalLiteral, like 12.50
+	String   *string `json:"string,omitempty"`   // StringLiteral
+	Bool     *bool   `json:"bool,omitempty"`     // BooleanLiteral
+	Operator string  `json:"operator,omitempty"` // Prefix and infix expressions
+	Path     string  `json:"path,omitempty"`     // ImportStatement
+
+	Name        *jsonNode   `json:"name,omitempty"`
+	Value       *jsonNode   `json:"value,omitempty"`
+	LHS         *jsonNode   `json:"lhs,omitempty"`
+	RHS         *jsonNode   `json:"rhs,omitempty"`
+	Condition   *jsonNode   `json:"condition,omitempty"`
+	Consequence *jsonNode   `json:"consequence,omitempty"`
+	Alternative *jsonNode   `json:"alternative,omitempty"`
+	Parameters  []*jsonNode `json:"parameters,omitempty"`
+	Type        *jsonNode   `json:"type,omitempty"`
+	ReturnType  *jsonNode   `json:"returnType,omitempty"`
+	Body        *jsonNode   `json:"body,omitempty"`
+	Function    *jsonNode   `json:"function,omitempty"`
+	Arguments   []*jsonNode `json:"arguments,omitempty"`
+	Elements    []*jsonNode `json:"elements,omitempty"`
+	Keys        []*jsonNode `json:"keys,omitempty"`
+	Values      []*jsonNode `json:"values,omitempty"`
+	Index       *jsonNode   `json:"index,omitempty"`
+	Statements  []*jsonNode `json:"statements,omitempty"`
+}
+
+// Marshal renders node and all of its children, including their tokens and
+// locations, as JSON.
+func Marshal(node Node) ([]byte, error) {
+	jn, err := toJSON(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jn)
+}
+
+// Unmarshal rebuilds an AST from JSON produced by Marshal.
+func Unmarshal(data []byte) (Node, error) {
+	var jn *jsonNode
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return nil, err
+	}
+	return fromJSON(jn)
+}
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return Marshal(p)
+}
+
+func (p *Program) UnmarshalJSON(data []byte) error {
+	node, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+
+	program, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("expected Program, got %T", node)
+	}
+
+	*p = *program
+	return nil
+}
+
+func toJSON(node Node) (*jsonNode, error) {
+	var err error
+	tok := func(t token.Token) *token.Token { return &t }
+
+	if isNilNode(node) {
+		return nil, nil
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		jn := &jsonNode{Kind: "Program"}
+		jn.Statements, err = statementsToJSON(n.Statements)
+		return jn, err
+	case *LetStatement:
+		jn := &jsonNode{Kind: "LetStatement", Token: tok(n.LetToken)}
+		if jn.Name, err = toJSON(n.Name); err != nil {
+			return nil, err
+		}
+		jn.Value, err = toJSON(n.Value)
+		return jn, err
+	case *ReturnStatement:
+		jn := &jsonNode{Kind: "ReturnStatement", Token: tok(n.ReturnToken)}
+		jn.Value, err = toJSON(n.Value)
+		return jn, err
+	case *ExpressionStatement:
+		jn := &jsonNode{Kind: "ExpressionStatement", Token: tok(n.FirstToken)}
+		jn.Value, err = toJSON(n.Value)
+		return jn, err
+	case *BlockStatement:
+		jn := &jsonNode{Kind: "BlockStatement", Token: tok(n.StartToken)}
+		jn.Statements, err = statementsToJSON(n.Statements)
+		return jn, err
+	case *WhileStatement:
+		jn := &jsonNode{Kind: "WhileStatement", Token: tok(n.WhileToken)}
+		if jn.Condition, err = toJSON(n.Condition); err != nil {
+			return nil, err
+		}
+		jn.Body, err = toJSON(n.Body)
+		return jn, err
+	case *ForStatement:
+		jn := &jsonNode{Kind: "ForStatement", Token: tok(n.ForToken)}
+		if jn.Name, err = toJSON(n.Variable); err != nil {
+			return nil, err
+		}
+		if jn.Value, err = toJSON(n.Iterable); err != nil {
+			return nil, err
+		}
+		jn.Body, err = toJSON(n.Body)
+		return jn, err
+	case *ImportStatement:
+		jn := &jsonNode{Kind: "ImportStatement", Token: tok(n.ImportToken), Path: n.Path}
+		jn.Name, err = toJSON(n.Name)
+		return jn, err
+	case *BreakStatement:
+		return &jsonNode{Kind: "BreakStatement", Token: tok(n.BreakToken)}, nil
+	case *ContinueStatement:
+		return &jsonNode{Kind: "ContinueStatement", Token: tok(n.ContinueToken)}, nil
+	case *Identifier:
+		jn := &jsonNode{Kind: "Identifier", Token: tok(n.IdentToken), Ident: n.Value}
+		jn.Type, err = toJSON(n.Type)
+		return jn, err
+	case *IntegerLiteral:
+		if n.Big != nil {
+			return &jsonNode{Kind: "IntegerLiteral", Token: tok(n.IntToken), Big: n.Big.String()}, nil
+		}
+		value := n.Value
+		return &jsonNode{Kind: "IntegerLiteral", Token: tok(n.IntToken), Int: &value}, nil
+	case *DecimalLiteral:
+		return &jsonNode{Kind: "DecimalLiteral", Token: tok(n.DecimalToken), Decimal: FormatDecimal(n.Value, n.Scale)}, nil
+	case *StringLiteral:
+		value := n.Value
+		return &jsonNode{Kind: "StringLiteral", Token: tok(n.StringToken), String: &value}, nil
+	case *BooleanLiteral:
+		value := n.Value
+		return &jsonNode{Kind: "BooleanLiteral", Token: tok(n.BoolToken), Bool: &value}, nil
+	case *ArrayLiteral:
+		jn := &jsonNode{Kind: "ArrayLiteral", Token: tok(n.LBToken), Elements: []*jsonNode{}}
+		for _, el := range n.Elements {
+			je, err := toJSON(el)
+			if err != nil {
+				return nil, err
+			}
+			jn.Elements = append(jn.Elements, je)
+		}
+		return jn, nil
+	case *HashLiteral:
+		jn := &jsonNode{Kind: "HashLiteral", Token: tok(n.LBToken), Keys: []*jsonNode{}, Values: []*jsonNode{}}
+		for i, key := range n.Keys {
+			jk, err := toJSON(key)
+			if err != nil {
+				return nil, err
+			}
+			jv, err := toJSON(n.Values[i])
+			if err != nil {
+				return nil, err
+			}
+			jn.Keys = append(jn.Keys, jk)
+			jn.Values = append(jn.Values, jv)
+		}
+		return jn, nil
+	case *IndexExpression:
+		jn := &jsonNode{Kind: "IndexExpression", Token: tok(n.LBToken)}
+		if jn.LHS, err = toJSON(n.Left); err != nil {
+			return nil, err
+		}
+		jn.Index, err = toJSON(n.Index)
+		return jn, err
+	case *MemberExpression:
+		jn := &jsonNode{Kind: "MemberExpression", Token: tok(n.DotToken)}
+		if jn.LHS, err = toJSON(n.Left); err != nil {
+			return nil, err
+		}
+		jn.Name, err = toJSON(n.Member)
+		return jn, err
+	case *PrefixExpression:
+		jn := &jsonNode{Kind: "PrefixExpression", Token: tok(n.OperatorToken), Operator: n.Operator}
+		jn.RHS, err = toJSON(n.RHS)
+		return jn, err
+	case *InfixExpression:
+		jn := &jsonNode{Kind: "InfixExpression", Token: tok(n.OperatorToken), Operator: n.Operator}
+		if jn.LHS, err = toJSON(n.LHS); err != nil {
+			return nil, err
+		}
+		jn.RHS, err = toJSON(n.RHS)
+		return jn, err
+	case *AssignExpression:
+		jn := &jsonNode{Kind: "AssignExpression", Token: tok(n.OperatorToken), Operator: n.Operator}
+		if jn.LHS, err = toJSON(n.Target); err != nil {
+			return nil, err
+		}
+		jn.Value, err = toJSON(n.Value)
+		return jn, err
+	case *IfExpression:
+		jn := &jsonNode{Kind: "IfExpression", Token: tok(n.IfToken)}
+		if jn.Condition, err = toJSON(n.Condition); err != nil {
+			return nil, err
+		}
+		if jn.Consequence, err = toJSON(n.Consequence); err != nil {
+			return nil, err
+		}
+		jn.Alternative, err = toJSON(n.Alternative)
+		return jn, err
+	case *FunctionLiteral:
+		jn := &jsonNode{Kind: "FunctionLiteral", Token: tok(n.FnToken), Parameters: []*jsonNode{}}
+		for _, param := range n.Parameters {
+			jp, err := toJSON(param)
+			if err != nil {
+				return nil, err
+			}
+			jn.Parameters = append(jn.Parameters, jp)
+		}
+		if jn.ReturnType, err = toJSON(n.ReturnType); err != nil {
+			return nil, err
+		}
+		jn.Body, err = toJSON(n.Body)
+		return jn, err
+	case *CallExpression:
+		jn := &jsonNode{Kind: "CallExpression", Token: tok(n.LPToken), Arguments: []*jsonNode{}}
+		if jn.Function, err = toJSON(n.Function); err != nil {
+			return nil, err
+		}
+		for _, arg := range n.Arguments {
+			ja, err := toJSON(arg)
+			if err != nil {
+				return nil, err
+			}
+			jn.Arguments = append(jn.Arguments, ja)
+		}
+		return jn, nil
+	case *MacroLiteral:
+		jn := &jsonNode{Kind: "MacroLiteral", Token: tok(n.MacroToken), Parameters: []*jsonNode{}}
+		for _, param := range n.Parameters {
+			jp, err := toJSON(param)
+			if err != nil {
+				return nil, err
+			}
+			jn.Parameters = append(jn.Parameters, jp)
+		}
+		jn.Body, err = toJSON(n.Body)
+		return jn, err
+	case *NamedType:
+		return &jsonNode{Kind: "NamedType", Token: tok(n.NameToken), Ident: n.Name}, nil
+	case *FunctionType:
+		jn := &jsonNode{Kind: "FunctionType", Token: tok(n.FnToken), Parameters: []*jsonNode{}}
+		for _, param := range n.Parameters {
+			jp, err := toJSON(param)
+			if err != nil {
+				return nil, err
+			}
+			jn.Parameters = append(jn.Parameters, jp)
+		}
+		jn.ReturnType, err = toJSON(n.Return)
+		return jn, err
+	default:
+		return nil, fmt.Errorf("cannot serialize node of type %T", node)
+	}
+}
+
+func statementsToJSON(stmts []Statement) ([]*jsonNode, error) {
+	out := []*jsonNode{}
+	for _, stmt := range stmts {
+		js, err := toJSON(stmt)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, js)
+	}
+	return out, nil
+}
+
+func fromJSON(jn *jsonNode) (Node, error) {
+	if jn == nil {
+		return nil, nil
+	}
+
+	var tok token.Token
+	if jn.Token != nil {
+		tok = *jn.Token
+	}
+
+	switch jn.Kind {
+	case "Program":
+		stmts, err := statementsFromJSON(jn.Statements, jn.Kind)
+		if err != nil {
+			return nil, err
+		}
+		return &Program{Statements: stmts}, nil
+	case "LetStatement":
+		name, err := identifierFromJSON(jn.Name, jn.Kind, "name")
+		if err != nil {
+			return nil, err
+		}
+		value, err := expressionFromJSON(jn.Value, jn.Kind, "value")
+		if err != nil {
+			return nil, err
+		}
+		return &LetStatement{LetToken: tok, Name: name, Value: value}, nil
+	case "ReturnStatement":
+		value, err := expressionFromJSON(jn.Value, jn.Kind, "value")
+		if err != nil {
+			return nil, err
+		}
+		return &ReturnStatement{ReturnToken: tok, Value: value}, nil
+	case "ExpressionStatement":
+		value, err := expressionFromJSON(jn.Value, jn.Kind, "value")
+		if err != nil {
+			return nil, err
+		}
+		return &ExpressionStatement{FirstToken: tok, Value: value}, nil
+	case "BlockStatement":
+		stmts, err := statementsFromJSON(jn.Statements, jn.Kind)
+		if err != nil {
+			return nil, err
+		}
+		return &BlockStatement{StartToken: tok, Statements: stmts}, nil
+	case "WhileStatement":
+		condition, err := expressionFromJSON(jn.Condition, jn.Kind, "condition")
+		if err != nil {
+			return nil, err
+		}
+		body, err := blockFromJSON(jn.Body, jn.Kind, "body")
+		if err != nil {
+			return nil, err
+		}
+		return &WhileStatement{WhileToken: tok, Condition: condition, Body: body}, nil
+	case "ForStatement":
+		variable, err := identifierFromJSON(jn.Name, jn.Kind, "name")
+		if err != nil {
+			return nil, err
+		}
+		iterable, err := expressionFromJSON(jn.Value, jn.Kind, "value")
+		if err != nil {
+			return nil, err
+		}
+		body, err := blockFromJSON(jn.Body, jn.Kind, "body")
+		if err != nil {
+			return nil, err
+		}
+		return &ForStatement{ForToken: tok, Variable: variable, Iterable: iterable, Body: body}, nil
+	case "ImportStatement":
+		name, err := identifierFromJSON(jn.Name, jn.Kind, "name")
+		if err != nil {
+			return nil, err
+		}
+		return &ImportStatement{ImportToken: tok, Path: jn.Path, Name: name}, nil
+	case "BreakStatement":
+		return &BreakStatement{BreakToken: tok}, nil
+	case "ContinueStatement":
+		return &ContinueStatement{ContinueToken: tok}, nil
+	case "Identifier":
+		typ, err := typeFromJSON(jn.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &Identifier{IdentToken: tok, Value: jn.Ident, Type: typ}, nil
+	case "IntegerLiteral":
+		if jn.Big != "" {
+			value, ok := new(big.Int).SetString(jn.Big, 10)
+			if !ok {
+				return nil, fmt.Errorf("IntegerLiteral has a bad value %q", jn.Big)
+			}
+			return &IntegerLiteral{IntToken: tok, Big: value}, nil
+		}
+		if jn.Int == nil {
+			return nil, fmt.Errorf("IntegerLiteral is missing its value")
+		}
+		return &IntegerLiteral{IntToken: tok, Value: *jn.Int}, nil
+	case "DecimalLiteral":
+		value, scale, ok := ParseDecimal(jn.Decimal)
+		if !ok {
+			return nil, fmt.Errorf("DecimalLiteral has a bad value %q", jn.Decimal)
+		}
+		return &DecimalLiteral{DecimalToken: tok, Value: value, Scale: scale}, nil
+	case "StringLiteral":
+		if jn.String == nil {
+			return nil, fmt.Errorf("StringLiteral is missing its value")
+		}
+		return &StringLiteral{StringToken: tok, Value: *jn.String}, nil
+	case "BooleanLiteral":
+		if jn.Bool == nil {
+			return nil, fmt.Errorf("BooleanLiteral is missing its value")
+		}
+		return &BooleanLiteral{BoolToken: tok, Value: *jn.Bool}, nil
+	case "ArrayLiteral":
+		elements := []Expression{}
+		for i, je := range jn.Elements {
+			el, err := expressionFromJSON(je, jn.Kind, fmt.Sprintf("elements[%d]", i))
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, el)
+		}
+		return &ArrayLiteral{LBToken: tok, Elements: elements}, nil
+	case "HashLiteral":
+		if len(jn.Keys) != len(jn.Values) {
+			return nil, fmt.Errorf("HashLiteral has %d keys but %d values", len(jn.Keys), len(jn.Values))
+		}
+		keys, values := []Expression{}, []Expression{}
+		for i, jk := range jn.Keys {
+			key, err := expressionFromJSON(jk, jn.Kind, fmt.Sprintf("keys[%d]", i))
+			if err != nil {
+				return nil, err
+			}
+			value, err := expressionFromJSON(jn.Values[i], jn.Kind, fmt.Sprintf("values[%d]", i))
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		return &HashLiteral{LBToken: tok, Keys: keys, Values: values}, nil
+	case "IndexExpression":
+		left, err := expressionFromJSON(jn.LHS, jn.Kind, "lhs")
+		if err != nil {
+			return nil, err
+		}
+		index, err := expressionFromJSON(jn.Index, jn.Kind, "index")
+		if err != nil {
+			return nil, err
+		}
+		return &IndexExpression{LBToken: tok, Left: left, Index: index}, nil
+	case "MemberExpression":
+		left, err := expressionFromJSON(jn.LHS, jn.Kind, "lhs")
+		if err != nil {
+			return nil, err
+		}
+		member, err := identifierFromJSON(jn.Name, jn.Kind, "name")
+		if err != nil {
+			return nil, err
+		}
+		return &MemberExpression{DotToken: tok, Left: left, Member: member}, nil
+	case "PrefixExpression":
+		optok, err := operatorToken(jn)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := expressionFromJSON(jn.RHS, jn.Kind, "rhs")
+		if err != nil {
+			return nil, err
+		}
+		return &PrefixExpression{OperatorToken: optok, Operator: jn.Operator, RHS: rhs}, nil
+	case "InfixExpression":
+		optok, err := operatorToken(jn)
+		if err != nil {
+			return nil, err
+		}
+		lhs, err := expressionFromJSON(jn.LHS, jn.Kind, "lhs")
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := expressionFromJSON(jn.RHS, jn.Kind, "rhs")
+		if err != nil {
+			return nil, err
+		}
+		return &InfixExpression{OperatorToken: optok, Operator: jn.Operator, LHS: lhs, RHS: rhs}, nil
+	case "AssignExpression":
+		optok, err := operatorToken(jn)
+		if err != nil {
+			return nil, err
+		}
+		target, err := expressionFromJSON(jn.LHS, jn.Kind, "lhs")
+		if err != nil {
+			return nil, err
+		}
+		value, err := expressionFromJSON(jn.Value, jn.Kind, "value")
+		if err != nil {
+			return nil, err
+		}
+		return &AssignExpression{OperatorToken: optok, Operator: jn.Operator, Target: target, Value: value}, nil
+	case "IfExpression":
+		condition, err := expressionFromJSON(jn.Condition, jn.Kind, "condition")
+		if err != nil {
+			return nil, err
+		}
+		consequence, err := blockFromJSON(jn.Consequence, jn.Kind, "consequence")
+		if err != nil {
+			return nil, err
+		}
+		var alternative *BlockStatement
+		if jn.Alternative != nil {
+			if alternative, err = blockFromJSON(jn.Alternative, jn.Kind, "alternative"); err != nil {
+				return nil, err
+			}
+		}
+		return &IfExpression{IfToken: tok, Condition: condition, Consequence: consequence, Alternative: alternative}, nil
+	case "FunctionLiteral":
+		params := []*Identifier{}
+		for i, jp := range jn.Parameters {
+			param, err := identifierFromJSON(jp, jn.Kind, fmt.Sprintf("parameters[%d]", i))
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, param)
+		}
+		returnType, err := typeFromJSON(jn.ReturnType)
+		if err != nil {
+			return nil, err
+		}
+		body, err := blockFromJSON(jn.Body, jn.Kind, "body")
+		if err != nil {
+			return nil, err
+		}
+		return &FunctionLiteral{FnToken: tok, Parameters: params, ReturnType: returnType, Body: body}, nil
+	case "CallExpression":
+		function, err := expressionFromJSON(jn.Function, jn.Kind, "function")
+		if err != nil {
+			return nil, err
+		}
+		args := []Expression{}
+		for i, ja := range jn.Arguments {
+			arg, err := expressionFromJSON(ja, jn.Kind, fmt.Sprintf("arguments[%d]", i))
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return &CallExpression{LPToken: tok, Function: function, Arguments: args}, nil
+	case "MacroLiteral":
+		params := []*Identifier{}
+		for i, jp := range jn.Parameters {
+			param, err := identifierFromJSON(jp, jn.Kind, fmt.Sprintf("parameters[%d]", i))
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, param)
+		}
+		body, err := blockFromJSON(jn.Body, jn.Kind, "body")
+		if err != nil {
+			return nil, err
+		}
+		return &MacroLiteral{MacroToken: tok, Parameters: params, Body: body}, nil
+	case "NamedType":
+		return &NamedType{NameToken: tok, Name: jn.Ident}, nil
+	case "FunctionType":
+		params := []TypeExpression{}
+		for i, jp := range jn.Parameters {
+			if jp == nil {
+				return nil, missing(jn.Kind, fmt.Sprintf("parameters[%d]", i))
+			}
+			param, err := typeFromJSON(jp)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, param)
+		}
+		ret, err := typeFromJSON(jn.ReturnType)
+		if err != nil {
+			return nil, err
+		}
+		return &FunctionType{FnToken: tok, Parameters: params, Return: ret}, nil
+	default:
+		return nil, fmt.Errorf("unknown node kind %q", jn.Kind)
+	}
+}
+
+// The functions below rebuild the children of a node of kind parent, which
+// are found under field. Children are required, since the AST's methods and
+// the engines expect them to be there; only type annotations, which
+// typeFromJSON lets be missing, and the alternative of an if are optional.
+
+func statementsFromJSON(jns []*jsonNode, parent string) ([]Statement, error) {
+	stmts := []Statement{}
+	for i, js := range jns {
+		if js == nil {
+			return nil, missing(parent, fmt.Sprintf("statements[%d]", i))
+		}
+		node, err := fromJSON(js)
+		if err != nil {
+			return nil, err
+		}
+		stmt, ok := node.(Statement)
+		if !ok {
+			return nil, fmt.Errorf("expected statement, got %s", js.Kind)
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+func expressionFromJSON(jn *jsonNode, parent string, field string) (Expression, error) {
+	if jn == nil {
+		return nil, missing(parent, field)
+	}
+	node, err := fromJSON(jn)
+	if err != nil {
+		return nil, err
+	}
+	exp, ok := node.(Expression)
+	if !ok {
+		return nil, fmt.Errorf("expected expression, got %s", jn.Kind)
+	}
+	return exp, nil
+}
+
+func identifierFromJSON(jn *jsonNode, parent string, field string) (*Identifier, error) {
+	if jn == nil {
+		return nil, missing(parent, field)
+	}
+	node, err := fromJSON(jn)
+	if err != nil {
+		return nil, err
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		return nil, fmt.Errorf("expected Identifier, got %s", jn.Kind)
+	}
+	return ident, nil
+}
+
+func typeFromJSON(jn *jsonNode) (TypeExpression, error) {
+	node, err := fromJSON(jn)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	te, ok := node.(TypeExpression)
+	if !ok {
+		return nil, fmt.Errorf("expected type, got %s", jn.Kind)
+	}
+	return te, nil
+}
+
+func blockFromJSON(jn *jsonNode, parent string, field string) (*BlockStatement, error) {
+	if jn == nil {
+		return nil, missing(parent, field)
+	}
+	node, err := fromJSON(jn)
+	if err != nil {
+		return nil, err
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		return nil, fmt.Errorf("expected BlockStatement, got %s", jn.Kind)
+	}
+	return block, nil
+}
+
+// operatorToken returns the token of the operator expression jn. The operator
+// is stored both in its operator field and in its token, and the engines go by
+// the token; the token is rebuilt from the operator, so that a script that
+// edits the operator changes what the expression does, and not just how it is
+// printed.
+func operatorToken(jn *jsonNode) (token.Token, error) {
+	if jn.Operator == "" {
+		return token.Token{}, missing(jn.Kind, "operator")
+	}
+
+	var tok token.Token
+	if jn.Token != nil {
+		tok = *jn.Token
+	}
+	// Operator tokens are typed by their literal.
+	tok.Type = token.TokenType(jn.Operator)
+	tok.Literal = jn.Operator
+	return tok, nil
+}
+
+func missing(parent string, field string) error {
+	return fmt.Errorf("%s is missing its %s", parent, field)
+}
@@ -0,0 +1,185 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/eval"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/resolver"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x = 5;",
+		"return true;",
+		"-a * b + !c",
+		"if (x < y) { x } else { y }",
+		"if (x > y) { return x; }",
+		"let add = fn(x, y) { x + y; }; add(1, 2 * 3);",
+		"fn() {}()",
+		"let compose = fn(f, g) { fn(x) { g(f(x)) } };",
+		"let twice: fn(fn(int) -> int, int) -> int = fn(f, x: int) -> int { f(f(x)) };",
+		"let thunk: fn() = fn() {};",
+		"while (i < 10) { if (i == 5) { break; } continue; }",
+		"for (x in [1, 2, []]) { x }",
+		"let h = {1: true, x: [2]}; h[x] = y = 3; h[1] *= 2;",
+		"123456789012345678901234567890 - 9223372036854775807",
+		"let total = 12.50d * 3 + 0.05d;",
+		"import \"lib/money.monkey\" as money; money.round(money.total)",
+		`let greeting = "hi, \"you\"\n" + ""; greeting`,
+		"let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };",
+	}
+
+	for i, input := range inputs {
+		p := parser.New(lexer.NewFromString(input))
+		program := p.ParseProgram()
+		if p.HasErrors() {
+			t.Fatalf("[%d] parser errors: %v", i, p.Errors())
+		}
+
+		data, err := json.Marshal(program)
+		if err != nil {
+			t.Fatalf("[%d] marshal: %v", i, err)
+		}
+
+		decoded := &ast.Program{}
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("[%d] unmarshal: %v", i, err)
+		}
+
+		if exp, act := program.String(), decoded.String(); exp != act {
+			t.Errorf("[%d] String(): expected %q, got %q", i, exp, act)
+		}
+
+		if !reflect.DeepEqual(program, decoded) {
+			t.Errorf("[%d] decoded program differs from original\njson: %s", i, data)
+		}
+	}
+}
+
+func TestJSONPreservesLocations(t *testing.T) {
+	program := parser.New(lexer.NewFromString("let x = 5;\n  x + 1")).ParseProgram()
+
+	data, err := ast.Marshal(program)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	node, err := ast.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	stmt := node.(*ast.Program).Statements[1].(*ast.ExpressionStatement)
+	infix := stmt.Value.(*ast.InfixExpression)
+
+	expected := token.Location{Path: token.NO_FILEPATH, LineN: 2, CharN: 5}
+	if act := infix.Token().Location; act != expected {
+		t.Errorf("expected location %v, got %v", expected, act)
+	}
+}
+
+func TestJSONSingleNode(t *testing.T) {
+	node := &ast.PrefixExpression{
+		OperatorToken: token.Token{Type: token.BANG, Literal: "!"},
+		Operator:      "!",
+		RHS: &ast.BooleanLiteral{
+			BoolToken: token.Token{Type: token.TRUE, Literal: "true"},
+			Value:     true,
+		},
+	}
+
+	data, err := ast.Marshal(node)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	decoded, err := ast.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if !reflect.DeepEqual(node, decoded) {
+		t.Errorf("expected %#v, got %#v", node, decoded)
+	}
+}
+
+func TestJSONEditedOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		from, to string
+		expected int64
+	}{
+		{"1 + 2", `"operator":"+"`, `"operator":"*"`, 2},
+		{"-5", `"operator":"-"`, `"operator":"~"`, ^5},
+		{"let x = 7; x -= 2; x", `"operator":"-="`, `"operator":"*="`, 14},
+	}
+
+	for i, tt := range tests {
+		program := parser.New(lexer.NewFromString(tt.input)).ParseProgram()
+		data, err := ast.Marshal(program)
+		if err != nil {
+			t.Fatalf("[%d] marshal: %v", i, err)
+		}
+		edited := strings.Replace(string(data), tt.from, tt.to, 1)
+		if edited == string(data) {
+			t.Fatalf("[%d] %s not found in %s", i, tt.from, data)
+		}
+
+		node, err := ast.Unmarshal([]byte(edited))
+		if err != nil {
+			t.Fatalf("[%d] unmarshal: %v", i, err)
+		}
+		decoded := node.(*ast.Program)
+		if errs := resolver.New().Resolve(decoded); len(errs) > 0 {
+			t.Fatalf("[%d] resolver errors: %v", i, errs)
+		}
+
+		result := eval.Eval(decoded, object.NewEnvironment(decoded.NumSlots))
+		integer, ok := result.(*object.Integer)
+		if !ok || integer.Value != tt.expected {
+			t.Errorf("[%d] %s: expected %d, got %s", i, decoded.String(), tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []string{
+		`{"kind": "Bogus"}`,
+		`{"kind": "Program", "statements": [{"kind": "Identifier", "ident": "x"}]}`,
+		`{"kind": "IntegerLiteral"}`,
+		`{"kind": "LetStatement", "name": {"kind": "BooleanLiteral", "bool": true}}`,
+		`{"kind": "Program", "statements": [null]}`,
+		`{"kind": "InfixExpression", "operator": "+"}`,
+		`{"kind": "InfixExpression", "lhs": {"kind": "IntegerLiteral", "int": 1}, "rhs": {"kind": "IntegerLiteral", "int": 2}}`,
+		`{"kind": "InfixExpression", "operator": "+", "lhs": {"kind": "IntegerLiteral", "int": 1}}`,
+		`{"kind": "LetStatement", "name": {"kind": "Identifier", "ident": "x"}}`,
+		`{"kind": "ExpressionStatement"}`,
+		`{"kind": "IfExpression", "condition": {"kind": "BooleanLiteral", "bool": true}}`,
+		`{"kind": "WhileStatement", "body": {"kind": "BlockStatement"}}`,
+		`{"kind": "FunctionLiteral", "parameters": [null], "body": {"kind": "BlockStatement"}}`,
+		`{"kind": "CallExpression", "arguments": []}`,
+		`{"kind": "ArrayLiteral", "elements": [{"kind": "IntegerLiteral", "int": 1}, null]}`,
+		`{"kind": "IndexExpression", "lhs": {"kind": "Identifier", "ident": "x"}}`,
+		`not json`,
+	}
+
+	for i, input := range tests {
+		if _, err := ast.Unmarshal([]byte(input)); err == nil {
+			t.Errorf("[%d] expected error decoding %s", i, input)
+		}
+	}
+
+	// Only type annotations and the alternative of an if may be missing.
+	input := `{"kind": "IfExpression", "condition": {"kind": "Identifier", "ident": "x"}, "consequence": {"kind": "BlockStatement"}}`
+	if _, err := ast.Unmarshal([]byte(input)); err != nil {
+		t.Errorf("expected no error decoding %s, got %v", input, err)
+	}
+}
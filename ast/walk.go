@@ -0,0 +1,290 @@
+package ast
+
+import "reflect"
+
+// Walk traverses the AST rooted at node in depth-first order. pre is called on
+// each node before its children are visited; if it returns false, the node's
+// children (and its post call) are skipped. post, if not nil, is called on each
+// node after all of its children have been visited. Nil children are not
+// visited.
+func Walk(node Node, pre func(Node) bool, post func(Node)) {
+	if isNilNode(node) {
+		return
+	}
+
+	if pre != nil && !pre(node) {
+		return
+	}
+
+	for _, child := range children(node) {
+		Walk(child, pre, post)
+	}
+
+	if post != nil {
+		post(node)
+	}
+}
+
+// ModifierFunc is called by Modify on each node; the node it returns replaces
+// the node it was given.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the AST rooted at node bottom-up: every child of a node is
+// modified (and replaced in place) before modifier is called on the node
+// itself. The result of calling modifier on node is returned.
+//
+// Fields that hold a concrete node type, like LetStatement.Name, are set to nil
+// if modifier replaces them with a node of a different type.
+func Modify(node Node, modifier ModifierFunc) Node {
+	if isNilNode(node) {
+		return node
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for i, stmt := range n.Statements {
+			n.Statements[i], _ = Modify(stmt, modifier).(Statement)
+		}
+	case *LetStatement:
+		n.Name, _ = Modify(n.Name, modifier).(*Identifier)
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ReturnStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ImportStatement:
+		n.Name, _ = Modify(n.Name, modifier).(*Identifier)
+	case *ExpressionStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+	case *BlockStatement:
+		for i, stmt := range n.Statements {
+			n.Statements[i], _ = Modify(stmt, modifier).(Statement)
+		}
+	case *WhileStatement:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+	case *ForStatement:
+		n.Variable, _ = Modify(n.Variable, modifier).(*Identifier)
+		n.Iterable = modifyExpression(n.Iterable, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+	case *ArrayLiteral:
+		for i, el := range n.Elements {
+			n.Elements[i] = modifyExpression(el, modifier)
+		}
+	case *HashLiteral:
+		for i := range n.Keys {
+			n.Keys[i] = modifyExpression(n.Keys[i], modifier)
+			n.Values[i] = modifyExpression(n.Values[i], modifier)
+		}
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+	case *MemberExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Member, _ = Modify(n.Member, modifier).(*Identifier)
+	case *PrefixExpression:
+		n.RHS = modifyExpression(n.RHS, modifier)
+	case *InfixExpression:
+		n.LHS = modifyExpression(n.LHS, modifier)
+		n.RHS = modifyExpression(n.RHS, modifier)
+	case *AssignExpression:
+		n.Target = modifyExpression(n.Target, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+	case *Identifier:
+		n.Type = modifyType(n.Type, modifier)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i], _ = Modify(param, modifier).(*Identifier)
+		}
+		n.ReturnType = modifyType(n.ReturnType, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+	case *MacroLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i], _ = Modify(param, modifier).(*Identifier)
+		}
+		n.Body = modifyBlock(n.Body, modifier)
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		for i, arg := range n.Arguments {
+			n.Arguments[i] = modifyExpression(arg, modifier)
+		}
+	case *FunctionType:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = modifyType(param, modifier)
+		}
+		n.Return = modifyType(n.Return, modifier)
+	}
+
+	return modifier(node)
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if isNilNode(exp) {
+		return exp
+	}
+	modified, _ := Modify(exp, modifier).(Expression)
+	return modified
+}
+
+func modifyType(te TypeExpression, modifier ModifierFunc) TypeExpression {
+	if isNilNode(te) {
+		return te
+	}
+	modified, _ := Modify(te, modifier).(TypeExpression)
+	return modified
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	modified, _ := Modify(block, modifier).(*BlockStatement)
+	return modified
+}
+
+// children returns the non-nil direct children of node, in source order.
+func children(node Node) []Node {
+	out := []Node{}
+	add := func(child Node) {
+		if !isNilNode(child) {
+			out = append(out, child)
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			add(stmt)
+		}
+	case *LetStatement:
+		add(n.Name)
+		add(n.Value)
+	case *ReturnStatement:
+		add(n.Value)
+	case *ImportStatement:
+		add(n.Name)
+	case *ExpressionStatement:
+		add(n.Value)
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			add(stmt)
+		}
+	case *WhileStatement:
+		add(n.Condition)
+		add(n.Body)
+	case *ForStatement:
+		add(n.Variable)
+		add(n.Iterable)
+		add(n.Body)
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			add(el)
+		}
+	case *HashLiteral:
+		for i, key := range n.Keys {
+			add(key)
+			add(n.Values[i])
+		}
+	case *IndexExpression:
+		add(n.Left)
+		add(n.Index)
+	case *MemberExpression:
+		add(n.Left)
+		add(n.Member)
+	case *PrefixExpression:
+		add(n.RHS)
+	case *InfixExpression:
+		add(n.LHS)
+		add(n.RHS)
+	case *AssignExpression:
+		add(n.Target)
+		add(n.Value)
+	case *IfExpression:
+		add(n.Condition)
+		add(n.Consequence)
+		add(n.Alternative)
+	case *Identifier:
+		add(n.Type)
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			add(param)
+		}
+		add(n.ReturnType)
+		add(n.Body)
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			add(param)
+		}
+		add(n.Body)
+	case *CallExpression:
+		add(n.Function)
+		for _, arg := range n.Arguments {
+			add(arg)
+		}
+	case *FunctionType:
+		for _, param := range n.Parameters {
+			add(param)
+		}
+		add(n.Return)
+	}
+
+	return out
+}
+
+// Copy returns a deep copy of the AST rooted at node. Nothing reachable from
+// the copy is shared with the original.
+func Copy(node Node) Node {
+	if isNilNode(node) {
+		return node
+	}
+	return copyValue(reflect.ValueOf(node)).Interface().(Node)
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		if v.Kind() == reflect.Interface {
+			c := reflect.New(v.Type()).Elem()
+			c.Set(copyValue(v.Elem()))
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// isNilNode reports whether node is nil, or is an interface holding a nil
+// pointer. The parser can leave the latter behind when it hits an error.
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
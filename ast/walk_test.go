@@ -0,0 +1,346 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// walkProgram contains at least one of every node type, with every optional
+// child field filled in.
+const walkProgram = `
+import "lib.monkey" as lib;
+let one = lib.one;
+let add = fn(a: int, b) -> int { return a + b; };
+let apply: fn(fn(int) -> bool) = fn(f) { f(one) };
+if (!true) { add(one, -2) } else { 3 * 4 }
+let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+while (one < 3) { for (x in [one, 2]) { if (x) { break; } continue; } }
+let h = {one: [1], true: 2};
+h[one] += add(1, 2);
+let price = 12.50d * one;
+let name = "s" + lib.suffix;
+`
+
+var allNodeTypes = []ast.Node{
+	&ast.Program{},
+	&ast.LetStatement{},
+	&ast.ReturnStatement{},
+	&ast.ExpressionStatement{},
+	&ast.BlockStatement{},
+	&ast.WhileStatement{},
+	&ast.ForStatement{},
+	&ast.BreakStatement{},
+	&ast.ContinueStatement{},
+	&ast.ImportStatement{},
+	&ast.Identifier{},
+	&ast.IntegerLiteral{},
+	&ast.DecimalLiteral{},
+	&ast.StringLiteral{},
+	&ast.BooleanLiteral{},
+	&ast.ArrayLiteral{},
+	&ast.HashLiteral{},
+	&ast.IndexExpression{},
+	&ast.MemberExpression{},
+	&ast.PrefixExpression{},
+	&ast.InfixExpression{},
+	&ast.AssignExpression{},
+	&ast.IfExpression{},
+	&ast.FunctionLiteral{},
+	&ast.MacroLiteral{},
+	&ast.CallExpression{},
+	&ast.NamedType{},
+	&ast.FunctionType{},
+}
+
+func TestWalkVisitsEveryChild(t *testing.T) {
+	program := parseWalkProgram(t)
+
+	expected := map[ast.Node]bool{}
+	collectByReflection(program, expected)
+
+	for _, nt := range allNodeTypes {
+		found := false
+		for node := range expected {
+			if reflect.TypeOf(node) == reflect.TypeOf(nt) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("test program has no %T node", nt)
+		}
+	}
+
+	visited := map[ast.Node]bool{}
+	ast.Walk(program, func(n ast.Node) bool {
+		if visited[n] {
+			t.Errorf("visited %T %q twice", n, n.String())
+		}
+		visited[n] = true
+		return true
+	}, nil)
+
+	for node := range expected {
+		if !visited[node] {
+			t.Errorf("Walk skipped %T %q", node, node.String())
+		}
+	}
+	if exp, act := len(expected), len(visited); exp != act {
+		t.Errorf("expected %d nodes visited, got %d", exp, act)
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	program := checkParse(t, "1 + -x")
+
+	var pre, post []string
+	ast.Walk(program, func(n ast.Node) bool {
+		pre = append(pre, reflect.TypeOf(n).Elem().Name())
+		return true
+	}, func(n ast.Node) {
+		post = append(post, reflect.TypeOf(n).Elem().Name())
+	})
+
+	expPre := []string{"Program", "ExpressionStatement", "InfixExpression", "IntegerLiteral", "PrefixExpression", "Identifier"}
+	expPost := []string{"IntegerLiteral", "Identifier", "PrefixExpression", "InfixExpression", "ExpressionStatement", "Program"}
+
+	if !reflect.DeepEqual(expPre, pre) {
+		t.Errorf("pre order: expected %v, got %v", expPre, pre)
+	}
+	if !reflect.DeepEqual(expPost, post) {
+		t.Errorf("post order: expected %v, got %v", expPost, post)
+	}
+}
+
+func TestWalkSkipsChildren(t *testing.T) {
+	program := checkParse(t, "let f = fn(x) { x + 1 }; f(2)")
+
+	var idents []string
+	ast.Walk(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		_, isFn := n.(*ast.FunctionLiteral)
+		return !isFn
+	}, nil)
+
+	if exp := []string{"f", "f"}; !reflect.DeepEqual(exp, idents) {
+		t.Errorf("expected %v, got %v", exp, idents)
+	}
+}
+
+func TestModifyReplacesEveryChild(t *testing.T) {
+	program := parseWalkProgram(t)
+
+	// Wrap every node in a fresh copy of itself; afterwards no node from the
+	// original tree may still be reachable.
+	original := map[ast.Node]bool{}
+	collectByReflection(program, original)
+
+	modified := ast.Modify(program, func(n ast.Node) ast.Node {
+		v := reflect.New(reflect.TypeOf(n).Elem())
+		v.Elem().Set(reflect.ValueOf(n).Elem())
+		return v.Interface().(ast.Node)
+	})
+
+	after := map[ast.Node]bool{}
+	collectByReflection(modified, after)
+
+	for node := range after {
+		if original[node] {
+			t.Errorf("Modify did not replace %T %q", node, node.String())
+		}
+	}
+	if exp, act := len(original), len(after); exp != act {
+		t.Errorf("expected %d nodes after modify, got %d", exp, act)
+	}
+	if exp, act := program.String(), modified.String(); exp != act {
+		t.Errorf("expected %q, got %q", exp, act)
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() ast.Expression { return &ast.IntegerLiteral{Value: 1} }
+	two := func() ast.Expression { return &ast.IntegerLiteral{Value: 2} }
+	ident := func(name string) *ast.Identifier { return &ast.Identifier{Value: name} }
+
+	turnOneIntoTwo := func(node ast.Node) ast.Node {
+		integer, ok := node.(*ast.IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &ast.IntegerLiteral{Value: 2}
+	}
+	renameXToY := func(node ast.Node) ast.Node {
+		if id, ok := node.(*ast.Identifier); ok && id.Value == "x" {
+			return ident("y")
+		}
+		return node
+	}
+
+	tests := []struct {
+		input    ast.Node
+		modifier ast.ModifierFunc
+		expected ast.Node
+	}{
+		{one(), turnOneIntoTwo, two()},
+		{
+			&ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Value: one()}}},
+			turnOneIntoTwo,
+			&ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Value: two()}}},
+		},
+		{
+			&ast.InfixExpression{LHS: one(), Operator: "+", RHS: two()},
+			turnOneIntoTwo,
+			&ast.InfixExpression{LHS: two(), Operator: "+", RHS: two()},
+		},
+		{
+			&ast.PrefixExpression{Operator: "-", RHS: one()},
+			turnOneIntoTwo,
+			&ast.PrefixExpression{Operator: "-", RHS: two()},
+		},
+		{
+			&ast.IfExpression{
+				Condition:   one(),
+				Consequence: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Value: one()}}},
+				Alternative: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Value: one()}}},
+			},
+			turnOneIntoTwo,
+			&ast.IfExpression{
+				Condition:   two(),
+				Consequence: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Value: two()}}},
+				Alternative: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Value: two()}}},
+			},
+		},
+		{&ast.ReturnStatement{Value: one()}, turnOneIntoTwo, &ast.ReturnStatement{Value: two()}},
+		{
+			&ast.LetStatement{Name: ident("x"), Value: one()},
+			turnOneIntoTwo,
+			&ast.LetStatement{Name: ident("x"), Value: two()},
+		},
+		{
+			&ast.LetStatement{Name: ident("x"), Value: ident("x")},
+			renameXToY,
+			&ast.LetStatement{Name: ident("y"), Value: ident("y")},
+		},
+		{
+			&ast.FunctionLiteral{
+				Parameters: []*ast.Identifier{ident("x"), ident("z")},
+				Body:       &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Value: one()}}},
+			},
+			turnOneIntoTwo,
+			&ast.FunctionLiteral{
+				Parameters: []*ast.Identifier{ident("x"), ident("z")},
+				Body:       &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Value: two()}}},
+			},
+		},
+		{
+			&ast.FunctionLiteral{Parameters: []*ast.Identifier{ident("x"), ident("z")}, Body: &ast.BlockStatement{}},
+			renameXToY,
+			&ast.FunctionLiteral{Parameters: []*ast.Identifier{ident("y"), ident("z")}, Body: &ast.BlockStatement{}},
+		},
+		{
+			&ast.CallExpression{Function: ident("x"), Arguments: []ast.Expression{one(), ident("x")}},
+			renameXToY,
+			&ast.CallExpression{Function: ident("y"), Arguments: []ast.Expression{one(), ident("y")}},
+		},
+	}
+
+	for i, tt := range tests {
+		modified := ast.Modify(tt.input, tt.modifier)
+		if !reflect.DeepEqual(tt.expected, modified) {
+			t.Errorf("[%d] expected %#v, got %#v", i, tt.expected, modified)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	program := parseWalkProgram(t)
+	copied := ast.Copy(program)
+
+	if !reflect.DeepEqual(program, copied) {
+		t.Fatalf("copy differs from original")
+	}
+
+	original := map[ast.Node]bool{}
+	ast.Walk(program, func(n ast.Node) bool {
+		original[n] = true
+		return true
+	}, nil)
+
+	ast.Walk(copied, func(n ast.Node) bool {
+		if original[n] {
+			t.Errorf("copy shares %T %q with original", n, n.String())
+		}
+		return true
+	}, nil)
+}
+
+func TestModifyIgnoresNilChildren(t *testing.T) {
+	node := &ast.IfExpression{
+		IfToken:     token.Token{Type: token.IF, Literal: "if"},
+		Condition:   &ast.BooleanLiteral{Value: true},
+		Consequence: &ast.BlockStatement{},
+	}
+
+	calls := 0
+	ast.Modify(node, func(n ast.Node) ast.Node {
+		calls++
+		return n
+	})
+
+	if calls != 3 {
+		t.Errorf("expected 3 calls to modifier, got %d", calls)
+	}
+	if node.Alternative != nil {
+		t.Errorf("expected nil alternative, got %v", node.Alternative)
+	}
+}
+
+// collectByReflection adds node and every node reachable from it through its
+// struct fields to seen, independently of the traversal in Walk and Modify.
+func collectByReflection(node ast.Node, seen map[ast.Node]bool) {
+	v := reflect.ValueOf(node)
+	if node == nil || v.IsNil() {
+		return
+	}
+	seen[node] = true
+
+	nodeType := reflect.TypeOf((*ast.Node)(nil)).Elem()
+	var visit func(f reflect.Value)
+	visit = func(f reflect.Value) {
+		switch {
+		case f.Kind() == reflect.Slice:
+			for i := 0; i < f.Len(); i++ {
+				visit(f.Index(i))
+			}
+		case f.Type().Implements(nodeType):
+			if !f.IsNil() {
+				collectByReflection(f.Interface().(ast.Node), seen)
+			}
+		}
+	}
+
+	s := v.Elem()
+	for i := 0; i < s.NumField(); i++ {
+		visit(s.Field(i))
+	}
+}
+
+func parseWalkProgram(t *testing.T) *ast.Program {
+	return checkParse(t, walkProgram)
+}
+
+func checkParse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
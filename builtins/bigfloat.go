@@ -0,0 +1,247 @@
+package builtins
+
+import (
+	"math/big"
+)
+
+// The functions in this file compute transcendental functions of big.Floats to
+// a given precision in bits, with argument reduction followed by a power
+// series. Each expects its arguments to have been checked against its domain.
+// Results are accurate to about prec bits, relative to the largest of 1 and
+// the result.
+
+func newFloat(prec uint) *big.Float {
+	return new(big.Float).SetPrec(prec)
+}
+
+// converged reports whether term is too small to change a sum whose magnitude
+// is at least 1 at prec bits.
+func converged(term *big.Float, prec uint) bool {
+	return term.Sign() == 0 || term.MantExp(nil) < -int(prec)
+}
+
+// floatPi returns π, by Machin's formula: π = 16 atan(1/5) - 4 atan(1/239).
+func floatPi(prec uint) *big.Float {
+	work := prec + 16
+	a := atanInverse(5, work)
+	a.Mul(a, newFloat(work).SetInt64(16))
+	b := atanInverse(239, work)
+	b.Mul(b, newFloat(work).SetInt64(4))
+	return a.Sub(a, b).SetPrec(prec)
+}
+
+// atanInverse returns atan(1/n), for an integer n > 1.
+func atanInverse(n int64, prec uint) *big.Float {
+	nsquared := newFloat(prec).SetInt64(n * n)
+	power := newFloat(prec).Quo(newFloat(prec).SetInt64(1), newFloat(prec).SetInt64(n))
+	sum := newFloat(prec).Set(power)
+
+	for k := int64(1); ; k++ {
+		power.Quo(power, nsquared)
+		term := newFloat(prec).Quo(power, newFloat(prec).SetInt64(2*k+1))
+		if converged(term, prec) {
+			return sum
+		}
+		if k%2 == 1 {
+			sum.Sub(sum, term)
+		} else {
+			sum.Add(sum, term)
+		}
+	}
+}
+
+// atanh returns atanh(z), for |z| <= 1/3, as z + z³/3 + z⁵/5 + ...
+func atanh(z *big.Float, prec uint) *big.Float {
+	zsquared := newFloat(prec).Mul(z, z)
+	power := newFloat(prec).Set(z)
+	sum := newFloat(prec).Set(z)
+
+	for k := int64(1); ; k++ {
+		power.Mul(power, zsquared)
+		term := newFloat(prec).Quo(power, newFloat(prec).SetInt64(2*k+1))
+		if converged(term, prec) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// floatLn2 returns ln 2, as 2 atanh(1/3).
+func floatLn2(prec uint) *big.Float {
+	third := newFloat(prec).Quo(newFloat(prec).SetInt64(1), newFloat(prec).SetInt64(3))
+	ln2 := atanh(third, prec)
+	return ln2.Mul(ln2, newFloat(prec).SetInt64(2))
+}
+
+// floatLog returns the natural logarithm of x > 0. x is split into m × 2^e,
+// with m in [1/2, 1), so that ln x = e ln 2 + 2 atanh((m - 1) / (m + 1)).
+func floatLog(x *big.Float, prec uint) *big.Float {
+	m := new(big.Float)
+	e := x.MantExp(m)
+
+	work := prec + uint(bitLen(int64(e))) + 16
+	m.SetPrec(work)
+	one := newFloat(work).SetInt64(1)
+	z := newFloat(work).Quo(newFloat(work).Sub(m, one), newFloat(work).Add(m, one))
+	lnm := atanh(z, work)
+	lnm.Mul(lnm, newFloat(work).SetInt64(2))
+
+	ln2 := floatLn2(work)
+	result := newFloat(work).Mul(ln2, newFloat(work).SetInt64(int64(e)))
+	return result.Add(result, lnm).SetPrec(prec)
+}
+
+// floatExp returns e^x, for |x| small enough that the result's exponent fits
+// in an int. x is reduced to r = x - n ln 2, so that e^x = 2^n e^r, and r is
+// halved a few times more before summing its Taylor series, which is then
+// squared back.
+func floatExp(x *big.Float, prec uint) *big.Float {
+	const halvings = 8
+
+	estimate, _ := x.Float64()
+	n := int64(estimate / 0.6931471805599453)
+	work := prec + uint(bitLen(n)) + halvings + 16
+
+	ln2 := floatLn2(work)
+	r := newFloat(work).Mul(ln2, newFloat(work).SetInt64(n))
+	r.Sub(newFloat(work).Set(x), r)
+	r.SetMantExp(r, -halvings)
+
+	sum := newFloat(work).SetInt64(1)
+	term := newFloat(work).SetInt64(1)
+	for k := int64(1); ; k++ {
+		term.Mul(term, r)
+		term.Quo(term, newFloat(work).SetInt64(k))
+		if converged(term, work) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+
+	for i := 0; i < halvings; i++ {
+		sum.Mul(sum, sum)
+	}
+	return sum.SetMantExp(sum, int(n)).SetPrec(prec)
+}
+
+// floatSinCos returns sin x and cos x. x is reduced to r = x - k π/2, with
+// |r| <= π/4, and the quarter turn k chooses which of sin r and cos r, and
+// which sign, each result is.
+func floatSinCos(x *big.Float, prec uint) (*big.Float, *big.Float) {
+	work := prec + 16
+	if exp := x.MantExp(nil); exp > 0 {
+		work += uint(exp)
+	}
+
+	halfPi := floatPi(work)
+	halfPi.SetMantExp(halfPi, -1)
+
+	quarters := newFloat(work).Quo(x, halfPi)
+	k, _ := nearestInteger(quarters).Int(nil)
+	r := newFloat(work).Mul(halfPi, newFloat(work).SetInt(k))
+	r.Sub(newFloat(work).Set(x), r)
+
+	sin, cos := taylorSinCos(r, work)
+	switch new(big.Int).And(k, big.NewInt(3)).Int64() {
+	case 1:
+		sin, cos = cos, sin.Neg(sin)
+	case 2:
+		sin, cos = sin.Neg(sin), cos.Neg(cos)
+	case 3:
+		sin, cos = cos.Neg(cos), sin
+	}
+	return sin.SetPrec(prec), cos.SetPrec(prec)
+}
+
+// taylorSinCos returns sin r and cos r, for |r| <= π/4, from their Taylor
+// series.
+func taylorSinCos(r *big.Float, prec uint) (*big.Float, *big.Float) {
+	sin := newFloat(prec).Set(r)
+	cos := newFloat(prec).SetInt64(1)
+
+	// term is r^k / k!, which alternates between adding to cos and to sin.
+	term := newFloat(prec).Set(r)
+	for k := int64(2); ; k++ {
+		term.Mul(term, r)
+		term.Quo(term, newFloat(prec).SetInt64(k))
+		if converged(term, prec) {
+			return sin, cos
+		}
+
+		target := cos
+		if k%2 == 1 {
+			target = sin
+		}
+		if k%4 < 2 {
+			target.Add(target, term)
+		} else {
+			target.Sub(target, term)
+		}
+	}
+}
+
+// floatAtan returns atan x. Arguments larger than 1 use atan x = π/2 -
+// atan(1/x), and the rest are halved with atan x = 2 atan(x / (1 + √(1 +
+// x²))) until the Taylor series converges quickly.
+func floatAtan(x *big.Float, prec uint) *big.Float {
+	const halvings = 4
+	work := prec + halvings + 16
+
+	if x.Sign() < 0 {
+		result := floatAtan(newFloat(work).Neg(x), prec)
+		return result.Neg(result)
+	}
+
+	one := newFloat(work).SetInt64(1)
+	if x.Cmp(one) > 0 {
+		halfPi := floatPi(work)
+		halfPi.SetMantExp(halfPi, -1)
+		inverse := floatAtan(newFloat(work).Quo(one, x), work)
+		return halfPi.Sub(halfPi, inverse).SetPrec(prec)
+	}
+
+	y := newFloat(work).Set(x)
+	for i := 0; i < halvings; i++ {
+		root := newFloat(work).Mul(y, y)
+		root.Add(root, one)
+		root.Sqrt(root)
+		y.Quo(y, root.Add(root, one))
+	}
+
+	ysquared := newFloat(work).Mul(y, y)
+	power := newFloat(work).Set(y)
+	sum := newFloat(work).Set(y)
+	for k := int64(1); ; k++ {
+		power.Mul(power, ysquared)
+		term := newFloat(work).Quo(power, newFloat(work).SetInt64(2*k+1))
+		if converged(term, work) {
+			break
+		}
+		if k%2 == 1 {
+			sum.Sub(sum, term)
+		} else {
+			sum.Add(sum, term)
+		}
+	}
+	return sum.SetMantExp(sum, halvings).SetPrec(prec)
+}
+
+// nearestInteger returns x rounded to the nearest integer, with ties away from
+// zero.
+func nearestInteger(x *big.Float) *big.Float {
+	half := new(big.Float).SetFloat64(0.5)
+	if x.Sign() < 0 {
+		half.Neg(half)
+	}
+	rounded := new(big.Float).SetPrec(x.Prec()).Add(x, half)
+	i, _ := rounded.Int(nil)
+	return new(big.Float).SetInt(i)
+}
+
+// bitLen returns the number of bits in the magnitude of n.
+func bitLen(n int64) int {
+	if n < 0 {
+		n = -n
+	}
+	return big.NewInt(n).BitLen()
+}
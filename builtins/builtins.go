@@ -0,0 +1,236 @@
+// Package builtins defines the functions, and the modules of functions, that
+// every Monkey program can use without binding them first. A program can still
+// bind their names to something else, which hides the builtin.
+package builtins
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+)
+
+// Builtins lists every builtin: each is an *object.Builtin, an *object.Module
+// or a *Placeholder. Builtins are referred to by their index in this list,
+// including in compiled bytecode, so new ones must be added to the end.
+var Builtins = []object.Object{
+	&object.Builtin{Name: "rational", Fn: rational},
+	&object.Builtin{Name: "numerator", Fn: numerator},
+	&object.Builtin{Name: "denominator", Fn: denominator},
+	&object.Builtin{Name: "decimal", Fn: decimal},
+	stringsModule,
+	mathModule,
+	jsonModule,
+	fsModule,
+	Args,
+	&object.Builtin{Name: "env", Fn: env},
+	&object.Builtin{Name: "exit", Fn: exit},
+}
+
+// Placeholder is a builtin that engines replace with a value of their own
+// whenever a program refers to it.
+type Placeholder struct {
+	Name string
+}
+
+func (p *Placeholder) Type() object.ObjectType {
+	return object.O_BUILTIN
+}
+
+func (p *Placeholder) Inspect() string {
+	return fmt.Sprintf("builtin %s", p.Name)
+}
+
+// Args stands for the array of arguments that the program was run with.
+var Args = &Placeholder{Name: "args"}
+
+// Lookup returns the index of the builtin named name.
+func Lookup(name string) (int, bool) {
+	for i, b := range Builtins {
+		if Name(b) == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Name returns the name that programs refer to the builtin b by.
+func Name(b object.Object) string {
+	switch b := b.(type) {
+	case *object.Builtin:
+		return b.Name
+	case *object.Module:
+		return b.Path
+	case *Placeholder:
+		return b.Name
+	default:
+		panic(fmt.Sprintf("not a builtin: %s", b.Inspect()))
+	}
+}
+
+// newModule returns the builtin module called name, whose members are fns. Each
+// function's name is qualified by the module's, as it is in error messages.
+func newModule(name string, fns ...*object.Builtin) *object.Module {
+	mod := &object.Module{Path: name, Members: map[string]object.Object{}}
+	for _, fn := range fns {
+		mod.Members[fn.Name] = fn
+		fn.Name = name + "." + fn.Name
+	}
+	return mod
+}
+
+// rational(n, d) divides the integer n by the integer d exactly. It gives a
+// rational, or an integer if d divides n.
+func rational(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if err := checkArgs("rational", args, 2); err != nil {
+		return nil, err
+	}
+	n, err := integerArg("rational", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	d, err := integerArg("rational", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Sign() == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return ops.Rational(new(big.Rat).SetFrac(n, d)), nil
+}
+
+// numerator(x) returns the numerator of the integer or rational x, in lowest
+// terms. The sign of a rational is kept in its numerator.
+func numerator(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := fractionArg("numerator", args)
+	if err != nil {
+		return nil, err
+	}
+	return ops.Integer(new(big.Int).Set(r.Num())), nil
+}
+
+// denominator(x) returns the denominator of the integer or rational x, in
+// lowest terms. It is always positive, and is 1 for an integer.
+func denominator(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := fractionArg("denominator", args)
+	if err != nil {
+		return nil, err
+	}
+	return ops.Integer(new(big.Int).Set(r.Denom())), nil
+}
+
+// decimal(x, places) returns the number x as a decimal with places decimal
+// places, rounded the way decimal division is.
+func decimal(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if err := checkArgs("decimal", args, 2); err != nil {
+		return nil, err
+	}
+
+	r, err := numberArg("decimal", args, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	places, ok := args[1].(*object.Integer)
+	if !ok {
+		return nil, fmt.Errorf("argument 2 to decimal must be INTEGER, got %s", args[1].Type())
+	}
+	if places.Value < 0 || places.Value > ops.MaxPlaces {
+		return nil, fmt.Errorf("decimal places must be between 0 and %d, got %d", ops.MaxPlaces, places.Value)
+	}
+
+	return ops.Round(r, int(places.Value), arith.Rounding), nil
+}
+
+// env(name) returns the value of the environment variable name, or null if it
+// isn't set. Engines only allow it if they're told to.
+func env(_ object.Arithmetic, perms object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("env", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if !perms.Env {
+		return nil, fmt.Errorf("env of %s is not allowed", s[0])
+	}
+
+	value, ok := os.LookupEnv(s[0])
+	if !ok {
+		return object.NULL_OBJ, nil
+	}
+	return &object.String{Value: value}, nil
+}
+
+// exit(code) ends the program, which exits with code, from 0 to 255. exit()
+// exits with 0.
+func exit(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("wrong number of arguments to exit: want=0 or 1, got=%d", len(args))
+	}
+
+	code := int64(0)
+	if len(args) == 1 {
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("argument 1 to exit must be INTEGER, got %s", args[0].Type())
+		}
+		if n.Value < 0 || n.Value > 255 {
+			return nil, fmt.Errorf("exit code must be between 0 and 255, got %d", n.Value)
+		}
+		code = n.Value
+	}
+	return nil, &object.Exit{Code: int(code)}
+}
+
+func checkArgs(name string, args []object.Object, want int) error {
+	if len(args) != want {
+		return fmt.Errorf("wrong number of arguments to %s: want=%d, got=%d", name, want, len(args))
+	}
+	return nil
+}
+
+// integerArg returns the value of args[i], which must be an Integer or BigInt.
+func integerArg(name string, args []object.Object, i int) (*big.Int, error) {
+	switch arg := args[i].(type) {
+	case *object.Integer:
+		return big.NewInt(arg.Value), nil
+	case *object.BigInt:
+		return arg.Value, nil
+	default:
+		return nil, fmt.Errorf("argument %d to %s must be INTEGER, got %s", i+1, name, arg.Type())
+	}
+}
+
+// numberArg returns the exact value of args[i], which must be a number.
+func numberArg(name string, args []object.Object, i int) (*big.Rat, error) {
+	switch arg := args[i].(type) {
+	case *object.Integer:
+		return new(big.Rat).SetInt64(arg.Value), nil
+	case *object.BigInt:
+		return new(big.Rat).SetInt(arg.Value), nil
+	case *object.Decimal:
+		return arg.Rat(), nil
+	case *object.Rational:
+		return arg.Value, nil
+	default:
+		return nil, fmt.Errorf("argument %d to %s must be a number, got %s", i+1, name, arg.Type())
+	}
+}
+
+// fractionArg returns the value of the only argument in args, which must be an
+// integer or a rational.
+func fractionArg(name string, args []object.Object) (*big.Rat, error) {
+	if err := checkArgs(name, args, 1); err != nil {
+		return nil, err
+	}
+	if r, ok := args[0].(*object.Rational); ok {
+		return r.Value, nil
+	}
+	n, err := integerArg(name, args, 0)
+	if err != nil {
+		return nil, fmt.Errorf("argument 1 to %s must be INTEGER or RATIONAL, got %s", name, args[0].Type())
+	}
+	return new(big.Rat).SetInt(n), nil
+}
@@ -0,0 +1,181 @@
+package builtins
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+)
+
+// fsModule is the fs module. Each path it is given is resolved with
+// ResolvePath, and the result is what is checked against the engine's
+// permissions and then used. Engines allow nothing unless they're told to, so
+// the module is disabled by default.
+var fsModule = newModule("fs",
+	&object.Builtin{Name: "read", Fn: fsRead},
+	&object.Builtin{Name: "write", Fn: fsWrite},
+	&object.Builtin{Name: "list", Fn: fsList},
+	&object.Builtin{Name: "exists", Fn: fsExists},
+)
+
+// maxSymlinks is the most symlinks ResolvePath follows, so that a loop of them
+// can't go on forever.
+const maxSymlinks = 255
+
+// ResolvePath returns path made absolute, relative to the working directory,
+// and cleaned, with every symlink in it resolved. The parts of path that don't
+// exist yet are kept as they are, under whatever the parts that do exist
+// resolve to.
+func ResolvePath(path string) (string, error) {
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return resolve(abspath, 0)
+}
+
+// resolve resolves abspath, which is absolute and clean, having followed
+// links symlinks so far.
+func resolve(abspath string, links int) (string, error) {
+	resolved, err := filepath.EvalSymlinks(abspath)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, iofs.ErrNotExist) {
+		return "", err
+	}
+
+	parent := filepath.Dir(abspath)
+	if parent == abspath {
+		return abspath, nil
+	}
+	dir, err := resolve(parent, links)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filepath.Base(abspath))
+
+	// A symlink to something that doesn't exist yet would have it created
+	// wherever the symlink points, so it's resolved too.
+	target, err := os.Readlink(path)
+	if err != nil {
+		return path, nil
+	}
+	if links++; links > maxSymlinks {
+		return "", fmt.Errorf("too many levels of symbolic links")
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return resolve(filepath.Clean(target), links)
+}
+
+// fs.read(path) returns the contents of the file at path, which must be under
+// a directory the engine may read.
+func fsRead(_ object.Arithmetic, perms object.Permissions, args ...object.Object) (object.Object, error) {
+	path, resolved, err := fsPath("fs.read", perms.Read, args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(resolved)
+	if err == nil && info.Size() > ops.MaxStringLen {
+		return nil, fmt.Errorf("fs.read of %s failed: file is too large", path)
+	}
+	contents, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, fsError("fs.read", path, err)
+	}
+	return &object.String{Value: string(contents)}, nil
+}
+
+// fs.write(path, contents) replaces the contents of the file at path, creating
+// it if it doesn't exist. It must be under a directory the engine may write.
+func fsWrite(_ object.Arithmetic, perms object.Permissions, args ...object.Object) (object.Object, error) {
+	path, resolved, err := fsPath("fs.write", perms.Write, args, 2)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := stringArg("fs.write", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(resolved, []byte(contents), 0o644); err != nil {
+		return nil, fsError("fs.write", path, err)
+	}
+	return object.NULL_OBJ, nil
+}
+
+// fs.list(path) returns the names of the entries in the directory at path, in
+// order, which must be under a directory the engine may read.
+func fsList(_ object.Arithmetic, perms object.Permissions, args ...object.Object) (object.Object, error) {
+	path, resolved, err := fsPath("fs.list", perms.Read, args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(resolved)
+	if err != nil {
+		return nil, fsError("fs.list", path, err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return stringArray(names), nil
+}
+
+// fs.exists(path) reports whether there is a file or directory at path, which
+// must be under a directory the engine may read.
+func fsExists(_ object.Arithmetic, perms object.Permissions, args ...object.Object) (object.Object, error) {
+	path, resolved, err := fsPath("fs.exists", perms.Read, args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = os.Stat(resolved)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return object.FALSE_OBJ, nil
+	}
+	if err != nil {
+		return nil, fsError("fs.exists", path, err)
+	}
+	return object.TRUE_OBJ, nil
+}
+
+// fsPath checks that args has want arguments, the first of which is a path,
+// and returns the path along with what it resolves to. It is an error if that
+// isn't under one of roots.
+func fsPath(name string, roots []string, args []object.Object, want int) (string, string, error) {
+	if err := checkArgs(name, args, want); err != nil {
+		return "", "", err
+	}
+	path, err := stringArg(name, args, 0)
+	if err != nil {
+		return "", "", err
+	}
+
+	resolved, err := ResolvePath(path)
+	if err != nil {
+		return "", "", fsError(name, path, err)
+	}
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return path, resolved, nil
+		}
+	}
+	return "", "", fmt.Errorf("%s of %s is not allowed", name, path)
+}
+
+func fsError(name string, path string, err error) error {
+	if perr, ok := err.(*iofs.PathError); ok {
+		err = perr.Err
+	}
+	return fmt.Errorf("%s of %s failed: %v", name, path, err)
+}
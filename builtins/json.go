@@ -0,0 +1,512 @@
+package builtins
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+)
+
+// jsonModule is the json module. JSON objects are hashes with string keys,
+// arrays are arrays, and null is null. Numbers without a fraction or exponent
+// are integers, and the rest are exact decimals, so that numbers make the round
+// trip unchanged.
+var jsonModule = newModule("json",
+	&object.Builtin{Name: "parse", Fn: jsonParse},
+	&object.Builtin{Name: "stringify", Fn: jsonStringify},
+)
+
+// maxJSONDepth is the deepest that arrays and objects can be nested, in either
+// direction, so that a value that contains itself can't recurse forever.
+const maxJSONDepth = 1000
+
+// maxIndent is the most spaces that json.stringify will indent by.
+const maxIndent = 16
+
+// json.parse(s) returns the value that the JSON text s stands for. Errors give
+// the offset of the byte they were found at, counting from 0.
+func jsonParse(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("json.parse", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &jsonParser{src: s[0]}
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.unexpected()
+	}
+	return value, nil
+}
+
+// jsonParser parses JSON text, as specified by RFC 8259.
+type jsonParser struct {
+	src   string
+	pos   int
+	depth int
+}
+
+func (p *jsonParser) errorf(pos int, format string, a ...interface{}) error {
+	return fmt.Errorf("json.parse error at byte %d: %s", pos, fmt.Sprintf(format, a...))
+}
+
+// unexpected returns an error about the byte being parsed.
+func (p *jsonParser) unexpected() error {
+	if p.pos >= len(p.src) {
+		return p.errorf(p.pos, "unexpected end of input")
+	}
+	ch, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return p.errorf(p.pos, "unexpected character %q", ch)
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *jsonParser) accept(ch byte) bool {
+	if p.pos < len(p.src) && p.src[p.pos] == ch {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *jsonParser) value() (object.Object, error) {
+	if p.pos >= len(p.src) {
+		return nil, p.unexpected()
+	}
+
+	switch ch := p.src[p.pos]; {
+	case ch == '{':
+		return p.object()
+	case ch == '[':
+		return p.array()
+	case ch == '"':
+		s, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: s}, nil
+	case ch == '-' || ch >= '0' && ch <= '9':
+		return p.number()
+	}
+
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "true"):
+		p.pos += len("true")
+		return object.TRUE_OBJ, nil
+	case strings.HasPrefix(rest, "false"):
+		p.pos += len("false")
+		return object.FALSE_OBJ, nil
+	case strings.HasPrefix(rest, "null"):
+		p.pos += len("null")
+		return object.NULL_OBJ, nil
+	}
+	return nil, p.unexpected()
+}
+
+// nest notes that the parser has gone into an array or object.
+func (p *jsonParser) nest() error {
+	if p.depth++; p.depth > maxJSONDepth {
+		return p.errorf(p.pos, "nested more than %d deep", maxJSONDepth)
+	}
+	return nil
+}
+
+func (p *jsonParser) object() (object.Object, error) {
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	p.pos++
+
+	hash := object.NewHash()
+	p.skipSpace()
+	if p.accept('}') {
+		p.depth--
+		return hash, nil
+	}
+
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] != '"' {
+			return nil, p.unexpected()
+		}
+		key, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.accept(':') {
+			return nil, p.unexpected()
+		}
+		p.skipSpace()
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(&object.String{Value: key}, value)
+
+		p.skipSpace()
+		if p.accept('}') {
+			p.depth--
+			return hash, nil
+		}
+		if !p.accept(',') {
+			return nil, p.unexpected()
+		}
+		p.skipSpace()
+	}
+}
+
+func (p *jsonParser) array() (object.Object, error) {
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	p.pos++
+
+	elements := []object.Object{}
+	p.skipSpace()
+	if p.accept(']') {
+		p.depth--
+		return &object.Array{Elements: elements}, nil
+	}
+
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+
+		p.skipSpace()
+		if p.accept(']') {
+			p.depth--
+			return &object.Array{Elements: elements}, nil
+		}
+		if !p.accept(',') {
+			return nil, p.unexpected()
+		}
+		p.skipSpace()
+	}
+}
+
+func (p *jsonParser) string() (string, error) {
+	start := p.pos
+	p.pos++
+
+	var out strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return "", p.errorf(start, "unterminated string")
+		}
+
+		ch, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		switch {
+		case ch == '"':
+			p.pos++
+			return out.String(), nil
+		case ch == '\\':
+			r, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			out.WriteRune(r)
+		case ch < 0x20:
+			return "", p.errorf(p.pos, "control character %q in string", ch)
+		case ch == utf8.RuneError && size == 1:
+			return "", p.errorf(p.pos, "invalid UTF-8 in string")
+		default:
+			out.WriteString(p.src[p.pos : p.pos+size])
+			p.pos += size
+		}
+	}
+}
+
+// escape parses the escape sequence that starts at the backslash being parsed.
+// A \u escape of a UTF-16 surrogate pair is decoded as one character.
+func (p *jsonParser) escape() (rune, error) {
+	start := p.pos
+	p.pos++
+	if p.pos >= len(p.src) {
+		return 0, p.errorf(start, "unterminated string")
+	}
+
+	ch := p.src[p.pos]
+	p.pos++
+	if i := strings.IndexByte(`"\/bfnrt`, ch); i >= 0 {
+		return rune("\"\\/\b\f\n\r\t"[i]), nil
+	}
+	if ch != 'u' {
+		return 0, p.errorf(start, "invalid escape %q", p.src[start:p.pos])
+	}
+
+	r, ok := p.hex4()
+	if !ok {
+		return 0, p.errorf(start, "invalid escape %q", p.src[start:p.pos])
+	}
+	if utf16.IsSurrogate(r) && strings.HasPrefix(p.src[p.pos:], `\u`) {
+		mark := p.pos
+		p.pos += 2
+		if low, ok := p.hex4(); ok {
+			if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+				return pair, nil
+			}
+		}
+		p.pos = mark
+	}
+	if utf16.IsSurrogate(r) {
+		return utf8.RuneError, nil
+	}
+	return r, nil
+}
+
+// hex4 parses the four hex digits of a \u escape.
+func (p *jsonParser) hex4() (rune, bool) {
+	if p.pos+4 > len(p.src) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	p.pos += 4
+	return rune(n), true
+}
+
+// number parses a number into an integer, or into a decimal if it has a
+// fraction or an exponent.
+func (p *jsonParser) number() (object.Object, error) {
+	start := p.pos
+	p.accept('-')
+
+	digits := func() int {
+		from := p.pos
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		return p.pos - from
+	}
+
+	// A leading 0 can't be followed by more digits.
+	if !p.accept('0') && digits() == 0 {
+		return nil, p.unexpected()
+	}
+	whole := p.src[start:p.pos]
+
+	frac := ""
+	if p.accept('.') {
+		from := p.pos
+		if digits() == 0 {
+			return nil, p.unexpected()
+		}
+		frac = p.src[from:p.pos]
+	}
+
+	exp := 0
+	hasExp := false
+	if p.accept('e') || p.accept('E') {
+		hasExp = true
+		from := p.pos
+		if !p.accept('+') {
+			p.accept('-')
+		}
+		if digits() == 0 {
+			return nil, p.unexpected()
+		}
+		n, err := strconv.Atoi(p.src[from:p.pos])
+		if err != nil || n > ops.MaxPlaces || n < -ops.MaxPlaces {
+			return nil, p.errorf(start, "number %s out of range", p.src[start:p.pos])
+		}
+		exp = n
+	}
+
+	value, _ := new(big.Int).SetString(whole+frac, 10)
+	if frac == "" && !hasExp {
+		return ops.Integer(value), nil
+	}
+
+	scale := len(frac) - exp
+	if scale > ops.MaxPlaces {
+		return nil, p.errorf(start, "number %s out of range", p.src[start:p.pos])
+	}
+	if scale < 0 {
+		value.Mul(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-scale)), nil))
+		scale = 0
+	}
+	return &object.Decimal{Value: value, Scale: scale}, nil
+}
+
+// json.stringify(value) returns value as compact JSON text, and
+// json.stringify(value, indent) returns it with each element and member on a
+// line of its own, indented by indent spaces, or by the string indent, for
+// each level it is nested. The keys of objects are sorted, so that equal
+// values always give the same text.
+func jsonStringify(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments to json.stringify: want=1 or 2, got=%d", len(args))
+	}
+
+	e := &jsonEncoder{}
+	if len(args) == 2 {
+		e.pretty = true
+		switch indent := args[1].(type) {
+		case *object.Integer:
+			if indent.Value < 0 || indent.Value > maxIndent {
+				return nil, fmt.Errorf("json.stringify indent must be between 0 and %d, got %d", maxIndent, indent.Value)
+			}
+			e.indent = strings.Repeat(" ", int(indent.Value))
+		case *object.String:
+			if strings.Trim(indent.Value, " \t") != "" || len(indent.Value) > maxIndent {
+				return nil, fmt.Errorf("json.stringify indent must be at most %d spaces and tabs, got %s", maxIndent, indent.Inspect())
+			}
+			e.indent = indent.Value
+		default:
+			return nil, fmt.Errorf("argument 2 to json.stringify must be INTEGER or STRING, got %s", indent.Type())
+		}
+	}
+
+	if err := e.encode(args[0], 0); err != nil {
+		return nil, err
+	}
+	return &object.String{Value: e.out.String()}, nil
+}
+
+// jsonEncoder writes values as JSON text.
+type jsonEncoder struct {
+	out    strings.Builder
+	pretty bool
+	indent string
+}
+
+func (e *jsonEncoder) encode(obj object.Object, depth int) error {
+	if e.out.Len() > ops.MaxStringLen {
+		return fmt.Errorf("json.stringify result is too long")
+	}
+
+	switch obj := obj.(type) {
+	case *object.Null:
+		e.out.WriteString("null")
+	case *object.Boolean:
+		e.out.WriteString(strconv.FormatBool(obj.Value))
+	case *object.Integer, *object.BigInt:
+		e.out.WriteString(obj.Inspect())
+	case *object.Decimal:
+		e.out.WriteString(ast.FormatDecimal(obj.Value, obj.Scale))
+	case *object.String:
+		e.string(obj.Value)
+	case *object.Array:
+		if depth >= maxJSONDepth {
+			return fmt.Errorf("json.stringify value is nested more than %d deep, or contains itself", maxJSONDepth)
+		}
+		if len(obj.Elements) == 0 {
+			e.out.WriteString("[]")
+			return nil
+		}
+
+		e.out.WriteByte('[')
+		for i, el := range obj.Elements {
+			e.separate(i, depth+1)
+			if err := e.encode(el, depth+1); err != nil {
+				return err
+			}
+		}
+		e.newline(depth)
+		e.out.WriteByte(']')
+	case *object.Hash:
+		if depth >= maxJSONDepth {
+			return fmt.Errorf("json.stringify value is nested more than %d deep, or contains itself", maxJSONDepth)
+		}
+		if len(obj.Pairs) == 0 {
+			e.out.WriteString("{}")
+			return nil
+		}
+
+		pairs := obj.Ordered()
+		for _, pair := range pairs {
+			if _, ok := pair.Key.(*object.String); !ok {
+				return fmt.Errorf("json.stringify can't encode a hash key of type %s", pair.Key.Type())
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return pairs[i].Key.(*object.String).Value < pairs[j].Key.(*object.String).Value
+		})
+
+		e.out.WriteByte('{')
+		for i, pair := range pairs {
+			e.separate(i, depth+1)
+			e.string(pair.Key.(*object.String).Value)
+			e.out.WriteByte(':')
+			if e.pretty {
+				e.out.WriteByte(' ')
+			}
+			if err := e.encode(pair.Value, depth+1); err != nil {
+				return err
+			}
+		}
+		e.newline(depth)
+		e.out.WriteByte('}')
+	default:
+		return fmt.Errorf("json.stringify can't encode %s", obj.Type())
+	}
+	return nil
+}
+
+// separate writes what comes before the ith element or member of an array or
+// object at depth.
+func (e *jsonEncoder) separate(i int, depth int) {
+	if i > 0 {
+		e.out.WriteByte(',')
+	}
+	e.newline(depth)
+}
+
+// newline starts a line at depth, if the encoder is pretty-printing.
+func (e *jsonEncoder) newline(depth int) {
+	if e.pretty {
+		e.out.WriteByte('\n')
+		for i := 0; i < depth; i++ {
+			e.out.WriteString(e.indent)
+		}
+	}
+}
+
+// string writes s as a JSON string. Only the characters that JSON requires to
+// be escaped are.
+func (e *jsonEncoder) string(s string) {
+	e.out.WriteByte('"')
+	for _, ch := range s {
+		switch ch {
+		case '"':
+			e.out.WriteString(`\"`)
+		case '\\':
+			e.out.WriteString(`\\`)
+		case '\n':
+			e.out.WriteString(`\n`)
+		case '\r':
+			e.out.WriteString(`\r`)
+		case '\t':
+			e.out.WriteString(`\t`)
+		default:
+			if ch < 0x20 {
+				fmt.Fprintf(&e.out, `\u%04x`, ch)
+			} else {
+				e.out.WriteRune(ch)
+			}
+		}
+	}
+	e.out.WriteByte('"')
+}
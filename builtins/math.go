@@ -0,0 +1,475 @@
+package builtins
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// mathModule is the math module. Its functions take integers, decimals and
+// rationals alike. Those with exact results, like abs, floor and the integer
+// powers of pow, keep them exact. The rest, like sqrt and sin, give decimals
+// rounded to the program's decimal places, the way decimal division does.
+var mathModule = newModule("math",
+	&object.Builtin{Name: "abs", Fn: mathAbs},
+	&object.Builtin{Name: "min", Fn: mathMin},
+	&object.Builtin{Name: "max", Fn: mathMax},
+	&object.Builtin{Name: "floor", Fn: mathFloor},
+	&object.Builtin{Name: "ceil", Fn: mathCeil},
+	&object.Builtin{Name: "round", Fn: mathRound},
+	&object.Builtin{Name: "pow", Fn: mathPow},
+	&object.Builtin{Name: "sqrt", Fn: mathSqrt},
+	&object.Builtin{Name: "exp", Fn: mathExp},
+	&object.Builtin{Name: "log", Fn: mathLog},
+	&object.Builtin{Name: "sin", Fn: mathSin},
+	&object.Builtin{Name: "cos", Fn: mathCos},
+	&object.Builtin{Name: "tan", Fn: mathTan},
+	&object.Builtin{Name: "asin", Fn: mathAsin},
+	&object.Builtin{Name: "acos", Fn: mathAcos},
+	&object.Builtin{Name: "atan", Fn: mathAtan},
+)
+
+// constantPlaces is the number of decimal places in math.pi and math.e.
+const constantPlaces = 20
+
+// maxExp is the largest magnitude of the exponent of e that math.exp, and
+// math.pow with an exponent that isn't an integer, will work out. e^10000 has
+// 4343 digits before the decimal point. Integer exponents are limited by
+// ops.Pow, as they are for **.
+const maxExp = 10000
+
+func init() {
+	prec := precision(constantPlaces, 2)
+	mathModule.Members["pi"] = ops.Round(floatRat(floatPi(prec)), constantPlaces, object.RoundHalfEven)
+	mathModule.Members["e"] = ops.Round(floatRat(floatExp(newFloat(prec).SetInt64(1), prec)), constantPlaces, object.RoundHalfEven)
+}
+
+// math.abs(x) returns the magnitude of x, as the same type as x.
+func mathAbs(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.abs", args)
+	if err != nil {
+		return nil, err
+	}
+	if r.Sign() >= 0 {
+		return args[0], nil
+	}
+	return ops.Prefix(token.MINUS, args[0], arith)
+}
+
+// math.min(x, ...) returns the least of its arguments, or of the elements of
+// its only argument if that is an array. The first of equal values wins.
+func mathMin(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	return extreme("math.min", token.LANGLE, arith, args)
+}
+
+// math.max(x, ...) returns the greatest of its arguments, or of the elements
+// of its only argument if that is an array. The first of equal values wins.
+func mathMax(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	return extreme("math.max", token.RANGLE, arith, args)
+}
+
+// extreme returns the value of args, or of the array that is its only element,
+// that is op every other value.
+func extreme(name string, op token.TokenType, arith object.Arithmetic, args []object.Object) (object.Object, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wrong number of arguments to %s: want at least 1, got=0", name)
+	}
+
+	values := args
+	describe := func(i int) string { return fmt.Sprintf("argument %d to %s", i+1, name) }
+	if array, ok := args[0].(*object.Array); ok && len(args) == 1 {
+		if len(array.Elements) == 0 {
+			return nil, fmt.Errorf("%s of an empty array", name)
+		}
+		values = array.Elements
+		describe = func(i int) string { return fmt.Sprintf("element %d of argument 1 to %s", i, name) }
+	}
+
+	var best object.Object
+	for i, value := range values {
+		switch value.(type) {
+		case *object.Integer, *object.BigInt, *object.Decimal, *object.Rational:
+		default:
+			return nil, fmt.Errorf("%s must be a number, got %s", describe(i), value.Type())
+		}
+
+		if best == nil {
+			best = value
+			continue
+		}
+		better, err := ops.Infix(op, value, best, arith)
+		if err != nil {
+			return nil, err
+		}
+		if ops.IsTruthy(better) {
+			best = value
+		}
+	}
+	return best, nil
+}
+
+// math.floor(x) returns the greatest integer that is at most x.
+func mathFloor(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.floor", args)
+	if err != nil {
+		return nil, err
+	}
+	return ops.Integer(floorRat(r)), nil
+}
+
+// math.ceil(x) returns the least integer that is at least x.
+func mathCeil(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.ceil", args)
+	if err != nil {
+		return nil, err
+	}
+	n := floorRat(new(big.Rat).Neg(r))
+	return ops.Integer(n.Neg(n)), nil
+}
+
+// math.round(x) returns the integer nearest x, with ties broken the way
+// decimal division breaks them.
+func mathRound(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.round", args)
+	if err != nil {
+		return nil, err
+	}
+	return ops.Integer(ops.Round(r, 0, arith.Rounding).Value), nil
+}
+
+// math.pow(x, y) returns x to the power y. An integer y gives what x ** y
+// does, except that a negative y is allowed: it gives a rational for an
+// integer x, and a rounded decimal for a decimal x. Any other y gives a
+// decimal, and x must not be negative unless y is a whole number.
+func mathPow(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if err := checkArgs("math.pow", args, 2); err != nil {
+		return nil, err
+	}
+	x, err := numberArg("math.pow", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	y, err := numberArg("math.pow", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch exp := args[1].(type) {
+	case *object.Integer:
+		if exp.Value >= 0 || args[0].Type() == object.O_RATIONAL {
+			return ops.Infix(token.POWER, args[0], exp, arith)
+		}
+		if x.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		inverse := new(big.Rat).Inv(x)
+		n := big.NewInt(-exp.Value)
+		num, numOK := ops.Pow(inverse.Num(), n)
+		denom, denomOK := ops.Pow(inverse.Denom(), n)
+		if !numOK || !denomOK {
+			return nil, fmt.Errorf("math.pow result out of range: %s, %s", args[0].Inspect(), args[1].Inspect())
+		}
+		power := new(big.Rat).SetFrac(num, denom)
+		if args[0].Type() == object.O_DECIMAL {
+			return ops.Round(power, arith.Places, arith.Rounding), nil
+		}
+		return ops.Rational(power), nil
+	case *object.BigInt:
+		return ops.Infix(token.POWER, args[0], exp, arith)
+	}
+
+	if x.Sign() < 0 && !y.IsInt() {
+		return nil, fmt.Errorf("math.pow of a negative number to a fractional power: %s, %s", args[0].Inspect(), args[1].Inspect())
+	}
+	if x.Sign() == 0 {
+		if y.Sign() < 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		value := int64(0)
+		if y.Sign() == 0 {
+			value = 1
+		}
+		return ops.Round(big.NewRat(value, 1), arith.Places, arith.Rounding), nil
+	}
+
+	// x^y = e^(y ln |x|), negated if x is negative and y is odd. The result
+	// has about y log2 |x| bits before the point, and the error in ln |x| is
+	// multiplied by y.
+	abs := new(big.Rat).Abs(x)
+	yf, _ := y.Float64()
+	bits := yf * log2Rat(abs)
+	if math.Abs(bits) > maxExp*math.Log2E {
+		return nil, fmt.Errorf("math.pow result out of range: %s, %s", args[0].Inspect(), args[1].Inspect())
+	}
+
+	prec := precision(arith.Places, int(bits))
+	work := prec + uint(nonNegative(ratExponent(y))) + uint(bitLen(int64(log2Rat(abs)))) + 16
+	t := floatLog(toFloat(abs, work), work)
+	t.Mul(t, toFloat(y, work))
+	result := floatExp(t, prec)
+	if x.Sign() < 0 && y.Num().Bit(0) == 1 {
+		result.Neg(result)
+	}
+	return roundFloat(result, arith), nil
+}
+
+// math.sqrt(x) returns the square root of x. It is exact when x is an integer
+// or a rational whose root is one, and a decimal otherwise.
+func mathSqrt(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.sqrt", args)
+	if err != nil {
+		return nil, err
+	}
+	if r.Sign() < 0 {
+		return nil, fmt.Errorf("math.sqrt of a negative number: %s", args[0].Inspect())
+	}
+
+	if args[0].Type() != object.O_DECIMAL {
+		num, numExact := exactSqrt(r.Num())
+		denom, denomExact := exactSqrt(r.Denom())
+		if numExact && denomExact {
+			return ops.Rational(new(big.Rat).SetFrac(num, denom)), nil
+		}
+	}
+	if r.Sign() == 0 {
+		return ops.Round(r, arith.Places, arith.Rounding), nil
+	}
+
+	prec := precision(arith.Places, ratExponent(r)/2)
+	x := toFloat(r, prec)
+	return roundFloat(x.Sqrt(x), arith), nil
+}
+
+// math.exp(x) returns e to the power x, as a decimal.
+func mathExp(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.exp", args)
+	if err != nil {
+		return nil, err
+	}
+	if new(big.Rat).Abs(r).Cmp(big.NewRat(maxExp, 1)) > 0 {
+		return nil, fmt.Errorf("math.exp argument out of range: %s", args[0].Inspect())
+	}
+
+	xf, _ := r.Float64()
+	prec := precision(arith.Places, int(xf*math.Log2E))
+	return roundFloat(floatExp(toFloat(r, prec+16), prec), arith), nil
+}
+
+// math.log(x) returns the natural logarithm of x, and math.log(x, b) returns
+// the logarithm of x to the base b, as a decimal.
+func mathLog(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments to math.log: want=1 or 2, got=%d", len(args))
+	}
+	r, err := numberArg("math.log", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if r.Sign() <= 0 {
+		return nil, fmt.Errorf("math.log of a non-positive number: %s", args[0].Inspect())
+	}
+
+	prec := precision(arith.Places, bitLen(int64(ratExponent(r))))
+	if len(args) == 1 {
+		return roundFloat(floatLog(toFloat(r, prec), prec), arith), nil
+	}
+
+	b, err := numberArg("math.log", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	one := big.NewRat(1, 1)
+	if b.Sign() <= 0 || b.Cmp(one) == 0 {
+		return nil, fmt.Errorf("math.log base must be positive and not 1, got %s", args[1].Inspect())
+	}
+
+	// ln b is about b - 1 for a base close to 1, which makes the quotient
+	// large, and needs that many more bits to tell b from 1 at all.
+	if e := ratExponent(new(big.Rat).Sub(b, one)); e < 0 {
+		prec += uint(-2*e) + 2
+	}
+	lnx := floatLog(toFloat(r, prec), prec)
+	return roundFloat(lnx.Quo(lnx, floatLog(toFloat(b, prec), prec)), arith), nil
+}
+
+// math.sin(x) returns the sine of x radians, as a decimal.
+func mathSin(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.sin", args)
+	if err != nil {
+		return nil, err
+	}
+	sin, _ := sinCos(r, precision(arith.Places, 0))
+	return roundFloat(sin, arith), nil
+}
+
+// math.cos(x) returns the cosine of x radians, as a decimal.
+func mathCos(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.cos", args)
+	if err != nil {
+		return nil, err
+	}
+	_, cos := sinCos(r, precision(arith.Places, 0))
+	return roundFloat(cos, arith), nil
+}
+
+// math.tan(x) returns the tangent of x radians, as a decimal.
+func mathTan(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.tan", args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Near an odd multiple of π/2 the cosine is small and the tangent large,
+	// and both need more bits.
+	prec := precision(arith.Places, 0)
+	sin, cos := sinCos(r, prec)
+	if e := cos.MantExp(nil); e < 0 {
+		sin, cos = sinCos(r, prec+uint(-2*e))
+	}
+	if cos.Sign() == 0 {
+		return nil, fmt.Errorf("math.tan result out of range: %s", args[0].Inspect())
+	}
+	return roundFloat(sin.Quo(sin, cos), arith), nil
+}
+
+// math.asin(x) returns the arcsine of x, in radians between -π/2 and π/2, as a
+// decimal.
+func mathAsin(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := inverseTrigArg("math.asin", args)
+	if err != nil {
+		return nil, err
+	}
+	return roundFloat(asin(r, precision(arith.Places, 0)), arith), nil
+}
+
+// math.acos(x) returns the arccosine of x, in radians between 0 and π, as a
+// decimal.
+func mathAcos(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := inverseTrigArg("math.acos", args)
+	if err != nil {
+		return nil, err
+	}
+
+	prec := precision(arith.Places, 2)
+	halfPi := floatPi(prec)
+	halfPi.SetMantExp(halfPi, -1)
+	return roundFloat(halfPi.Sub(halfPi, asin(r, prec)), arith), nil
+}
+
+// math.atan(x) returns the arctangent of x, in radians between -π/2 and π/2,
+// as a decimal.
+func mathAtan(arith object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	r, err := oneNumber("math.atan", args)
+	if err != nil {
+		return nil, err
+	}
+	prec := precision(arith.Places, 0)
+	return roundFloat(floatAtan(toFloat(r, prec), prec), arith), nil
+}
+
+// sinCos returns sin r and cos r. A large r needs as many more bits as it has
+// before the point, so that reducing it by multiples of π/2 leaves enough.
+func sinCos(r *big.Rat, prec uint) (*big.Float, *big.Float) {
+	return floatSinCos(toFloat(r, prec+uint(nonNegative(ratExponent(r)))), prec)
+}
+
+// asin returns asin r, for |r| <= 1, as atan(r / √(1 - r²)). 1 - r² is worked
+// out exactly, so that it keeps its precision when r is close to ±1.
+func asin(r *big.Rat, prec uint) *big.Float {
+	rest := new(big.Rat).Sub(big.NewRat(1, 1), new(big.Rat).Mul(r, r))
+	if rest.Sign() == 0 {
+		halfPi := floatPi(prec)
+		halfPi.SetMantExp(halfPi, -1)
+		if r.Sign() < 0 {
+			halfPi.Neg(halfPi)
+		}
+		return halfPi
+	}
+
+	work := prec + 16
+	root := toFloat(rest, work)
+	root.Sqrt(root)
+	return floatAtan(root.Quo(toFloat(r, work), root), prec)
+}
+
+// inverseTrigArg returns the only argument in args, which must be a number
+// between -1 and 1.
+func inverseTrigArg(name string, args []object.Object) (*big.Rat, error) {
+	r, err := oneNumber(name, args)
+	if err != nil {
+		return nil, err
+	}
+	if new(big.Rat).Abs(r).Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, fmt.Errorf("%s argument must be between -1 and 1, got %s", name, args[0].Inspect())
+	}
+	return r, nil
+}
+
+// oneNumber returns the exact value of the only argument in args, which must
+// be a number.
+func oneNumber(name string, args []object.Object) (*big.Rat, error) {
+	if err := checkArgs(name, args, 1); err != nil {
+		return nil, err
+	}
+	return numberArg(name, args, 0)
+}
+
+// precision returns the bits of precision that a result with about magnitude
+// bits before the point needs to be right to places decimal places.
+func precision(places int, magnitude int) uint {
+	return uint(float64(places)*math.Log2(10)) + uint(nonNegative(magnitude)) + 32
+}
+
+// roundFloat returns f rounded to a decimal, the way decimal division rounds.
+func roundFloat(f *big.Float, arith object.Arithmetic) *object.Decimal {
+	return ops.Round(floatRat(f), arith.Places, arith.Rounding)
+}
+
+func floatRat(f *big.Float) *big.Rat {
+	r, _ := f.Rat(nil)
+	return r
+}
+
+func toFloat(r *big.Rat, prec uint) *big.Float {
+	return newFloat(prec).SetRat(r)
+}
+
+// floorRat returns the greatest integer that is at most r.
+func floorRat(r *big.Rat) *big.Int {
+	// Div rounds towards negative infinity when the divisor is positive, which
+	// a big.Rat's denominator is.
+	return new(big.Int).Div(r.Num(), r.Denom())
+}
+
+// exactSqrt returns the square root of n, and whether it is an integer.
+func exactSqrt(n *big.Int) (*big.Int, bool) {
+	root := new(big.Int).Sqrt(n)
+	return root, new(big.Int).Mul(root, root).Cmp(n) == 0
+}
+
+// ratExponent returns about log2 |r|, to within 1, or 0 for 0.
+func ratExponent(r *big.Rat) int {
+	if r.Sign() == 0 {
+		return 0
+	}
+	return r.Num().BitLen() - r.Denom().BitLen()
+}
+
+// log2Rat returns log2 r, for r > 0, as a float64 that can't overflow.
+func log2Rat(r *big.Rat) float64 {
+	mant := new(big.Float)
+	exp := new(big.Float).SetRat(r).MantExp(mant)
+	m, _ := mant.Float64()
+	return float64(exp) + math.Log2(m)
+}
+
+func nonNegative(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
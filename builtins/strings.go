@@ -0,0 +1,256 @@
+package builtins
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+)
+
+// stringsModule is the strings module. Its functions work on characters, which
+// are Unicode code points, rather than on bytes.
+var stringsModule = newModule("strings",
+	&object.Builtin{Name: "len", Fn: stringsLen},
+	&object.Builtin{Name: "split", Fn: stringsSplit},
+	&object.Builtin{Name: "join", Fn: stringsJoin},
+	&object.Builtin{Name: "trim", Fn: stringsTrim},
+	&object.Builtin{Name: "contains", Fn: stringsContains},
+	&object.Builtin{Name: "replace", Fn: stringsReplace},
+	&object.Builtin{Name: "upper", Fn: stringsUpper},
+	&object.Builtin{Name: "lower", Fn: stringsLower},
+	&object.Builtin{Name: "repeat", Fn: stringsRepeat},
+	&object.Builtin{Name: "format", Fn: stringsFormat},
+)
+
+// strings.len(s) returns the number of characters in s.
+func stringsLen(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("strings.len", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(s[0]))}, nil
+}
+
+// strings.split(s, sep) returns the parts of s between each sep. An empty sep
+// splits s into its characters.
+func stringsSplit(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("strings.split", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return stringArray(strings.Split(s[0], s[1])), nil
+}
+
+// strings.join(parts, sep) returns the strings in the array parts with sep
+// between each of them.
+func stringsJoin(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if err := checkArgs("strings.join", args, 2); err != nil {
+		return nil, err
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, fmt.Errorf("argument 1 to strings.join must be ARRAY, got %s", args[0].Type())
+	}
+	sep, err := stringArg("strings.join", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := []string{}
+	size := 0
+	for i, el := range array.Elements {
+		part, ok := el.(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("element %d of argument 1 to strings.join must be STRING, got %s", i, el.Type())
+		}
+		parts = append(parts, part.Value)
+		size += len(part.Value) + len(sep)
+	}
+	if size > ops.MaxStringLen {
+		return nil, fmt.Errorf("strings.join result is too long")
+	}
+	return &object.String{Value: strings.Join(parts, sep)}, nil
+}
+
+// strings.trim(s) returns s without the whitespace at its start and end.
+func stringsTrim(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("strings.trim", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &object.String{Value: strings.TrimSpace(s[0])}, nil
+}
+
+// strings.contains(s, sub) reports whether sub is in s.
+func stringsContains(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("strings.contains", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return object.NativeBoolToBooleanObject(strings.Contains(s[0], s[1])), nil
+}
+
+// strings.replace(s, old, new) returns s with every old replaced by new. An
+// empty old matches between each character.
+func stringsReplace(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("strings.replace", args, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := strings.Count(s[0], s[1])
+	if len(s[0])+matches*(len(s[2])-len(s[1])) > ops.MaxStringLen {
+		return nil, fmt.Errorf("strings.replace result is too long")
+	}
+	return &object.String{Value: strings.ReplaceAll(s[0], s[1], s[2])}, nil
+}
+
+// strings.upper(s) returns s with each character in upper case.
+func stringsUpper(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("strings.upper", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &object.String{Value: strings.ToUpper(s[0])}, nil
+}
+
+// strings.lower(s) returns s with each character in lower case.
+func stringsLower(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	s, err := stringArgs("strings.lower", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &object.String{Value: strings.ToLower(s[0])}, nil
+}
+
+// strings.repeat(s, n) returns n copies of s, one after the other.
+func stringsRepeat(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if err := checkArgs("strings.repeat", args, 2); err != nil {
+		return nil, err
+	}
+	s, err := stringArg("strings.repeat", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := args[1].(*object.Integer)
+	if !ok {
+		return nil, fmt.Errorf("argument 2 to strings.repeat must be INTEGER, got %s", args[1].Type())
+	}
+
+	if n.Value < 0 {
+		return nil, fmt.Errorf("strings.repeat count must be at least 0, got %d", n.Value)
+	}
+	if len(s) > 0 && n.Value > ops.MaxStringLen/int64(len(s)) {
+		return nil, fmt.Errorf("strings.repeat result is too long")
+	}
+	return &object.String{Value: strings.Repeat(s, int(n.Value))}, nil
+}
+
+// strings.format(template, args...) returns template with each {} replaced by
+// the next of args, and each {n} by the nth of args, counting from 0. Strings
+// are inserted as they are, and other values as they are inspected. {{ and }}
+// stand for { and }. Every argument must be used.
+func stringsFormat(_ object.Arithmetic, _ object.Permissions, args ...object.Object) (object.Object, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wrong number of arguments to strings.format: want at least 1, got=0")
+	}
+	template, err := stringArg("strings.format", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	values := args[1:]
+
+	var out strings.Builder
+	used := make([]bool, len(values))
+	next := 0
+
+	for i := 0; i < len(template); i++ {
+		ch := template[i]
+		switch {
+		case ch == '{' && strings.HasPrefix(template[i:], "{{"):
+			out.WriteByte('{')
+			i++
+		case ch == '}' && strings.HasPrefix(template[i:], "}}"):
+			out.WriteByte('}')
+			i++
+		case ch == '}':
+			return nil, fmt.Errorf("strings.format template has an unmatched } at character %d", utf8.RuneCountInString(template[:i]))
+		case ch == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("strings.format template has an unmatched { at character %d", utf8.RuneCountInString(template[:i]))
+			}
+			field := template[i+1 : i+end]
+
+			index := next
+			if field == "" {
+				next++
+			} else if n, err := strconv.Atoi(field); err == nil && n >= 0 && field[0] != '+' {
+				index = n
+			} else {
+				return nil, fmt.Errorf("strings.format template has a bad field {%s}", field)
+			}
+			if index >= len(values) {
+				return nil, fmt.Errorf("strings.format template refers to argument %d, but only %d were given", index, len(values))
+			}
+
+			used[index] = true
+			if s, ok := values[index].(*object.String); ok {
+				out.WriteString(s.Value)
+			} else {
+				out.WriteString(values[index].Inspect())
+			}
+			if out.Len() > ops.MaxStringLen {
+				return nil, fmt.Errorf("strings.format result is too long")
+			}
+			i += end
+		default:
+			out.WriteByte(ch)
+		}
+	}
+
+	for i, u := range used {
+		if !u {
+			return nil, fmt.Errorf("strings.format template doesn't use argument %d", i)
+		}
+	}
+	return &object.String{Value: out.String()}, nil
+}
+
+// stringArg returns the value of args[i], which must be a String.
+func stringArg(name string, args []object.Object, i int) (string, error) {
+	s, ok := args[i].(*object.String)
+	if !ok {
+		return "", fmt.Errorf("argument %d to %s must be STRING, got %s", i+1, name, args[i].Type())
+	}
+	return s.Value, nil
+}
+
+// stringArgs returns the values of args, of which there must be want, all of
+// them Strings.
+func stringArgs(name string, args []object.Object, want int) ([]string, error) {
+	if err := checkArgs(name, args, want); err != nil {
+		return nil, err
+	}
+
+	strs := []string{}
+	for i := range args {
+		s, err := stringArg(name, args, i)
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+func stringArray(strs []string) *object.Array {
+	elements := []object.Object{}
+	for _, s := range strs {
+		elements = append(elements, &object.String{Value: s})
+	}
+	return &object.Array{Elements: elements}
+}
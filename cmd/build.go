@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/compiler"
+	"github.com/MichaelDiBernardo/monkey/optimizer"
+)
+
+func build() {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	optimize := flags.Bool("optimize", false, "fold constant expressions before compiling the program")
+	outpath := flags.String("o", "", "path to write the compiled program to (default: next to the source)")
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+
+	bfatal := func(msg string) {
+		fatal("build", msg)
+	}
+
+	if len(args) != 1 {
+		bfatal(fmt.Sprintf("expected [filename.monkey], got %q\n", strings.Join(args, " ")))
+	}
+
+	srcpath := args[0]
+	if srcpath == stdinPath && *outpath == "" {
+		bfatal("expected -o to name the output when building from stdin\n")
+	}
+	program := loadProgram(srcpath, bfatal)
+
+	if *optimize {
+		program = optimizer.Optimize(program)
+	}
+
+	bytecode := compileProgram(program, bfatal)
+
+	if *outpath == "" {
+		*outpath = strings.TrimSuffix(srcpath, filepath.Ext(srcpath)) + ".monkeyc"
+	}
+
+	f, err := os.Create(*outpath)
+	if err != nil {
+		bfatal(fmt.Sprintf("could not create %s: %v\n", *outpath, err))
+	}
+	defer f.Close()
+
+	if err := compiler.Encode(f, bytecode); err != nil {
+		bfatal(fmt.Sprintf("could not write %s: %v\n", *outpath, err))
+	}
+}
+
+func disasm() {
+	args := os.Args[2:]
+
+	dfatal := func(msg string) {
+		fatal("disasm", msg)
+	}
+
+	if len(args) != 1 {
+		dfatal(fmt.Sprintf("expected [filename.monkey] or [filename.monkeyc], got %q\n", strings.Join(args, " ")))
+	}
+
+	srcpath := args[0]
+
+	var bytecode *compiler.Bytecode
+	if strings.ToLower(filepath.Ext(srcpath)) == ".monkeyc" {
+		bytecode = loadBytecode(srcpath, dfatal)
+	} else {
+		bytecode = compileProgram(loadProgram(srcpath, dfatal), dfatal)
+	}
+
+	fmt.Print(compiler.Disassemble(bytecode, readSourceLine()))
+}
+
+// loadBytecode reads the precompiled program at path.
+func loadBytecode(path string, fail func(string)) *compiler.Bytecode {
+	abspath := absPath(path, fail)
+
+	f, err := os.Open(abspath)
+	if err != nil {
+		fail(fmt.Sprintf("could not open %s: %v\n", abspath, err))
+	}
+	defer f.Close()
+
+	bytecode, err := compiler.Decode(f)
+	if err != nil {
+		fail(fmt.Sprintf("could not load %s: %v\n", abspath, err))
+	}
+
+	return bytecode
+}
+
+// readSourceLine returns a compiler.SourceFunc that reads source lines from
+// disk, caching each file it reads.
+func readSourceLine() compiler.SourceFunc {
+	files := map[string][]string{}
+
+	return func(path string, line uint) (string, bool) {
+		lines, ok := files[path]
+		if !ok {
+			f, err := os.Open(path)
+			if err == nil {
+				scanner := bufio.NewScanner(f)
+				for scanner.Scan() {
+					lines = append(lines, scanner.Text())
+				}
+				f.Close()
+			}
+			files[path] = lines
+		}
+
+		if line == 0 || int(line) > len(lines) {
+			return "", false
+		}
+		return strings.TrimSpace(lines[line-1]), true
+	}
+}
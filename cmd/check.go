@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/analysis"
+)
+
+func check() {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	disable := flags.String("disable", "", "comma-separated rules to suppress: "+ruleList())
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+
+	cfatal := func(msg string) {
+		fatal("check", msg)
+	}
+
+	if len(args) != 1 {
+		cfatal(fmt.Sprintf("expected [filename.monkey], got %q\n", strings.Join(args, " ")))
+	}
+
+	suppress, err := analysis.ParseRules(*disable)
+	if err != nil {
+		cfatal(fmt.Sprintf("%v\n", err))
+	}
+
+	program := expandProgram(args[0], cfatal)
+	diags := analysis.Check(program, suppress...)
+
+	for _, d := range diags {
+		loc := d.Location
+		fmt.Printf("%s:%d:%d: %s [%s]\n", loc.Path, loc.LineN, loc.CharN, d.Message, d.Rule)
+	}
+
+	if len(diags) > 0 {
+		os.Exit(1)
+	}
+}
+
+func ruleList() string {
+	ids := []string{}
+	for _, r := range analysis.Rules {
+		ids = append(ids, string(r))
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/eval"
+	"github.com/MichaelDiBernardo/monkey/loader"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/resolver"
+)
+
+// evalProgram runs a program given on the command line, for one-liners in
+// shell pipelines.
+func evalProgram() {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	src := flags.String("e", "", "the program to run")
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
+
+	efatal := func(msg string) {
+		fatal("eval", msg)
+	}
+
+	if *src == "" || len(args) != 0 {
+		efatal(fmt.Sprintf("expected -e 'program', got %q\n", strings.Join(os.Args[2:], " ")))
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		efatal(fmt.Sprintf("could not get working directory: %v\n", err))
+	}
+	load := newLoader(cwd, efatal)
+
+	evaled, errs := eval.EvalStringWithImporter(*src, func(program *ast.Program) []error {
+		errs := []error{}
+		for _, lerr := range load.Import(program, cwd) {
+			lerr := lerr
+			errs = append(errs, &lerr)
+		}
+		return errs
+	})
+	if evaled == nil {
+		efatal(stringifyEvalErrors(errs))
+	}
+
+	printResult(evaled, false, efatal)
+}
+
+// stringifyEvalErrors lists errs, which eval.EvalStringWithImporter returned
+// for a program it couldn't run. Like the loader, it stops at the first step
+// that fails, so they are all of the same kind.
+func stringifyEvalErrors(errs []error) string {
+	lerrs := []loader.Error{}
+	for _, err := range errs {
+		switch err := err.(type) {
+		case *parser.ParseError:
+			lerrs = append(lerrs, loader.Error{Kind: "parse", Message: err.Message, Location: err.Location})
+		case *object.Error:
+			lerrs = append(lerrs, loader.Error{Kind: "macro", Message: err.Message, Location: err.Location})
+		case *resolver.ResolveError:
+			lerrs = append(lerrs, loader.Error{Kind: "name", Message: err.Message, Location: err.Location})
+		case *loader.Error:
+			lerrs = append(lerrs, *err)
+		}
+	}
+	return stringifyLoadErrors(lerrs)
+}
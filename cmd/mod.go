@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/loader"
+)
+
+func mod() {
+	args := os.Args[2:]
+
+	mfatal := func(msg string) {
+		fatal("mod", msg)
+	}
+
+	if len(args) != 2 || args[0] != "graph" {
+		mfatal(fmt.Sprintf("expected graph [filename.monkey], got %q\n", strings.Join(args, " ")))
+	}
+
+	srcpath := args[1]
+	if strings.ToLower(filepath.Ext(srcpath)) != ".monkey" {
+		mfatal(fmt.Sprintf("expected [filename.monkey], got %s\n", srcpath))
+	}
+
+	abspath := absPath(srcpath, mfatal)
+	load := newLoader(filepath.Dir(abspath), mfatal)
+	program, errs := load.Load(abspath)
+	if len(errs) > 0 {
+		mfatal(stringifyLoadErrors(errs))
+	}
+
+	// Files are named relative to the project root, or to the program if it
+	// isn't in a project.
+	root := filepath.Dir(abspath)
+	if load.Manifest != nil {
+		root = load.Manifest.Dir()
+	}
+
+	for _, edge := range loader.Graph(abspath, program) {
+		fmt.Printf("%s %s\n", displayPath(root, edge.From), displayPath(root, edge.To))
+	}
+}
+
+// displayPath returns path relative to root, or path itself if it isn't under
+// root.
+func displayPath(root string, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -3,14 +3,26 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/builtins"
+	"github.com/MichaelDiBernardo/monkey/compiler"
 	"github.com/MichaelDiBernardo/monkey/eval"
 	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/loader"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+	"github.com/MichaelDiBernardo/monkey/optimizer"
 	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/resolver"
+	"github.com/MichaelDiBernardo/monkey/token"
+	"github.com/MichaelDiBernardo/monkey/vm"
 )
 
 type command struct {
@@ -20,7 +32,12 @@ type command struct {
 }
 
 var commands = []command{
-	{"run", "[filename.monkey] will run the monkey program in the given file.", run},
+	{"run", "[flags] [filename.monkey(c) | -] [args] will run the monkey program.", run},
+	{"eval", "-e 'program' will run the program given and print its value.", evalProgram},
+	{"build", "[filename.monkey] will compile the program to filename.monkeyc.", build},
+	{"disasm", "[filename.monkey(c)] will print the program's compiled bytecode.", disasm},
+	{"check", "[flags] [filename.monkey] will report likely mistakes in the program.", check},
+	{"mod", "graph [filename.monkey] will print the files the program imports.", mod},
 	{"repl", "will start a monkey read-evaluate-print loop.", repl},
 }
 
@@ -56,48 +73,253 @@ Usage:
 }
 
 func run() {
-	args := os.Args[2:]
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	optimize := flags.Bool("optimize", false, "fold constant expressions before running the program")
+	engine := flags.String("engine", "eval", "engine to run the program with: eval or vm")
+	overflowName := flags.String("overflow", "promote", "what integer arithmetic does when it overflows: promote, error or wrap")
+	places := flags.Int("places", object.DefaultArithmetic.Places, "decimal places that decimal division keeps")
+	roundingName := flags.String("rounding", "half-even", "how decimal division rounds: half-even, half-up, half-down, up, down, ceiling or floor")
+	var readRoots, writeRoots rootsFlag
+	flags.Var(&readRoots, "allow-read", "directory whose files the fs module may read; can be repeated")
+	flags.Var(&writeRoots, "allow-write", "directory whose files the fs module may write; can be repeated")
+	allowEnv := flags.Bool("allow-env", false, "let the env builtin read environment variables")
+	quiet := flags.Bool("quiet", false, "don't print the program's final value")
+	flags.Parse(os.Args[2:])
+	args := flags.Args()
 
 	rfatal := func(msg string) {
 		fatal("run", msg)
 	}
 
-	if len(args) != 1 {
-		rfatal(fmt.Sprintf("expected [filename.monkey], got %q\n", strings.Join(args, " ")))
+	if *engine != "eval" && *engine != "vm" {
+		rfatal(fmt.Sprintf("expected -engine to be eval or vm, got %q\n", *engine))
+	}
+
+	arith := object.DefaultArithmetic
+	var err error
+	if arith.Overflow, err = object.ParseOverflow(*overflowName); err != nil {
+		rfatal(fmt.Sprintf("bad -overflow: %v\n", err))
+	}
+	if arith.Rounding, err = object.ParseRounding(*roundingName); err != nil {
+		rfatal(fmt.Sprintf("bad -rounding: %v\n", err))
+	}
+	if arith.Places = *places; arith.Places < 0 || arith.Places > ops.MaxPlaces {
+		rfatal(fmt.Sprintf("expected -places to be between 0 and %d, got %d\n", ops.MaxPlaces, arith.Places))
+	}
+
+	perms := object.Permissions{Read: readRoots.resolve(rfatal), Write: writeRoots.resolve(rfatal), Env: *allowEnv}
+
+	if len(args) == 0 {
+		rfatal("expected [filename.monkey] or - to read the program from stdin\n")
+	}
+
+	// Everything after the filename is passed to the program, less a -- that
+	// separates them.
+	rest := args[1:]
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+	progArgs := &object.Array{Elements: []object.Object{}}
+	for _, arg := range rest {
+		progArgs.Elements = append(progArgs.Elements, &object.String{Value: arg})
 	}
 
 	srcpath := args[0]
 
-	if strings.ToLower(filepath.Ext(srcpath)) != ".monkey" {
-		rfatal(fmt.Sprintf("expected [filename.monkey], got %s\n", srcpath))
+	// Precompiled programs can only be run by the VM.
+	if strings.ToLower(filepath.Ext(srcpath)) == ".monkeyc" {
+		bytecode := loadBytecode(srcpath, rfatal)
+		printResult(runBytecode(bytecode, arith, perms, progArgs), *quiet, rfatal)
+		return
+	}
+
+	program := loadProgram(srcpath, rfatal)
+
+	if *optimize {
+		program = optimizer.Optimize(program)
+	}
+
+	var evaled object.Object
+	if *engine == "vm" {
+		evaled = runBytecode(compileProgram(program, rfatal), arith, perms, progArgs)
+	} else {
+		env := object.NewEnvironment(program.NumSlots)
+		env.Arithmetic = arith
+		env.Permissions = perms
+		env.Args = progArgs
+		evaled = eval.Eval(program, env)
+	}
+
+	printResult(evaled, *quiet, rfatal)
+}
+
+// loadProgram parses, expands and resolves the monkey program at srcpath,
+// calling fail with a message for the program author if it can't.
+func loadProgram(srcpath string, fail func(string)) *ast.Program {
+	program := expandProgram(srcpath, fail)
+
+	if errs := resolver.New().Resolve(program); len(errs) > 0 {
+		fail(stringifyResolveErrors(errs))
+	}
+
+	return program
+}
+
+// stdinPath is the srcpath that stands for the program on standard input.
+const stdinPath = "-"
+
+// expandProgram parses the monkey program at srcpath, expands its macros and
+// loads the modules it imports, calling fail with a message for the program
+// author if it can't.
+func expandProgram(srcpath string, fail func(string)) *ast.Program {
+	if srcpath == stdinPath {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fail(fmt.Sprintf("could not read the program from stdin: %v\n", err))
+		}
+		return expandSource(token.STDIN_FILEPATH, string(src), fail)
 	}
 
-	abspath, err := filepath.Abs(srcpath)
+	abspath := absPath(srcpath, fail)
+	program, errs := newLoader(filepath.Dir(abspath), fail).Load(abspath)
+	if len(errs) > 0 {
+		fail(stringifyLoadErrors(errs))
+	}
 
+	return program
+}
+
+// expandSource is expandProgram for the program src, which doesn't come from
+// a file and is reported as being at path. As in the REPL, it imports modules
+// relative to the working directory.
+func expandSource(path string, src string, fail func(string)) *ast.Program {
+	cwd, err := os.Getwd()
 	if err != nil {
-		rfatal(fmt.Sprintf("error getting abspath for %s: %v\n", srcpath, err))
+		fail(fmt.Sprintf("could not get working directory: %v\n", err))
 	}
 
-	if _, err := os.Stat(abspath); err != nil {
-		rfatal(fmt.Sprintf("file %s does not exist\n", abspath))
+	program, errs := newLoader(cwd, fail).LoadSource(path, src, cwd)
+	if len(errs) > 0 {
+		fail(stringifyLoadErrors(errs))
 	}
 
-	lex, err := lexer.NewFromPath(abspath)
+	return program
+}
+
+// newLoader returns a loader that searches for imports through the manifest
+// of the project that dir is in, if there is one, and then through the
+// directories in MONKEYPATH.
+func newLoader(dir string, fail func(string)) *loader.Loader {
+	load := loader.New()
+
+	manifest, errs := loader.FindManifest(dir)
+	if len(errs) > 0 {
+		fail(stringifyLoadErrors(errs))
+	}
+	load.Manifest = manifest
+
+	for _, root := range filepath.SplitList(os.Getenv("MONKEYPATH")) {
+		if root == "" {
+			continue
+		}
+		abspath, err := filepath.Abs(root)
+		if err != nil {
+			fail(fmt.Sprintf("bad MONKEYPATH entry %s: %v\n", root, err))
+		}
+		load.Path = append(load.Path, abspath)
+	}
+
+	return load
+}
+
+// expandMacros defines the macros in program and expands the calls to them.
+func expandMacros(program *ast.Program, macros eval.Macros) []*object.Error {
+	if errs := eval.DefineMacros(program, macros); len(errs) > 0 {
+		return errs
+	}
+	return eval.ExpandMacros(program, macros)
+}
+
+// absPath returns the absolute path of the existing file at path.
+func absPath(path string, fail func(string)) string {
+	abspath, err := filepath.Abs(path)
 
 	if err != nil {
-		rfatal(fmt.Sprintf("could not run %s: %v\n", abspath, err))
+		fail(fmt.Sprintf("error getting abspath for %s: %v\n", path, err))
+	}
+
+	if _, err := os.Stat(abspath); err != nil {
+		fail(fmt.Sprintf("file %s does not exist\n", abspath))
+	}
+
+	return abspath
+}
+
+func compileProgram(program *ast.Program, fail func(string)) *compiler.Bytecode {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		if cerr, ok := err.(*compiler.Error); ok {
+			fail(stringifyError("compile error", cerr.Location, cerr.Message))
+		}
+		fail(fmt.Sprintf("%v\n", err))
 	}
+	return comp.Bytecode()
+}
 
-	parse := parser.New(lex)
+// printResult prints the value of a program unless quiet is set, or fails if it
+// is a runtime error. A program that called exit exits with its code.
+func printResult(evaled object.Object, quiet bool, fail func(string)) {
+	if rterr, ok := evaled.(*object.Error); ok {
+		if rterr.Exit != nil {
+			os.Exit(rterr.Exit.Code)
+		}
+		fail(stringifyError("runtime error", rterr.Location, rterr.Message))
+	}
 
-	program := parse.ParseProgram()
+	if !quiet {
+		fmt.Print(evaled.Inspect(), "\n")
+	}
+}
 
-	if parse.HasErrors() {
-		rfatal(stringifyParseErrors(parse))
+// runBytecode runs bytecode on the VM. Runtime errors are returned as the
+// program's value, like the evaluator does.
+func runBytecode(bytecode *compiler.Bytecode, arith object.Arithmetic, perms object.Permissions, args *object.Array) object.Object {
+	machine := vm.New(bytecode)
+	machine.Arithmetic = arith
+	machine.Permissions = perms
+	machine.Args = args
+	if err := machine.Run(); err != nil {
+		return err.(*object.Error)
 	}
 
-	evaled := eval.Eval(program)
-	fmt.Print(evaled.Inspect(), "\n")
+	return machine.LastPoppedStackElem()
+}
+
+// rootsFlag is a flag that can be given more than once, each time naming a
+// directory.
+type rootsFlag []string
+
+func (f *rootsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *rootsFlag) Set(dir string) error {
+	*f = append(*f, dir)
+	return nil
+}
+
+// resolve returns the directories with their symlinks resolved, the way the
+// fs module resolves the paths it is given.
+func (f rootsFlag) resolve(fail func(string)) []string {
+	roots := []string{}
+	for _, dir := range f {
+		root, err := builtins.ResolvePath(dir)
+		if err != nil {
+			fail(fmt.Sprintf("bad directory %s: %v\n", dir, err))
+		}
+		roots = append(roots, root)
+	}
+	return roots
 }
 
 func repl() {
@@ -113,6 +335,17 @@ func repl() {
 
 	const PROMPT = ">> "
 
+	env := object.NewEnvironment(0)
+	res := resolver.New()
+	macros := eval.Macros{}
+
+	// Lines typed into the REPL import modules relative to where it runs.
+	cwd, err := os.Getwd()
+	if err != nil {
+		rfatal(fmt.Sprintf("could not get working directory: %v\n", err))
+	}
+	load := newLoader(cwd, rfatal)
+
 	scanner := bufio.NewScanner(os.Stdin)
 
 	for {
@@ -133,7 +366,25 @@ func repl() {
 			continue
 		}
 
-		evaled := eval.Eval(program)
+		if errs := expandMacros(program, macros); len(errs) > 0 {
+			fmt.Print(stringifyMacroErrors(errs))
+			continue
+		}
+
+		if errs := load.Import(program, cwd); len(errs) > 0 {
+			fmt.Print(stringifyLoadErrors(errs))
+			continue
+		}
+
+		if errs := res.Resolve(program); len(errs) > 0 {
+			fmt.Print(stringifyResolveErrors(errs))
+			continue
+		}
+
+		evaled := eval.Eval(program, env)
+		if rterr, ok := evaled.(*object.Error); ok && rterr.Exit != nil {
+			os.Exit(rterr.Exit.Code)
+		}
 		fmt.Print(evaled.Inspect(), "\n")
 	}
 }
@@ -152,3 +403,39 @@ func stringifyParseErrors(parse *parser.Parser) string {
 	}
 	return out.String()
 }
+
+func stringifyResolveErrors(errs []resolver.ResolveError) string {
+	var out bytes.Buffer
+	out.WriteString("🙈 found name errors\n\n")
+	for i, rerr := range errs {
+		loc := rerr.Location
+		out.WriteString(fmt.Sprintf("[%d] In %s (line %d, col %d): %s\n", i+1, loc.Path, loc.LineN, loc.CharN, rerr.Message))
+	}
+	return out.String()
+}
+
+func stringifyMacroErrors(errs []*object.Error) string {
+	var out bytes.Buffer
+	out.WriteString("🙈 found macro errors\n\n")
+	for i, merr := range errs {
+		loc := merr.Location
+		out.WriteString(fmt.Sprintf("[%d] In %s (line %d, col %d): %s\n", i+1, loc.Path, loc.LineN, loc.CharN, merr.Message))
+	}
+	return out.String()
+}
+
+// stringifyLoadErrors lists errs, which are all of the same kind, since the
+// loader stops at the first step of loading a file that fails.
+func stringifyLoadErrors(errs []loader.Error) string {
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("🙈 found %s errors\n\n", errs[0].Kind))
+	for i, lerr := range errs {
+		loc := lerr.Location
+		out.WriteString(fmt.Sprintf("[%d] In %s (line %d, col %d): %s\n", i+1, loc.Path, loc.LineN, loc.CharN, lerr.Message))
+	}
+	return out.String()
+}
+
+func stringifyError(kind string, loc token.Location, msg string) string {
+	return fmt.Sprintf("🙈 found %s\n\nIn %s (line %d, col %d): %s\n", kind, loc.Path, loc.LineN, loc.CharN, msg)
+}
@@ -0,0 +1,302 @@
+// Package code defines the bytecode instruction set that the compiler emits and
+// the VM executes.
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// Instructions is a flat sequence of encoded bytecode instructions.
+type Instructions []byte
+
+// Opcode is the first byte of every instruction, and determines how many
+// operands follow it.
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpTrue
+	OpFalse
+	OpNull
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpMinus
+	OpBang
+	OpJumpNotTruthy
+	OpJump
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpCurrentClosure
+	OpClosure
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpArray
+	OpIter
+	OpIterNext
+	OpHash
+	OpIndex
+	OpSetIndex
+	OpDup2
+	OpCell
+	OpGetCell
+	OpSetCell
+	OpMod
+	OpPow
+	OpGreaterEqual
+	OpLessEqual
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpBitNot
+	OpGetBuiltin
+	OpImport
+	OpModule
+	OpMember
+)
+
+// Definition describes an opcode for debugging, and the width in bytes of each
+// of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:       {"OpConstant", []int{2}},
+	OpPop:            {"OpPop", []int{}},
+	OpAdd:            {"OpAdd", []int{}},
+	OpSub:            {"OpSub", []int{}},
+	OpMul:            {"OpMul", []int{}},
+	OpDiv:            {"OpDiv", []int{}},
+	OpTrue:           {"OpTrue", []int{}},
+	OpFalse:          {"OpFalse", []int{}},
+	OpNull:           {"OpNull", []int{}},
+	OpEqual:          {"OpEqual", []int{}},
+	OpNotEqual:       {"OpNotEqual", []int{}},
+	OpGreaterThan:    {"OpGreaterThan", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpMinus:          {"OpMinus", []int{}},
+	OpBang:           {"OpBang", []int{}},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
+	OpJump:           {"OpJump", []int{2}},
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpClosure:        {"OpClosure", []int{2, 1}}, // Constant index, number of free variables.
+	OpCall:           {"OpCall", []int{1}},       // Number of arguments.
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+	OpArray:          {"OpArray", []int{2}}, // Number of elements.
+	OpIter:           {"OpIter", []int{}},
+	OpIterNext:       {"OpIterNext", []int{2}}, // Where to jump once the iterator is done.
+	OpHash:           {"OpHash", []int{2}},     // Number of keys and values.
+	OpIndex:          {"OpIndex", []int{}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpDup2:           {"OpDup2", []int{}},  // Pushes copies of the top two elements.
+	OpCell:           {"OpCell", []int{1}}, // Local to move into a new cell.
+	OpGetCell:        {"OpGetCell", []int{}},
+	OpSetCell:        {"OpSetCell", []int{}},
+	OpMod:            {"OpMod", []int{}},
+	OpPow:            {"OpPow", []int{}},
+	OpGreaterEqual:   {"OpGreaterEqual", []int{}},
+	OpLessEqual:      {"OpLessEqual", []int{}},
+	OpBitAnd:         {"OpBitAnd", []int{}},
+	OpBitOr:          {"OpBitOr", []int{}},
+	OpBitXor:         {"OpBitXor", []int{}},
+	OpShiftLeft:      {"OpShiftLeft", []int{}},
+	OpShiftRight:     {"OpShiftRight", []int{}},
+	OpBitNot:         {"OpBitNot", []int{}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}}, // Index of the builtin.
+	OpImport:         {"OpImport", []int{2}},     // Constant index of the module's body.
+	OpModule:         {"OpModule", []int{}},      // Ends a module's body; pops its exports.
+	OpMember:         {"OpMember", []int{2}},     // Index of the member's name.
+}
+
+// Lookup returns the definition for the opcode op.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// MaxOperand returns the largest operand that fits in width bytes.
+func MaxOperand(width int) int {
+	return 1<<(8*uint(width)) - 1
+}
+
+// Make encodes an instruction for op with the given operands. It returns an
+// empty instruction if op is undefined. Operands that don't fit in their
+// width are truncated, so callers have to check them with MaxOperand.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def from
+// ins, and returns them along with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// String renders ins as one instruction per line, each prefixed by its offset.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, operands, width, err := ReadInstruction(ins, i)
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		fmt.Fprintf(&out, "%04d %s\n", i, FormatInstruction(def, operands))
+		i += width
+	}
+
+	return out.String()
+}
+
+// ReadInstruction decodes the instruction that starts at offset in ins. It
+// returns the instruction's definition and operands, along with its width in
+// bytes.
+func ReadInstruction(ins Instructions, offset int) (*Definition, []int, int, error) {
+	def, err := Lookup(ins[offset])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	if offset+width > len(ins) {
+		return nil, nil, 0, fmt.Errorf("%s at %d is truncated", def.Name, offset)
+	}
+
+	operands, _ := ReadOperands(def, ins[offset+1:])
+	return def, operands, width, nil
+}
+
+// FormatInstruction renders an instruction described by def with the given
+// operands, e.g. "OpConstant 2".
+func FormatInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s\n", def.Name)
+}
+
+// LineEntry records that the instructions starting at Offset were compiled
+// from the node at Location.
+type LineEntry struct {
+	Offset   int
+	Location token.Location
+}
+
+// LineTable maps instruction offsets back to source locations. Entries are
+// sorted by offset, and an entry covers every instruction up to the next one.
+type LineTable []LineEntry
+
+// Add records that the instruction at offset came from loc. Nothing is added if
+// the previous entry already covers loc.
+func (lt LineTable) Add(offset int, loc token.Location) LineTable {
+	if n := len(lt); n > 0 {
+		if lt[n-1].Location == loc {
+			return lt
+		}
+		if lt[n-1].Offset == offset {
+			lt[n-1].Location = loc
+			return lt
+		}
+	}
+	return append(lt, LineEntry{Offset: offset, Location: loc})
+}
+
+// Lookup returns the location of the instruction at offset.
+func (lt LineTable) Lookup(offset int) token.Location {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return token.Location{}
+	}
+	return lt[i-1].Location
+}
@@ -0,0 +1,120 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+	}
+
+	for i, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Fatalf("[%d] expected len %d, got %d", i, len(tt.expected), len(instruction))
+		}
+
+		for j, b := range tt.expected {
+			if instruction[j] != b {
+				t.Errorf("[%d] wrong byte at pos %d: expected %d, got %d", i, j, b, instruction[j])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if act := concatted.String(); act != expected {
+		t.Errorf("expected %q, got %q", expected, act)
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for i, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("[%d] definition not found: %q", i, err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("[%d] expected %d bytes read, got %d", i, tt.bytesRead, n)
+		}
+
+		for j, want := range tt.operands {
+			if operandsRead[j] != want {
+				t.Errorf("[%d] operand %d: expected %d, got %d", i, j, want, operandsRead[j])
+			}
+		}
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	loc := func(line uint) token.Location { return token.Location{LineN: line, CharN: 1} }
+
+	var lt LineTable
+	lt = lt.Add(0, loc(1))
+	lt = lt.Add(3, loc(1))
+	lt = lt.Add(4, loc(2))
+	lt = lt.Add(4, loc(3))
+	lt = lt.Add(9, loc(4))
+
+	if exp, act := 3, len(lt); exp != act {
+		t.Fatalf("expected %d entries, got %d: %v", exp, act, lt)
+	}
+
+	tests := []struct {
+		offset int
+		line   uint
+	}{
+		{0, 1}, {3, 1}, {4, 3}, {8, 3}, {9, 4}, {100, 4},
+	}
+
+	for i, tt := range tests {
+		if act := lt.Lookup(tt.offset).LineN; act != tt.line {
+			t.Errorf("[%d] offset %d: expected line %d, got %d", i, tt.offset, tt.line, act)
+		}
+	}
+}
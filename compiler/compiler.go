@@ -0,0 +1,914 @@
+// Package compiler lowers a Monkey AST into bytecode for the VM.
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/builtins"
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// Error is emitted by the compiler when a program can't be compiled. Message
+// should be legible by the program author.
+type Error struct {
+	Message  string
+	Location token.Location
+}
+
+func (e *Error) Error() string {
+	msg := "%s (at line %d, col %d)"
+	return fmt.Sprintf(msg, e.Message, e.Location.LineN, e.Location.CharN)
+}
+
+// Bytecode is a compiled program: the instructions of its top level, and the
+// constant pool that those instructions (and its functions) refer to.
+type Bytecode struct {
+	Instructions code.Instructions
+	Lines        code.LineTable
+	Constants    []object.Object
+	GlobalNames  []string // Name bound to each global slot, for error messages.
+	Names        []string // Member names that OpMember refers to, by index.
+}
+
+// infixOpcodes maps each infix operator to the instruction that implements it.
+var infixOpcodes = map[token.TokenType]code.Opcode{
+	token.PLUS:      code.OpAdd,
+	token.MINUS:     code.OpSub,
+	token.ASTERISK:  code.OpMul,
+	token.RSLASH:    code.OpDiv,
+	token.EQ:        code.OpEqual,
+	token.NEQ:       code.OpNotEqual,
+	token.RANGLE:    code.OpGreaterThan,
+	token.LANGLE:    code.OpLessThan,
+	token.PERCENT:   code.OpMod,
+	token.POWER:     code.OpPow,
+	token.RANGLE_EQ: code.OpGreaterEqual,
+	token.LANGLE_EQ: code.OpLessEqual,
+	token.AMPERSAND: code.OpBitAnd,
+	token.PIPE:      code.OpBitOr,
+	token.CARET:     code.OpBitXor,
+	token.LSHIFT:    code.OpShiftLeft,
+	token.RSHIFT:    code.OpShiftRight,
+}
+
+// prefixOpcodes maps each prefix operator to the instruction that implements
+// it.
+var prefixOpcodes = map[token.TokenType]code.Opcode{
+	token.BANG:  code.OpBang,
+	token.MINUS: code.OpMinus,
+	token.TILDE: code.OpBitNot,
+}
+
+type emittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// compilationScope holds the instructions being emitted for one function body
+// (or for the top level of the program).
+type compilationScope struct {
+	instructions        code.Instructions
+	lines               code.LineTable
+	lastInstruction     emittedInstruction
+	previousInstruction emittedInstruction
+	loops               []*loop // Loops around the code being compiled, innermost last.
+}
+
+// loop tracks the jumps out of a loop that's being compiled.
+type loop struct {
+	continuePos int   // Where continue jumps to.
+	breaks      []int // Positions of the jumps emitted for break, to be patched.
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	globals     *SymbolTable // Table of the program's top level.
+
+	names   []string       // Member names, by index.
+	modules map[string]int // Constant index of each compiled module's body, by path.
+
+	scopes     []compilationScope
+	scopeIndex int
+
+	location token.Location // Location of the node being compiled.
+
+	// err is why the program can't be compiled, if a constant, slot or jump
+	// target has turned out not to fit in an operand. Emitting and patching
+	// instructions doesn't stop for it; Compile returns it.
+	err *Error
+}
+
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, b := range builtins.Builtins {
+		symbolTable.DefineBuiltin(i, builtins.Name(b))
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		globals:     symbolTable,
+		names:       []string{},
+		modules:     map[string]int{},
+		scopes:      []compilationScope{{}},
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	prev := c.location
+	c.location = node.Token().Location
+	defer func() { c.location = prev }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		// Globals are bound up front so that functions can refer to ones that
+		// are bound after them, like the resolver allows.
+		for _, name := range letNames(node) {
+			c.define(name)
+		}
+
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		// A program is worth the value of its final expression statement,
+		// or null if it doesn't end with one.
+		if n := len(node.Statements); n == 0 || !isExpressionStatement(node.Statements[n-1]) {
+			c.emit(code.OpNull)
+			c.emit(code.OpPop)
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		var symbol Symbol
+
+		// Functions are bound before their bodies are compiled so that they
+		// can call themselves; anything else can't see its own name.
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			symbol = c.define(node.Name.Value)
+			if err := c.compileFunction(fn, node.Name.Value); err != nil {
+				return err
+			}
+		} else {
+			if err := c.Compile(node.Value); err != nil {
+				return err
+			}
+			symbol = c.define(node.Name.Value)
+		}
+
+		c.setSymbol(symbol)
+
+	case *ast.ImportStatement:
+		if node.Module == nil {
+			return c.errorf("module %s was not loaded", node.Path)
+		}
+		index, err := c.compileModule(node.Module)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpImport, index)
+		c.setSymbol(c.define(node.Name.Value))
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.WhileStatement:
+		start := len(c.currentInstructions())
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileLoopBody(node.Body, start); err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	case *ast.ForStatement:
+		if err := c.Compile(node.Iterable); err != nil {
+			return err
+		}
+		c.location = node.Iterable.Token().Location
+		c.emit(code.OpIter)
+		c.location = node.ForToken.Location
+
+		// The iterator stays on the stack until the loop ends, and is
+		// popped whether it runs out or the loop breaks.
+		start := c.emit(code.OpIterNext, 9999)
+		c.setSymbol(c.define(node.Variable.Value))
+
+		if err := c.compileLoopBody(node.Body, start); err != nil {
+			return err
+		}
+
+		c.changeOperand(start, len(c.currentInstructions()))
+		c.emit(code.OpPop)
+
+	case *ast.BreakStatement:
+		loops := c.scopes[c.scopeIndex].loops
+		if len(loops) == 0 {
+			return c.errorf("break outside of loop")
+		}
+		l := loops[len(loops)-1]
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loops := c.scopes[c.scopeIndex].loops
+		if len(loops) == 0 {
+			return c.errorf("continue outside of loop")
+		}
+		c.emit(code.OpJump, loops[len(loops)-1].continuePos)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return c.errorf("identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.DecimalLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Decimal{Value: node.Value, Scale: node.Scale}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		if len(node.Elements) > code.MaxOperand(2) {
+			return c.errorf("too many elements in array literal: %d", len(node.Elements))
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		if 2*len(node.Keys) > code.MaxOperand(2) {
+			return c.errorf("too many pairs in hash literal: %d", len(node.Keys))
+		}
+		for i, key := range node.Keys {
+			if err := c.Compile(key); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Values[i]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, 2*len(node.Keys))
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpMember, c.addName(node.Member.Value))
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.RHS); err != nil {
+			return err
+		}
+		op, ok := prefixOpcodes[node.OperatorToken.Type]
+		if !ok {
+			return c.errorf("unknown operator: %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.InfixExpression:
+		if op := node.OperatorToken.Type; op == token.AND || op == token.OR {
+			return c.compileLogical(node)
+		}
+		if err := c.Compile(node.LHS); err != nil {
+			return err
+		}
+		if err := c.Compile(node.RHS); err != nil {
+			return err
+		}
+		op, ok := infixOpcodes[node.OperatorToken.Type]
+		if !ok {
+			return c.errorf("unknown operator: %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// Emit with a bogus offset; it's patched once we know where the
+		// consequence ends.
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBranch(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBranch(node.Alternative); err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+
+	case *ast.MacroLiteral:
+		return c.errorf("macros can only be defined by a let at the top level")
+
+	case *ast.CallExpression:
+		// Macros are expanded before compiling, so quotes only ever
+		// need to be evaluated by the evaluator.
+		if name := node.CalleeName(); name == "quote" || name == "unquote" {
+			return c.errorf("%s is only supported by the eval engine", name)
+		}
+
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		if len(node.Arguments) > 255 {
+			return c.errorf("too many arguments in call: %d", len(node.Arguments))
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	default:
+		return c.errorf("cannot compile node of type %T", node)
+	}
+
+	if c.err != nil {
+		return c.err
+	}
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Constants:    c.constants,
+		GlobalNames:  c.globals.names,
+		Names:        c.names,
+	}
+}
+
+// compileBranch compiles one branch of an if-expression so that it leaves
+// exactly one value on the stack: the value of its last expression statement,
+// or null.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if endsWithExpression(block) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compileLoopBody compiles the body of a loop, followed by a jump back to
+// start, and patches the body's breaks to jump to the end of the loop.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, start int) error {
+	scope := &c.scopes[c.scopeIndex]
+	l := &loop{continuePos: start}
+	scope.loops = append(scope.loops, l)
+
+	if err := c.Compile(body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	end := len(c.currentInstructions())
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, end)
+	}
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	return nil
+}
+
+// compileAssign compiles an assignment so that it leaves the assigned value on
+// the stack. The target's container and index are evaluated before the value,
+// like the evaluator does.
+// compileLogical compiles a short-circuiting && or ||. Its right-hand side is
+// only run if the left-hand side doesn't decide the result, and the result is
+// always a boolean: each side's truthiness jumps to a shared OpTrue or OpFalse.
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	if err := c.Compile(node.LHS); err != nil {
+		return err
+	}
+
+	// Positions of the jumps to patch once we know where false and the end are.
+	toFalse, toEnd := []int{}, []int{}
+
+	if node.OperatorToken.Type == token.OR {
+		toRHS := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		toEnd = append(toEnd, c.emit(code.OpJump, 9999))
+		c.changeOperand(toRHS, len(c.currentInstructions()))
+	} else {
+		toFalse = append(toFalse, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	if err := c.Compile(node.RHS); err != nil {
+		return err
+	}
+	toFalse = append(toFalse, c.emit(code.OpJumpNotTruthy, 9999))
+	c.emit(code.OpTrue)
+	toEnd = append(toEnd, c.emit(code.OpJump, 9999))
+
+	for _, pos := range toFalse {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(code.OpFalse)
+	for _, pos := range toEnd {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	op, compound := ops.Compound[node.OperatorToken.Type]
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		c.location = target.IdentToken.Location
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			return c.errorf("cannot assign to undeclared identifier: %s", target.Value)
+		}
+		if symbol.Scope == BuiltinScope {
+			return c.errorf("cannot assign to builtin: %s", target.Value)
+		}
+		if compound {
+			c.loadSymbol(symbol)
+		}
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		c.location = node.OperatorToken.Location
+		if compound {
+			c.emit(infixOpcodes[op])
+		}
+		c.setSymbol(symbol)
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		if compound {
+			// The container and index are needed again to store the result.
+			c.location = target.LBToken.Location
+			c.emit(code.OpDup2)
+			c.emit(code.OpIndex)
+		}
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		if compound {
+			c.location = node.OperatorToken.Location
+			c.emit(infixOpcodes[op])
+		}
+		c.location = target.LBToken.Location
+		c.emit(code.OpSetIndex)
+
+	default:
+		return c.errorf("cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+// compileFunction compiles fn into a constant and emits the instruction that
+// turns it into a closure at runtime. If name is not empty, fn can refer to
+// itself by it.
+func (c *Compiler) compileFunction(fn *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+	c.symbolTable.cells = cellNames(fn)
+
+	// A function that assigns to its own name has to see the new value, so
+	// it refers to itself through the binding instead.
+	if name != "" && !assignedNames(fn.Body)[name] {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	locals := []string{}
+	for _, p := range fn.Parameters {
+		c.define(p.Value)
+		locals = append(locals, p.Value)
+	}
+
+	// Cells are made before the body runs, so that closures can capture
+	// them before the locals in them are bound.
+	boxed := map[string]bool{}
+	for _, local := range append(locals, letNames(fn.Body)...) {
+		if c.symbolTable.cells[local] && !boxed[local] {
+			c.emit(code.OpCell, c.define(local).Index)
+			boxed[local] = true
+		}
+	}
+
+	if err := c.Compile(fn.Body); err != nil {
+		return err
+	}
+
+	if endsWithExpression(fn.Body) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.names
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSlot(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Lines:         lines,
+		NumLocals:     numLocals,
+		NumParameters: len(fn.Parameters),
+		LocalNames:    localNames,
+	}
+
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+// compileModule compiles the body of mod into a constant, the first time mod
+// is imported, and returns the constant's index. The module's top-level
+// bindings are globals, like the program's, so that its functions can refer
+// to them the same way; but it has a symbol table of its own, so that the
+// program's names and its own don't mix. Its body ends by collecting its
+// exports into the module that OpImport pushes.
+func (c *Compiler) compileModule(mod *ast.Module) (int, error) {
+	if index, ok := c.modules[mod.Path]; ok {
+		return index, nil
+	}
+
+	outer, loc := c.symbolTable, c.location
+	c.symbolTable = NewModuleSymbolTable(c.globals)
+	c.scopes = append(c.scopes, compilationScope{})
+	c.scopeIndex++
+
+	for _, name := range letNames(mod.Program) {
+		c.define(name)
+	}
+	for _, s := range mod.Program.Statements {
+		if err := c.Compile(s); err != nil {
+			return 0, err
+		}
+	}
+
+	exports := []string{}
+	for _, name := range mod.Exports() {
+		symbol, _ := c.symbolTable.Resolve(name.Value)
+		c.location = name.IdentToken.Location
+		c.loadSymbol(symbol)
+		exports = append(exports, name.Value)
+	}
+	c.emit(code.OpModule)
+
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable, c.location = outer, loc
+
+	fn := &object.CompiledFunction{
+		Instructions: instructions,
+		Lines:        lines,
+		Module:       mod.Path,
+		Exports:      exports,
+	}
+	index := c.addConstant(fn)
+	c.modules[mod.Path] = index
+	return index, nil
+}
+
+// letNames returns the names bound by lets and imports in node, leaving out
+// the ones in function literals.
+func letNames(node ast.Node) []string {
+	names := []string{}
+	ast.Walk(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			names = append(names, n.Name.Value)
+		case *ast.ImportStatement:
+			names = append(names, n.Name.Value)
+		case *ast.ForStatement:
+			names = append(names, n.Variable.Value)
+		case *ast.FunctionLiteral:
+			return false
+		}
+		return true
+	}, nil)
+	return names
+}
+
+// assignedNames returns the names that are assigned to anywhere in node,
+// including in function literals.
+func assignedNames(node ast.Node) map[string]bool {
+	names := map[string]bool{}
+	ast.Walk(node, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignExpression); ok {
+			if ident, ok := assign.Target.(*ast.Identifier); ok {
+				names[ident.Value] = true
+			}
+		}
+		return true
+	}, nil)
+	return names
+}
+
+// cellNames returns the names that fn has to keep in cells: the ones that are
+// assigned to somewhere in fn and are used by a closure inside it. Closures
+// capture free variables by value, so otherwise they wouldn't see the
+// assignments made by fn, or fn the ones made by them. Shadowing is ignored,
+// so some names may be kept in cells needlessly.
+func cellNames(fn *ast.FunctionLiteral) map[string]bool {
+	assigned := assignedNames(fn.Body)
+	cells := map[string]bool{}
+
+	ast.Walk(fn.Body, func(n ast.Node) bool {
+		inner, ok := n.(*ast.FunctionLiteral)
+		if !ok {
+			return true
+		}
+		ast.Walk(inner, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Identifier); ok && assigned[ident.Value] {
+				cells[ident.Value] = true
+			}
+			return true
+		}, nil)
+		return false
+	}, nil)
+
+	return cells
+}
+
+// endsWithExpression reports whether the last statement of block is an
+// expression statement, whose value is left on the stack and then popped.
+func endsWithExpression(block *ast.BlockStatement) bool {
+	n := len(block.Statements)
+	return n > 0 && isExpressionStatement(block.Statements[n-1])
+}
+
+func isExpressionStatement(stmt ast.Statement) bool {
+	_, ok := stmt.(*ast.ExpressionStatement)
+	return ok
+}
+
+// setSymbol emits the instructions that pop the top of the stack into the
+// slot of s, or into the cell in it.
+func (c *Compiler) setSymbol(s Symbol) {
+	switch {
+	case s.Cell:
+		c.loadSlot(s)
+		c.emit(code.OpSetCell)
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// loadSymbol emits the instructions that push the value bound to s.
+func (c *Compiler) loadSymbol(s Symbol) {
+	c.loadSlot(s)
+	if s.Cell {
+		c.emit(code.OpGetCell)
+	}
+}
+
+// loadSlot emits the instruction that pushes what the slot of s holds: the
+// value bound to s, or the cell it is stored in.
+func (c *Compiler) loadSlot(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
+
+// addName returns the index of name among the member names, adding it if it
+// isn't one yet.
+func (c *Compiler) addName(name string) int {
+	for i, n := range c.names {
+		if n == name {
+			return i
+		}
+	}
+	c.names = append(c.names, name)
+	return len(c.names) - 1
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	if max := code.MaxOperand(2); len(c.constants) > max+1 {
+		c.fail(c.errorf("too many constants in program: more than %d", max+1))
+	}
+	return len(c.constants) - 1
+}
+
+// define binds name in the current symbol table, and checks that the slot it
+// gets can be addressed by the instructions that get and set it.
+func (c *Compiler) define(name string) Symbol {
+	symbol := c.symbolTable.Define(name)
+	if max := code.MaxOperand(2); symbol.Scope == GlobalScope && symbol.Index > max {
+		c.fail(c.errorf("too many global bindings in program: more than %d", max+1))
+	}
+	if max := code.MaxOperand(1); symbol.Scope == LocalScope && symbol.Index > max {
+		c.fail(c.errorf("too many local bindings in function: more than %d", max+1))
+	}
+	return symbol
+}
+
+// emit appends an instruction to the current scope, and returns its position.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.lines = scope.lines.Add(pos, c.location)
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = emittedInstruction{Opcode: op, Position: pos}
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	pos := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return pos
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	pos := scope.lastInstruction.Position
+
+	scope.instructions = scope.instructions[:pos]
+	for len(scope.lines) > 0 && scope.lines[len(scope.lines)-1].Offset >= pos {
+		scope.lines = scope.lines[:len(scope.lines)-1]
+	}
+	scope.lastInstruction = scope.previousInstruction
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	pos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(pos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	copy(ins[pos:], newInstruction)
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operand)
+	c.replaceInstruction(opPos, code.Make(op, operand))
+}
+
+// checkOperands records an error for the first of operands that doesn't fit
+// in its width in an instruction for op.
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		c.fail(c.errorf("%v", err))
+		return
+	}
+	for i, operand := range operands {
+		if max := code.MaxOperand(def.OperandWidths[i]); operand < 0 || operand > max {
+			c.fail(c.errorf("%s operand out of range: %d is more than %d", def.Name, operand, max))
+			return
+		}
+	}
+}
+
+// fail records err as the reason the program can't be compiled, unless there
+// already is one.
+func (c *Compiler) fail(err *Error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, compilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+func (c *Compiler) errorf(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Location: c.location}
+}
@@ -0,0 +1,638 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/parser"
+)
+
+type compilerTest struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	runCompilerTests(t, []compilerTest{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "~1 << 2 | 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpBitOr),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestConditionals(t *testing.T) {
+	runCompilerTests(t, []compilerTest{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { let a = 10; } else { 20 }",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 17),
+				// 0014
+				code.Make(code.OpConstant, 1),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestLogicalOperators(t *testing.T) {
+	runCompilerTests(t, []compilerTest{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
+				code.Make(code.OpFalse),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpTrue),
+				// 0005
+				code.Make(code.OpJump, 17),
+				// 0008
+				code.Make(code.OpFalse),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0012
+				code.Make(code.OpTrue),
+				// 0013
+				code.Make(code.OpJump, 17),
+				// 0016
+				code.Make(code.OpFalse),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestLetStatements(t *testing.T) {
+	runCompilerTests(t, []compilerTest{
+		{
+			input:             "let one = 1; one;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let one = 1;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	runCompilerTests(t, []compilerTest{
+		{
+			input: "fn(a) { let b = 1; a + b }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let f = fn() { f() }; f(1, 2)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestLoops(t *testing.T) {
+	runCompilerTests(t, []compilerTest{
+		{
+			input:             "while (true) { break; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpJump, 10),
+				// 0007
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (x in [1]) { continue; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpIterNext, 19),
+				// 0010
+				code.Make(code.OpSetGlobal, 0),
+				// 0013
+				code.Make(code.OpJump, 7),
+				// 0016
+				code.Make(code.OpJump, 7),
+				// 0019
+				code.Make(code.OpPop),
+				// 0020
+				code.Make(code.OpNull),
+				// 0021
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestAssignments(t *testing.T) {
+	runCompilerTests(t, []compilerTest{
+		{
+			input:             "let x = 1; x += 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let h = {1: 2}; h[1] -= 3",
+			expectedConstants: []interface{}{1, 2, 1, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSub),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { let b = 1; fn() { a = b } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpSetCell),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetCell),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCell, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpClosure, 1, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestDecimalsAndBuiltins(t *testing.T) {
+	runCompilerTests(t, []compilerTest{
+		{
+			input:             "12.50d * 2",
+			expectedConstants: []interface{}{decimal("12.50d"), 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { rational(1, 3) }",
+			expectedConstants: []interface{}{
+				1,
+				3,
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpCall, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let decimal = 1; decimal",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestImports(t *testing.T) {
+	program := parse(t, `import "lib.monkey" as lib; lib.two`)
+	program.Statements[0].(*ast.ImportStatement).Module = &ast.Module{
+		Path:    "/src/lib.monkey",
+		Program: parse(t, "let two = 2;"),
+	}
+
+	comp := New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	// Module globals share the main program's global slots, after its own.
+	testInstructions(t, 0, []code.Instructions{
+		code.Make(code.OpImport, 1),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpMember, 0),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	testConstants(t, 0, []interface{}{2, []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpModule),
+	}}, bytecode.Constants)
+
+	mod := bytecode.Constants[1].(*object.CompiledFunction)
+	if mod.Module != "/src/lib.monkey" || len(mod.Exports) != 1 || mod.Exports[0] != "two" {
+		t.Errorf("expected module /src/lib.monkey exporting two, got %q exporting %v", mod.Module, mod.Exports)
+	}
+	if len(bytecode.Names) != 1 || bytecode.Names[0] != "two" {
+		t.Errorf("expected member names [two], got %v", bytecode.Names)
+	}
+
+	err := New().Compile(parse(t, `import "lib.monkey" as lib;`))
+	if cerr, ok := err.(*Error); !ok || cerr.Message != "module lib.monkey was not loaded" {
+		t.Errorf("expected unloaded module error, got %v", err)
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"x", "identifier not found: x", 1, 1},
+		{"let a = 1;\nlet b = fn() { a + c };", "identifier not found: c", 2, 20},
+		{"let f = fn() { let a = a; };", "identifier not found: a", 1, 24},
+		{"let x = 1;\n  quote(x)", "quote is only supported by the eval engine", 2, 8},
+		{"let m = fn() { macro(x) { x } };", "macros can only be defined by a let at the top level", 1, 16},
+		{"let a = 1;\n  b = a;", "cannot assign to undeclared identifier: b", 2, 3},
+		{"fn() { decimal = 1 }", "cannot assign to builtin: decimal", 1, 8},
+	}
+
+	for i, tt := range tests {
+		err := New().Compile(parse(t, tt.input))
+
+		cerr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("[%d] expected *Error, got %T (%v)", i, err, err)
+			continue
+		}
+
+		if cerr.Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, cerr.Message)
+		}
+
+		if loc := cerr.Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	// repeat returns n copies of format, each formatted with a name of
+	// letters that is different for each copy.
+	repeat := func(n int, format string) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			name := ""
+			for j := i; j > 0 || name == ""; j /= 26 {
+				name = string(rune('a'+j%26)) + name
+			}
+			fmt.Fprintf(&b, format, name)
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{"let s = 0;" + repeat(70000, "s = s + 1;%.0s"), "too many constants in program: more than 65536"},
+		{repeat(65537, "let x%s = true;"), "too many global bindings in program: more than 65536"},
+		{"fn() {" + repeat(257, "let x%s = true;") + "}", "too many local bindings in function: more than 256"},
+		{"if (true) {" + repeat(33000, "true; %.0s") + "}", "OpJumpNotTruthy operand out of range: 66006 is more than 65535"},
+		{"while (true) { break; " + repeat(33000, "true; %.0s") + "}", "OpJump operand out of range: 66010 is more than 65535"},
+		{"[" + repeat(65536, "true, %.0s") + "true]", "too many elements in array literal: 65537"},
+	}
+
+	for i, tt := range tests {
+		err := New().Compile(parse(t, tt.input))
+		if cerr, ok := err.(*Error); !ok || cerr.Message != tt.message {
+			t.Errorf("[%d] expected error %q, got %v", i, tt.message, err)
+		}
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse(t, "1;\n2 +\n3")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	tests := []struct {
+		offset int
+		line   uint
+	}{
+		{0, 1},  // OpConstant 0
+		{3, 1},  // OpPop
+		{4, 2},  // OpConstant 1
+		{7, 3},  // OpConstant 2
+		{10, 2}, // OpAdd
+	}
+
+	for i, tt := range tests {
+		if act := bytecode.Lines.Lookup(tt.offset).LineN; act != tt.line {
+			t.Errorf("[%d] offset %d: expected line %d, got %d", i, tt.offset, tt.line, act)
+		}
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTest) {
+	t.Helper()
+
+	for i, tt := range tests {
+		comp := New()
+		if err := comp.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("[%d] compiler error: %s", i, err)
+		}
+
+		bytecode := comp.Bytecode()
+		testInstructions(t, i, tt.expectedInstructions, bytecode.Instructions)
+		testConstants(t, i, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func testInstructions(t *testing.T, i int, expected []code.Instructions, actual code.Instructions) {
+	t.Helper()
+
+	concatted := concatInstructions(expected)
+
+	if concatted.String() != actual.String() {
+		t.Errorf("[%d] wrong instructions.\nexpected:\n%s\ngot:\n%s", i, concatted, actual)
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+// decimal is an expected Decimal constant, written as it is inspected.
+type decimal string
+
+func testConstants(t *testing.T, i int, expected []interface{}, actual []object.Object) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Fatalf("[%d] expected %d constants, got %d", i, len(expected), len(actual))
+	}
+
+	for j, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[j].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("[%d] constant %d: expected %d, got %s", i, j, constant, actual[j].Inspect())
+			}
+		case decimal:
+			dec, ok := actual[j].(*object.Decimal)
+			if !ok || dec.Inspect() != string(constant) {
+				t.Errorf("[%d] constant %d: expected %s, got %s", i, j, constant, actual[j].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[j].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("[%d] constant %d: expected *object.CompiledFunction, got %T", i, j, actual[j])
+				continue
+			}
+			testInstructions(t, i, constant, fn.Instructions)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
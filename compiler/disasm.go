@@ -0,0 +1,101 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// SourceFunc returns the text of the given 1-indexed line of the file at path,
+// or false if it isn't available.
+type SourceFunc func(path string, line uint) (string, bool)
+
+// Disassemble renders bytecode as a human-readable listing: the program's
+// top-level instructions, followed by those of every function in its constant
+// pool. If source is not nil, each source line is printed above the
+// instructions that were compiled from it.
+func Disassemble(bytecode *Bytecode, source SourceFunc) string {
+	var out bytes.Buffer
+
+	out.WriteString("== main ==\n")
+	disassembleBody(&out, bytecode.Instructions, bytecode.Lines, bytecode, source)
+
+	for i, c := range bytecode.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if fn.Module != "" {
+			fmt.Fprintf(&out, "\n== constant %d: module %s ==\n", i, fn.Module)
+		} else {
+			fmt.Fprintf(&out, "\n== constant %d: function (%d params, %d locals) ==\n", i, fn.NumParameters, fn.NumLocals)
+		}
+		disassembleBody(&out, fn.Instructions, fn.Lines, bytecode, source)
+	}
+
+	return out.String()
+}
+
+func disassembleBody(out *bytes.Buffer, ins code.Instructions, lines code.LineTable, bytecode *Bytecode, source SourceFunc) {
+	var lastLoc token.Location
+
+	for i := 0; i < len(ins); {
+		def, operands, width, err := code.ReadInstruction(ins, i)
+		if err != nil {
+			fmt.Fprintf(out, "%04d ERROR: %s\n", i, err)
+			return
+		}
+
+		loc := lines.Lookup(i)
+		if source != nil && (loc.Path != lastLoc.Path || loc.LineN != lastLoc.LineN) && loc.LineN > 0 {
+			if loc.Path != lastLoc.Path {
+				fmt.Fprintf(out, "; %s\n", loc.Path)
+			}
+			if text, ok := source(loc.Path, loc.LineN); ok {
+				fmt.Fprintf(out, "; %4d | %s\n", loc.LineN, text)
+			}
+			lastLoc = loc
+		}
+
+		listing := code.FormatInstruction(def, operands)
+		if comment := describeOperand(code.Opcode(ins[i]), operands, bytecode); comment != "" {
+			fmt.Fprintf(out, "%04d %-24s ; %s\n", i, listing, comment)
+		} else {
+			fmt.Fprintf(out, "%04d %s\n", i, listing)
+		}
+
+		i += width
+	}
+}
+
+// describeOperand explains what an instruction's operand refers to, for
+// instructions that refer to the constant pool or to a member name.
+func describeOperand(op code.Opcode, operands []int, bytecode *Bytecode) string {
+	if op == code.OpMember {
+		if operands[0] >= len(bytecode.Names) {
+			return "<name out of range>"
+		}
+		return bytecode.Names[operands[0]]
+	}
+
+	if op != code.OpConstant && op != code.OpClosure && op != code.OpImport {
+		return ""
+	}
+
+	if operands[0] >= len(bytecode.Constants) {
+		return "<constant out of range>"
+	}
+
+	switch c := bytecode.Constants[operands[0]].(type) {
+	case *object.CompiledFunction:
+		if c.Module != "" {
+			return fmt.Sprintf("module %d", operands[0])
+		}
+		return fmt.Sprintf("function %d", operands[0])
+	default:
+		return c.Inspect()
+	}
+}
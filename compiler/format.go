@@ -0,0 +1,375 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// A precompiled .monkeyc file is laid out as follows. All integers are
+// big-endian.
+//
+//	magic       8 bytes, "MONKEYC\x00"
+//	version     uint16, FormatVersion
+//	paths       uint32 count, then that many strings
+//	globals     uint32 count, then that many strings: the global slot names
+//	names       uint32 count, then that many strings: the member names
+//	constants   uint32 count, then that many constants
+//	main        a function body: the program's top-level instructions
+//
+// A string is a uint32 length followed by that many bytes. A constant is a
+// one-byte tag followed by its payload:
+//
+//	constInteger   int64
+//	constBigInt    a string: the integer in decimal
+//	constDecimal   uint32 scale, then a string: the unscaled value in decimal
+//	constFunction  uint32 locals, uint32 parameters, uint32 count of local slot
+//	               names and that many strings, then a function body
+//	constModule    a string: the module's path, then a uint32 count of exports
+//	               and that many strings, then a function body
+//	constString    a string
+//
+// A function body is a uint32 length followed by that many bytes of
+// instructions, followed by its line table: a uint32 count of entries, each of
+// which is a uint32 offset, a uint32 index into paths, a uint32 line and a
+// uint32 column.
+
+// FormatMagic starts every precompiled Monkey file.
+const FormatMagic = "MONKEYC\x00"
+
+// FormatVersion is bumped whenever the layout of precompiled files changes.
+// Files with any other version are rejected.
+const FormatVersion uint16 = 6
+
+const (
+	constInteger  byte = 1
+	constFunction byte = 2
+	constBigInt   byte = 3
+	constDecimal  byte = 4
+	constModule   byte = 5
+	constString   byte = 6
+)
+
+// ErrBadMagic is returned by Decode when its input isn't a precompiled Monkey
+// file.
+var ErrBadMagic = errors.New("not a precompiled monkey file")
+
+// Encode writes bytecode to w in the precompiled file format.
+func Encode(w io.Writer, bytecode *Bytecode) error {
+	paths, pathIndexes := collectPaths(bytecode)
+
+	enc := &encoder{w: bufio.NewWriter(w)}
+	enc.bytes([]byte(FormatMagic))
+	enc.uint16(FormatVersion)
+
+	enc.uint32(len(paths))
+	for _, p := range paths {
+		enc.string(p)
+	}
+
+	enc.strings(bytecode.GlobalNames)
+	enc.strings(bytecode.Names)
+
+	enc.uint32(len(bytecode.Constants))
+	for _, c := range bytecode.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			enc.byte(constInteger)
+			enc.int64(c.Value)
+		case *object.BigInt:
+			enc.byte(constBigInt)
+			enc.string(c.Value.String())
+		case *object.Decimal:
+			enc.byte(constDecimal)
+			enc.uint32(c.Scale)
+			enc.string(c.Value.String())
+		case *object.String:
+			enc.byte(constString)
+			enc.string(c.Value)
+		case *object.CompiledFunction:
+			if c.Module != "" {
+				enc.byte(constModule)
+				enc.string(c.Module)
+				enc.strings(c.Exports)
+				enc.body(c.Instructions, c.Lines, pathIndexes)
+				continue
+			}
+			enc.byte(constFunction)
+			enc.uint32(c.NumLocals)
+			enc.uint32(c.NumParameters)
+			enc.strings(c.LocalNames)
+			enc.body(c.Instructions, c.Lines, pathIndexes)
+		default:
+			return fmt.Errorf("cannot encode constant of type %s", c.Type())
+		}
+	}
+
+	enc.body(bytecode.Instructions, bytecode.Lines, pathIndexes)
+
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+// Decode reads bytecode in the precompiled file format from r.
+func Decode(r io.Reader) (*Bytecode, error) {
+	dec := &decoder{r: bufio.NewReader(r)}
+
+	magic := dec.bytes(len(FormatMagic))
+	if dec.err == nil && !bytes.Equal(magic, []byte(FormatMagic)) {
+		return nil, ErrBadMagic
+	}
+
+	if version := dec.uint16(); dec.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("unsupported precompiled file version %d, expected %d", version, FormatVersion)
+	}
+
+	paths := dec.strings()
+
+	bytecode := &Bytecode{GlobalNames: dec.strings(), Names: dec.strings()}
+	nconsts := dec.length()
+	for i := 0; i < nconsts && dec.err == nil; i++ {
+		switch tag := dec.byte(); tag {
+		case constInteger:
+			bytecode.Constants = append(bytecode.Constants, &object.Integer{Value: dec.int64()})
+		case constBigInt:
+			text := dec.string()
+			value, ok := new(big.Int).SetString(text, 10)
+			if !ok && dec.err == nil {
+				dec.err = fmt.Errorf("bad big integer constant %q", text)
+			}
+			bytecode.Constants = append(bytecode.Constants, &object.BigInt{Value: value})
+		case constDecimal:
+			scale := dec.uint32()
+			text := dec.string()
+			value, ok := new(big.Int).SetString(text, 10)
+			if !ok && dec.err == nil {
+				dec.err = fmt.Errorf("bad decimal constant %q", text)
+			}
+			bytecode.Constants = append(bytecode.Constants, &object.Decimal{Value: value, Scale: scale})
+		case constString:
+			bytecode.Constants = append(bytecode.Constants, &object.String{Value: dec.string()})
+		case constFunction:
+			fn := &object.CompiledFunction{NumLocals: dec.uint32(), NumParameters: dec.uint32()}
+			fn.LocalNames = dec.strings()
+			fn.Instructions, fn.Lines = dec.body(paths)
+			bytecode.Constants = append(bytecode.Constants, fn)
+		case constModule:
+			fn := &object.CompiledFunction{Module: dec.string(), Exports: dec.strings()}
+			fn.Instructions, fn.Lines = dec.body(paths)
+			bytecode.Constants = append(bytecode.Constants, fn)
+		default:
+			if dec.err == nil {
+				dec.err = fmt.Errorf("unknown constant tag %d", tag)
+			}
+		}
+	}
+
+	bytecode.Instructions, bytecode.Lines = dec.body(paths)
+
+	if dec.err == io.EOF || dec.err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("precompiled file is truncated")
+	}
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if err := verify(bytecode); err != nil {
+		return nil, err
+	}
+	return bytecode, nil
+}
+
+// collectPaths returns every source path mentioned by the line tables in
+// bytecode, along with each path's index in that list.
+func collectPaths(bytecode *Bytecode) ([]string, map[string]int) {
+	paths := []string{}
+	indexes := map[string]int{}
+
+	add := func(lines code.LineTable) {
+		for _, entry := range lines {
+			if _, ok := indexes[entry.Location.Path]; !ok {
+				indexes[entry.Location.Path] = len(paths)
+				paths = append(paths, entry.Location.Path)
+			}
+		}
+	}
+
+	add(bytecode.Lines)
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			add(fn.Lines)
+		}
+	}
+
+	return paths, indexes
+}
+
+// encoder writes the primitives of the file format. Once a write fails, every
+// later write is a no-op and err holds the failure.
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) byte(b byte) {
+	e.bytes([]byte{b})
+}
+
+func (e *encoder) uint16(n uint16) {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, n)
+	e.bytes(b)
+}
+
+func (e *encoder) uint32(n int) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(n))
+	e.bytes(b)
+}
+
+func (e *encoder) int64(n int64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	e.bytes(b)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(len(s))
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uint32(len(ss))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) body(ins code.Instructions, lines code.LineTable, pathIndexes map[string]int) {
+	e.uint32(len(ins))
+	e.bytes(ins)
+
+	e.uint32(len(lines))
+	for _, entry := range lines {
+		e.uint32(entry.Offset)
+		e.uint32(pathIndexes[entry.Location.Path])
+		e.uint32(int(entry.Location.LineN))
+		e.uint32(int(entry.Location.CharN))
+	}
+}
+
+// decoder reads the primitives of the file format. Once a read fails, every
+// later read returns a zero value and err holds the failure.
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+// maxLength bounds the lengths and counts the decoder trusts, so that a
+// corrupt file can't make it allocate unbounded memory.
+const maxLength = 1 << 28
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	// The bytes are copied as they are read, rather than into a buffer of
+	// n bytes, so that a corrupt length can't allocate more than the file
+	// holds.
+	var b bytes.Buffer
+	if _, d.err = io.CopyN(&b, d.r, int64(n)); d.err != nil {
+		return nil
+	}
+	return b.Bytes()
+}
+
+func (d *decoder) byte() byte {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() int {
+	if b := d.bytes(4); b != nil {
+		return int(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.bytes(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// length reads a uint32 length or count prefix.
+func (d *decoder) length() int {
+	n := d.uint32()
+	if d.err == nil && n > maxLength {
+		d.err = fmt.Errorf("length %d is too large", n)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.length()))
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+	ss := []string{}
+	for i := 0; i < n && d.err == nil; i++ {
+		ss = append(ss, d.string())
+	}
+	return ss
+}
+
+func (d *decoder) body(paths []string) (code.Instructions, code.LineTable) {
+	ins := code.Instructions(d.bytes(d.length()))
+
+	lines := code.LineTable{}
+	nlines := d.length()
+	for i := 0; i < nlines && d.err == nil; i++ {
+		entry := code.LineEntry{Offset: d.uint32()}
+
+		pathIndex := d.uint32()
+		if d.err == nil && pathIndex >= len(paths) {
+			d.err = fmt.Errorf("path index %d out of range", pathIndex)
+			break
+		}
+
+		entry.Location = token.Location{LineN: uint(d.uint32()), CharN: uint(d.uint32())}
+		if d.err == nil {
+			entry.Location.Path = paths[pathIndex]
+		}
+		lines = append(lines, entry)
+	}
+
+	return ins, lines
+}
@@ -0,0 +1,166 @@
+package compiler
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/object"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+let newAdder = fn(x) { fn(y) { add(x, y) } };
+let price = decimal(12.50d / 3, 2) + rational(1, 3);
+import "lib.monkey" as lib;
+let greeting = "héllo, \"wörld\"\n" + "";
+newAdder(lib.two)(3) * 9223372036854775807 + 123456789012345678901234567890`
+
+	program := parse(t, input)
+	program.Statements[3].(*ast.ImportStatement).Module = &ast.Module{
+		Path:    "/src/lib.monkey",
+		Program: parse(t, "let two = 2; let half = fn(x) { x / two };"),
+	}
+
+	comp := New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, bytecode); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	if !bytes.HasPrefix(buf.Bytes(), []byte(FormatMagic)) {
+		t.Errorf("encoded file doesn't start with magic header")
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if !reflect.DeepEqual(bytecode, decoded) {
+		t.Errorf("decoded bytecode differs.\nexpected: %s\ngot: %s", Disassemble(bytecode, nil), Disassemble(decoded, nil))
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse(t, "let f = fn(x) { x }; f(1)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, comp.Bytecode()); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	good := buf.Bytes()
+
+	badVersion := append([]byte{}, good...)
+	badVersion[len(FormatMagic)+1]++
+
+	// A file that claims to hold far more paths than it does.
+	manyPaths := append([]byte(FormatMagic), 0, byte(FormatVersion), 0x0f, 0xff, 0xff, 0xff, 0, 0, 0, 1)
+
+	encode := func(bytecode *Bytecode) []byte {
+		var buf bytes.Buffer
+		if err := Encode(&buf, bytecode); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		return buf.Bytes()
+	}
+	withMain := func(ins ...code.Instructions) []byte {
+		bytecode := comp.Bytecode()
+		bytecode.Instructions = concatInstructions(ins)
+		bytecode.Lines = nil
+		return encode(bytecode)
+	}
+	withFunction := func(fn *object.CompiledFunction) []byte {
+		return encode(&Bytecode{
+			Instructions: concatInstructions([]code.Instructions{code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)}),
+			Constants:    []object.Object{fn},
+		})
+	}
+
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("#!/bin/sh\necho hi\n"), "not a precompiled monkey file"},
+		{badVersion, "unsupported precompiled file version 7"},
+		{good[:len(good)-3], "truncated"},
+		{good[:len(FormatMagic)+4], "truncated"},
+		{manyPaths, "truncated"},
+		{withMain(code.Instructions{255}), "bad instruction at offset 0 of main: opcode 255 undefined"},
+		{withMain(code.Make(code.OpConstant, 0)[:2]), "bad instruction at offset 0 of main"},
+		{withMain(code.Make(code.OpConstant, 9), code.Make(code.OpPop)), "OpConstant refers to constant 9 of 2"},
+		{withMain(code.Make(code.OpClosure, 1, 0), code.Make(code.OpPop)), "OpClosure refers to constant 1, which isn't a function"},
+		{withMain(code.Make(code.OpGetBuiltin, 200), code.Make(code.OpPop)), "OpGetBuiltin refers to builtin 200"},
+		{withMain(code.Make(code.OpJump, 100)), "OpJump jumps to 100, which doesn't start an instruction"},
+		{withMain(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 2)), "OpJumpNotTruthy jumps to 2"},
+		{withMain(code.Make(code.OpTrue), code.Make(code.OpAdd)), "OpAdd needs 2 values on the stack, but there may be only 1"},
+		{withMain(code.Make(code.OpPop)), "OpPop needs 1 values on the stack, but there may be only 0"},
+		{withMain(code.Make(code.OpReturn)), "OpReturn is outside of a function"},
+		{withFunction(&object.CompiledFunction{Instructions: code.Make(code.OpGetLocal, 1), NumLocals: 1}), "OpGetLocal refers to local 1 of 1"},
+		{withFunction(&object.CompiledFunction{Instructions: code.Make(code.OpNull)}), "bad constant 0: it runs past the end of its instructions"},
+		{withFunction(&object.CompiledFunction{Instructions: code.Make(code.OpReturn), NumParameters: 2}), "bad constant 0: 2 parameters and 0 locals"},
+	}
+
+	for i, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("[%d] expected error", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("[%d] expected error containing %q, got %q", i, tt.expected, err)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	input := "let one = 1;\nlet f = fn(x) {\n  x + one\n};\nf(2)"
+	source := strings.Split(input, "\n")
+
+	comp := New()
+	if err := comp.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	listing := Disassemble(comp.Bytecode(), func(path string, line uint) (string, bool) {
+		return source[line-1], true
+	})
+
+	expected := `== main ==
+; <input>
+;    1 | let one = 1;
+0000 OpConstant 0             ; 1
+0003 OpSetGlobal 0
+;    2 | let f = fn(x) {
+0006 OpClosure 1 0            ; function 1
+0010 OpSetGlobal 1
+;    5 | f(2)
+0013 OpGetGlobal 1
+0016 OpConstant 2             ; 2
+0019 OpCall 1
+0021 OpPop
+
+== constant 1: function (1 params, 1 locals) ==
+; <input>
+;    3 |   x + one
+0000 OpGetLocal 0
+0002 OpGetGlobal 0
+0005 OpAdd
+0006 OpReturnValue
+`
+
+	if listing != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, listing)
+	}
+}
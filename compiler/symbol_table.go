@@ -0,0 +1,131 @@
+package compiler
+
+// SymbolScope says where the value bound to a symbol lives at runtime.
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+	BuiltinScope  SymbolScope = "BUILTIN"
+)
+
+// Symbol is a name bound in Monkey source, along with the slot its value is
+// stored in.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Cell  bool // Whether the slot holds a cell that the value is stored in.
+}
+
+// SymbolTable tracks the names bound in one function (or the top level of the
+// program). Names it can't resolve are looked up in Outer.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	names          []string // Name bound to each slot, by index.
+
+	// FreeSymbols are the symbols from enclosing functions that this
+	// function's closure has to capture, in capture order.
+	FreeSymbols []Symbol
+
+	// cells are the names whose locals are stored in cells.
+	cells map[string]bool
+
+	// main is the table of the program's top level, for the table of a
+	// module's top level. The module's globals take slots from main's.
+	main *SymbolTable
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol), FreeSymbols: []Symbol{}}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewModuleSymbolTable returns a table for the top level of a module imported
+// by the program whose top level main is the table of. The module's globals
+// are stored alongside the program's, so they are numbered after them, but only
+// builtins are visible to it from main.
+func NewModuleSymbolTable(main *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.main = main
+	for name, symbol := range main.store {
+		if symbol.Scope == BuiltinScope {
+			s.store[name] = symbol
+		}
+	}
+	return s
+}
+
+// Define binds name to a new slot in this table. A name that is already bound
+// to a slot in this table keeps it.
+func (s *SymbolTable) Define(name string) Symbol {
+	scope := LocalScope
+	if s.Outer == nil {
+		scope = GlobalScope
+	}
+
+	if symbol, ok := s.store[name]; ok && symbol.Scope == scope {
+		return symbol
+	}
+
+	slots := s
+	if s.main != nil {
+		slots = s.main
+	}
+
+	symbol := Symbol{Name: name, Scope: scope, Index: slots.numDefinitions, Cell: scope == LocalScope && s.cells[name]}
+	s.store[name] = symbol
+	slots.names = append(slots.names, name)
+	slots.numDefinitions++
+	return symbol
+}
+
+// DefineFunctionName binds name to the closure currently being executed, so
+// that a function bound with let can call itself.
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineBuiltin binds name to the builtin at index. Builtins are defined in
+// the outermost table, so that globals with the same name replace them.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve finds the symbol bound to name. Locals of enclosing functions are
+// turned into free symbols of this one.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return obj, ok
+	}
+
+	obj, ok = s.Outer.Resolve(name)
+	if !ok || obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		return obj, ok
+	}
+
+	return s.defineFree(obj), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope, Cell: original.Cell}
+	s.store[original.Name] = symbol
+	return symbol
+}
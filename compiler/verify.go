@@ -0,0 +1,217 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/MichaelDiBernardo/monkey/builtins"
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/object"
+)
+
+// verify checks that bytecode decoded from a precompiled file is safe for the
+// VM to run, since the VM trusts what the compiler emits. Every instruction
+// has to be known and whole, its operands have to refer to constants, locals,
+// builtins and member names that exist, its jumps have to land on
+// instructions in the same body, and it must never pop more values off the
+// stack than the body has pushed.
+func verify(bytecode *Bytecode) error {
+	main := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	if err := verifyBody("main", main, true, bytecode); err != nil {
+		return err
+	}
+
+	for i, c := range bytecode.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if err := verifyBody(fmt.Sprintf("constant %d", i), fn, false, bytecode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instruction is an instruction of a body being verified.
+type instruction struct {
+	def      *code.Definition
+	op       code.Opcode
+	operands []int
+	next     int // Offset of the instruction after it.
+}
+
+// verifyBody verifies the instructions of fn, which is the body called name
+// in bytecode. The program's top level, for which isMain is set, is verified
+// as a function with no locals.
+func verifyBody(name string, fn *object.CompiledFunction, isMain bool, bytecode *Bytecode) error {
+	if fn.NumParameters > fn.NumLocals || fn.NumLocals > code.MaxOperand(1)+1 {
+		return fmt.Errorf("bad %s: %d parameters and %d locals", name, fn.NumParameters, fn.NumLocals)
+	}
+
+	fail := func(offset int, format string, a ...interface{}) error {
+		return fmt.Errorf("bad instruction at offset %d of %s: %s", offset, name, fmt.Sprintf(format, a...))
+	}
+
+	ins := fn.Instructions
+	decoded := map[int]instruction{}
+	for offset := 0; offset < len(ins); {
+		def, operands, width, err := code.ReadInstruction(ins, offset)
+		if err != nil {
+			return fail(offset, "%v", err)
+		}
+		op := code.Opcode(ins[offset])
+		if msg := checkOperands(op, operands, fn, isMain, bytecode); msg != "" {
+			return fail(offset, "%s %s", def.Name, msg)
+		}
+		decoded[offset] = instruction{def: def, op: op, operands: operands, next: offset + width}
+		offset += width
+	}
+
+	for offset, in := range decoded {
+		switch in.op {
+		case code.OpJump, code.OpJumpNotTruthy, code.OpIterNext:
+			target := in.operands[0]
+			if _, ok := decoded[target]; !ok && target != len(ins) {
+				return fail(offset, "%s jumps to %d, which doesn't start an instruction", in.def.Name, target)
+			}
+		}
+	}
+
+	// The stack is followed through every path in the body, keeping the
+	// fewest values it may hold at each instruction; only the top level
+	// may run off the end of its instructions.
+	depths := map[int]int{0: 0}
+	work := []int{0}
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+		depth := depths[offset]
+
+		if offset == len(ins) {
+			if !isMain {
+				return fmt.Errorf("bad %s: it runs past the end of its instructions", name)
+			}
+			continue
+		}
+
+		in := decoded[offset]
+		need, successors := stackEffect(in, depth, fn)
+		if depth < need {
+			return fail(offset, "%s needs %d values on the stack, but there may be only %d", in.def.Name, need, depth)
+		}
+
+		for _, s := range successors {
+			if seen, ok := depths[s.offset]; !ok || s.depth < seen {
+				depths[s.offset] = s.depth
+				work = append(work, s.offset)
+			}
+		}
+	}
+	return nil
+}
+
+// checkOperands returns why the operands of an instruction for op in fn are
+// bad, or "" if they're fine. Jump targets are checked once the whole body has
+// been decoded.
+func checkOperands(op code.Opcode, operands []int, fn *object.CompiledFunction, isMain bool, bytecode *Bytecode) string {
+	switch op {
+	case code.OpConstant, code.OpClosure, code.OpImport:
+		index := operands[0]
+		if index >= len(bytecode.Constants) {
+			return fmt.Sprintf("refers to constant %d of %d", index, len(bytecode.Constants))
+		}
+		target, isFn := bytecode.Constants[index].(*object.CompiledFunction)
+		if op == code.OpClosure && (!isFn || target.Module != "") {
+			return fmt.Sprintf("refers to constant %d, which isn't a function", index)
+		}
+		if op == code.OpImport && (!isFn || target.Module == "") {
+			return fmt.Sprintf("refers to constant %d, which isn't a module", index)
+		}
+	case code.OpGetLocal, code.OpSetLocal, code.OpCell:
+		if operands[0] >= fn.NumLocals {
+			return fmt.Sprintf("refers to local %d of %d", operands[0], fn.NumLocals)
+		}
+	case code.OpGetBuiltin:
+		if operands[0] >= len(builtins.Builtins) {
+			return fmt.Sprintf("refers to builtin %d of %d", operands[0], len(builtins.Builtins))
+		}
+	case code.OpMember:
+		if operands[0] >= len(bytecode.Names) {
+			return fmt.Sprintf("refers to name %d of %d", operands[0], len(bytecode.Names))
+		}
+	case code.OpHash:
+		if operands[0]%2 != 0 {
+			return fmt.Sprintf("has an odd number of keys and values: %d", operands[0])
+		}
+	case code.OpReturn:
+		if isMain {
+			return "is outside of a function"
+		}
+	case code.OpModule:
+		if fn.Module == "" {
+			return "is outside of a module"
+		}
+	}
+	return ""
+}
+
+// successor is where an instruction may go next, and the fewest values the
+// stack may hold when it gets there.
+type successor struct {
+	offset int
+	depth  int
+}
+
+// stackEffect returns how many values in must find on the stack, which holds
+// at least depth values, and where it may go next.
+func stackEffect(in instruction, depth int, fn *object.CompiledFunction) (int, []successor) {
+	next := func(pops int, pushes int) (int, []successor) {
+		return pops, []successor{{in.next, depth - pops + pushes}}
+	}
+
+	switch in.op {
+	case code.OpJump:
+		return 0, []successor{{in.operands[0], depth}}
+	case code.OpJumpNotTruthy:
+		return 1, []successor{{in.next, depth - 1}, {in.operands[0], depth - 1}}
+	case code.OpIterNext:
+		// The iterator stays on the stack, under the next element if there
+		// is one.
+		return 1, []successor{{in.next, depth + 1}, {in.operands[0], depth}}
+	case code.OpReturnValue:
+		return 1, nil
+	case code.OpReturn:
+		return 0, nil
+	case code.OpModule:
+		return len(fn.Exports), nil
+
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpGetGlobal,
+		code.OpGetLocal, code.OpGetFree, code.OpCurrentClosure, code.OpGetBuiltin, code.OpImport:
+		return next(0, 1)
+	case code.OpPop, code.OpSetGlobal, code.OpSetLocal:
+		return next(1, 0)
+	case code.OpMinus, code.OpBang, code.OpBitNot, code.OpIter, code.OpGetCell, code.OpMember:
+		return next(1, 1)
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpGreaterEqual, code.OpLessEqual, code.OpBitAnd, code.OpBitOr,
+		code.OpBitXor, code.OpShiftLeft, code.OpShiftRight, code.OpIndex:
+		return next(2, 1)
+	case code.OpSetIndex:
+		return next(3, 1)
+	case code.OpSetCell:
+		return next(2, 0)
+	case code.OpDup2:
+		return next(2, 4)
+	case code.OpCell:
+		return next(0, 0)
+	case code.OpArray, code.OpHash:
+		return next(in.operands[0], 1)
+	case code.OpClosure:
+		return next(in.operands[1], 1)
+	case code.OpCall:
+		return next(in.operands[0]+1, 1)
+	default:
+		panic(fmt.Sprintf("no stack effect for %s", in.def.Name))
+	}
+}
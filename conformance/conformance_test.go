@@ -0,0 +1,1141 @@
+package conformance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/builtins"
+	"github.com/MichaelDiBernardo/monkey/compiler"
+	"github.com/MichaelDiBernardo/monkey/eval"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/loader"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/resolver"
+	"github.com/MichaelDiBernardo/monkey/vm"
+)
+
+// errorMessage is the expected result of a program that fails with a runtime
+// error.
+type errorMessage string
+
+// bigInt is the expected result of a program that gives a BigInt, written out
+// in decimal.
+type bigInt string
+
+// decimal is the expected result of a program that gives a Decimal, written as
+// it is inspected, like 12.50d.
+type decimal string
+
+// rational is the expected result of a program that gives a Rational, written
+// as it is inspected, like -1/3.
+type rational string
+
+// str is the expected result of a program that gives a String, written as its
+// value rather than as it is inspected.
+type str string
+
+// conformanceTest is a program along with the result every engine must agree
+// on. expected is an int, bool, []int for an array of integers, bigInt,
+// decimal, rational, str, []string for an array of strings, errorMessage,
+// exitCode, or nil for null.
+type conformanceTest struct {
+	input    string
+	expected interface{}
+}
+
+// exitCode is the expected result of a program that calls exit with it.
+type exitCode int
+
+// settings are what an engine runs a program with.
+type settings struct {
+	arith object.Arithmetic
+	perms object.Permissions
+	args  []string
+}
+
+// engine runs a resolved Monkey program with the given settings, and returns
+// its value, or the *object.Error it failed with.
+type engine struct {
+	name string
+	run  func(t testing.TB, program *ast.Program, s settings) object.Object
+}
+
+var engines = []engine{
+	{"eval", runEval},
+	{"vm", runVM},
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"5", 5},
+		{"98", 98},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 7 % 3 * 4", 6},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"5 ** 0", 1},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"~0", -1},
+		{"~5 & 255", 250},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 << 64", bigInt("18446744073709551616")},
+		{"1 << 63", bigInt("9223372036854775808")},
+		{"-1 << 63", -9223372036854775807 - 1},
+		{"-1 << 64", bigInt("-18446744073709551616")},
+		{"1 | 2 ^ 3 & 6", 1},
+		{"1 << 2 + 1", 8},
+		{"let flags = 1; flags = flags | 4; (flags & 4) == 4", true},
+	})
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"true", true},
+		{"false", false},
+		{"!true", false},
+		{"!false", true},
+		{"!!false", false},
+		{"!!true", true},
+		{"!81", false},
+		{"!!81", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{"!(if (false) { 5 })", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"0 || if (false) { 1 }", true},
+		{"if (false) { 1 } || false", false},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"false && 1 + true", false},
+		{"true || -true", true},
+		{"let n = 0; let bump = fn() { n += 1; true }; false && bump(); true || bump(); n", 0},
+		{"let n = 0; let bump = fn() { n += 1; true }; true && bump(); false || bump(); n", 2},
+	})
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) {}", nil},
+		{"if (true) { let a = 1; }", nil},
+		{"if (true) { let a = 1; a }", 1},
+	})
+}
+
+func TestReturnStatements(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+		{"let f = fn() { if (true) { return 1; } return 2; }; f()", 1},
+		{"let f = fn() { if (false) { return 1; } return 2; }; f()", 2},
+	})
+}
+
+func TestLetStatements(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a = 5;", nil},
+		{"", nil},
+		{"let a = 1; let a = a + 1; a", 2},
+		{"if (true) { let a = 1; } a", 1},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"fn() { }()", nil},
+		{"fn() { let a = 1; }()", nil},
+		{"let f = fn(a) { let b = a * 2; b + 1 }; f(4)", 9},
+		{"let g = 10; let f = fn(a) { a + g }; f(1)", 11},
+		{"let f = fn(a) { let a = a + 1; a }; f(1)", 2},
+	})
+}
+
+func TestClosures(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{`
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`, 4},
+		{`
+let newAdder = fn(a, b) {
+  let c = a + b;
+  fn(d) { let e = d + c; fn(f) { e + f } };
+};
+newAdder(1, 2)(3)(4);`, 10},
+		{`
+let countDown = fn(x) {
+  if (x == 0) { return 0; }
+  countDown(x - 1);
+};
+countDown(10);`, 0},
+		{`
+let wrapper = fn() {
+  let countDown = fn(x) {
+    if (x == 0) { return 0; }
+    countDown(x - 1);
+  };
+  countDown(5);
+};
+wrapper();`, 0},
+		{`
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+fib(15);`, 610},
+		{`
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+isEven(10);`, true},
+	})
+}
+
+func TestDeepPrograms(t *testing.T) {
+	// Neither engine should run out of room on programs the other can run:
+	// calls that nest deeply, and literals with many elements.
+	pairs := []string{}
+	for i := 0; i < 5000; i++ {
+		pairs = append(pairs, fmt.Sprintf("%d: %d", i, i*i))
+	}
+
+	runConformanceTests(t, []conformanceTest{
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10000)", 0},
+		{"let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(100000)", 5000050000},
+		{"let f = fn(n) { let a = n; let b = a; if (n == 0) { [a, b] } else { f(n - 1) } }; f(50000)", []int{0, 0}},
+		{"[" + strings.Repeat("1, ", 9999) + "2][9999]", 2},
+		{"{" + strings.Join(pairs, ", ") + "}[4999]", 4999 * 4999},
+		{"let f = fn(x) { x }; [" + strings.Repeat("f(1), ", 4999) + "f(2)][4999]", 2},
+	})
+}
+
+func TestArrays(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"[]", []int{}},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+		{"let a = 1; [a, fn(x) { x * 2 }(a)]", []int{1, 2}},
+	})
+}
+
+func TestIndexExpressions(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1 + 1]", 3},
+		{"let xs = [1, 2, 3]; xs[2] * xs[0]", 3},
+		{"[1, 2, 3][3]", nil},
+		{"[1][-1]", nil},
+		{"[[1, 2]][0][1]", 2},
+		{"{1: 10, true: 20}[1]", 10},
+		{"{1: 10, true: 20}[true]", 20},
+		{"{1: 10}[2]", nil},
+		{"let k = 2; {k: k * 3}[2]", 6},
+		{"{}[false]", nil},
+		{"{1: 1, 1: 2}[1]", 2},
+	})
+}
+
+func TestAssignments(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let a = 1; let b = 2; a = b = 3; [a, b]", []int{3, 3}},
+		{"let x = 1; let y = (x += 1) * 10; [x, y]", []int{2, 20}},
+		{"let i = 0; while (i < 5) { i += 1; } i", 5},
+		{"let xs = [1, 2, 3]; xs[1] = 5; xs", []int{1, 5, 3}},
+		{"let xs = [1, 2, 3]; xs[2] *= 10; xs", []int{1, 2, 30}},
+		{"let xs = [0, 0]; let i = 0; xs[i += 1] += 7; [i, xs[0], xs[1]]", []int{1, 0, 7}},
+		{"let h = {1: 1}; h[1] += 1; h[2] = 5; [h[1], h[2]]", []int{2, 5}},
+		{"let xs = [1]; let ys = xs; ys[0] = 2; xs[0]", 2},
+		{"let x = 1; let f = fn() { x = x + 1 }; f(); f(); x", 3},
+		{"let x = 0; let f = fn(n) { x += n; x }; f(2); f(3)", 5},
+		{`
+let counter = fn() {
+  let n = 0;
+  fn() { n += 1 }
+};
+let c = counter();
+c(); c();
+let d = counter();
+[c(), d()]`, []int{3, 1}},
+		{`
+let f = fn() {
+  let n = 1;
+  let get = fn() { n };
+  n = 2;
+  get()
+};
+f()`, 2},
+		{`
+let f = fn(n) {
+  let add = fn(m) { n += m };
+  add(2);
+  add(3);
+  n
+};
+f(1)`, 6},
+		{`
+let f = fn() {
+  let n = 0;
+  let g = fn() { fn() { n += 10 } };
+  g()();
+  g()();
+  n
+};
+f()`, 20},
+		{"let f = fn() { f = 5; 1 }; f(); f", 5},
+		{"let g = fn() { let f = fn() { f = 7; 1 }; f(); f }; g()", 7},
+	})
+}
+
+func TestLoops(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"let i = 0; while (i < 10) { let i = i + 1; } i", 10},
+		{"while (false) { 1 }", nil},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } } i", 5},
+		{"let i = 0; let n = 0; while (i < 10) { let i = i + 1; if (i > 3) { continue; } let n = n + i; } n", 6},
+		{"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; } sum", 6},
+		{"for (x in []) { 1 }", nil},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } if (x == 4) { break; } let sum = sum + x; } sum", 4},
+		{"let n = 0; for (x in [1, 2]) { for (y in [10, 20, 30]) { if (y == 30) { break; } let n = n + x * y; } } n", 90},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x; } } 0 }; [f([1, 2, 3]), f([1])]", []int{2, 0}},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 3) { return i; } } }; f()", 3},
+		{"let x = 0; for (x in [1, 2]) { x }; x", 2},
+		{"let i = 0; while (i < 100000) { let i = i + 1; } i", 100000},
+	})
+}
+
+func TestOverflow(t *testing.T) {
+	runConformanceTestsWithOverflow(t, object.OverflowError, []conformanceTest{
+		{"9223372036854775807 + 1", errorMessage("integer overflow: 9223372036854775807 + 1")},
+		{"let min = -9223372036854775807 - 1; min - 1", errorMessage("integer overflow: -9223372036854775808 - 1")},
+		{"4294967296 * 4294967296", errorMessage("integer overflow: 4294967296 * 4294967296")},
+		{"let min = -9223372036854775807 - 1; -min", errorMessage("integer overflow: --9223372036854775808")},
+		{"let min = -9223372036854775807 - 1; min / -1", errorMessage("integer overflow: -9223372036854775808 / -1")},
+		{"2 ** 63", errorMessage("integer overflow: 2 ** 63")},
+		{"let x = 9223372036854775807; x += 1", errorMessage("integer overflow: 9223372036854775807 + 1")},
+		{"-9223372036854775807 - 1 == (-2) ** 63", true},
+		{"-1 << 63 == (-2) ** 63", true},
+		{"1 << 63", errorMessage("integer overflow: 1 << 63")},
+		{"1 << 64", errorMessage("integer overflow: 1 << 64")},
+		{"3 << 62", errorMessage("integer overflow: 3 << 62")},
+		{"9223372036854775807 * -1", -9223372036854775807},
+		{"1 / 0", errorMessage("division by zero")},
+		{"1 % (1 - 1)", errorMessage("division by zero")},
+	})
+
+	runConformanceTestsWithOverflow(t, object.OverflowWrap, []conformanceTest{
+		{"9223372036854775807 + 1", -9223372036854775807 - 1},
+		{"4294967296 * 4294967296", 0},
+		{"2 ** 64", 0},
+		{"1 << 64", 0},
+		{"3 << 62", -4611686018427387904},
+		{"let min = -9223372036854775807 - 1; -min == min && min / -1 == min", true},
+		{"1 / 0", errorMessage("division by zero")},
+	})
+
+	runConformanceTestsWithOverflow(t, object.OverflowPromote, []conformanceTest{
+		{"9223372036854775807 + 1", bigInt("9223372036854775808")},
+		{"4294967296 * 4294967296 * 2", bigInt("36893488147419103232")},
+		{"2 ** 100", bigInt("1267650600228229401496703205376")},
+		{"3 << 62", bigInt("13835058055282163712")},
+		{"let min = -9223372036854775807 - 1; -min", bigInt("9223372036854775808")},
+		{"-(2 ** 64)", bigInt("-18446744073709551616")},
+		{"(2 ** 64) / 3 % 1000", 205},
+		{"2 ** 64 > 9223372036854775807", true},
+		{"2 ** 64 == 2 ** 64", true},
+		{"(2 ** 64) / 0", errorMessage("division by zero")},
+		{"2 ** 64 + true", errorMessage("type mismatch: BIGINT + BOOLEAN")},
+		{"1 + 2", 3},
+	})
+}
+
+func TestBigIntegers(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"123456789012345678901234567890", bigInt("123456789012345678901234567890")},
+		{"-123456789012345678901234567890", bigInt("-123456789012345678901234567890")},
+		{"9223372036854775808", bigInt("9223372036854775808")},
+		{"-9223372036854775808", -9223372036854775807 - 1},
+		{"9223372036854775808 - 1", 9223372036854775807},
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"2147483647 * -2147483648", -4611686016279904256},
+		{"2147483648 * 2147483648", 4611686018427387904},
+		{"let min = -9223372036854775807 - 1; min % -1", 0},
+		{"100000000000000000000 / 10000000000", 10000000000},
+		{"100000000000000000000 % 7", 2},
+		{"let cents = 1000000000000000000000; cents * 3 / 100", bigInt("30000000000000000000")},
+		{"(2 ** 64) >> 1", bigInt("9223372036854775808")},
+		{"(2 ** 64) >> 2", 4611686018427387904},
+		{"~(2 ** 64) + 1", bigInt("-18446744073709551616")},
+		{"(2 ** 64 - 1) & 255", 255},
+		{"2 ** 64 == 18446744073709551616", true},
+		{"2 ** 64 != 2 ** 65", true},
+		{"18446744073709551616 <= 18446744073709551615", false},
+		{"let h = {18446744073709551616: 1, 1: 2}; h[2 ** 64] + h[(2 ** 64) / (2 ** 64)]", 3},
+		{"if (2 ** 64) { 1 }", 1},
+		{"(2 ** 64) ** -1", errorMessage("negative exponent: -1")},
+		{"3 ** 100000000", errorMessage("exponent too large: 100000000")},
+		{"2 ** 10000000000", errorMessage("exponent too large: 10000000000")},
+		{"(2 ** 64) ** 100000", errorMessage("exponent too large: 100000")},
+		{"(2 ** 524288) >> 524288", 1},
+		{"[1 ** 10000000000, (-1) ** 10000000001, 0 ** 10000000000]", []int{1, -1, 0}},
+		{"1 << (2 ** 64)", errorMessage("shift count too large: 18446744073709551616")},
+		{"[2 ** 64][0] - 18446744073709551615", 1},
+	})
+}
+
+func TestDecimals(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"12.50d", decimal("12.50d")},
+		{"12.50d + 0.125d", decimal("12.625d")},
+		{"12.50d - 20", decimal("-7.50d")},
+		{"-0.05d * 3", decimal("-0.15d")},
+		{"1.5d * 1.5d", decimal("2.25d")},
+		{"10d / 4", decimal("2.5000000000d")},
+		{"2d / 3", decimal("0.6666666667d")},
+		{"7.5d % 2", decimal("1.5d")},
+		{"-7.5d % 2", decimal("-1.5d")},
+		{"1.1d ** 3", decimal("1.331d")},
+		{"1.5d == 1.50d", true},
+		{"2.0d == 2", true},
+		{"2 != 2.01d", true},
+		{"0.1d + 0.2d == 0.3d", true},
+		{"9.99d < 10", true},
+		{"18446744073709551616 > 1.5d", true},
+		{"let total = 0d; for (p in [19.99d, 5.01d]) { total += p }; total", decimal("25.00d")},
+		{"{1.5d: 1}[1.50d]", 1},
+		{"{2.0d: 1, 2: 2}[2]", 2},
+		{"decimal(2, 2)", decimal("2.00d")},
+		{"decimal(1.005d, 2)", decimal("1.00d")},
+		{"decimal(rational(1, 3), 4)", decimal("0.3333d")},
+		{"1d / 0", errorMessage("division by zero")},
+		{"1.5d % 0.0d", errorMessage("division by zero")},
+		{"1.5d & 1", errorMessage("unknown operator: DECIMAL & DECIMAL")},
+		{"~1.5d", errorMessage("unknown operator: ~DECIMAL")},
+		{"2 ** 0.5d", errorMessage("unknown operator: INTEGER ** DECIMAL")},
+		{"1.5d ** -1", errorMessage("negative exponent: -1")},
+		{"1.5d ** 100000000", errorMessage("exponent too large: 100000000")},
+		{"decimal(true, 2)", errorMessage("argument 1 to decimal must be a number, got BOOLEAN")},
+		{"decimal(1, -1)", errorMessage("decimal places must be between 0 and 65536, got -1")},
+	})
+}
+
+func TestDecimalRounding(t *testing.T) {
+	tests := []struct {
+		rounding object.Rounding
+		results  []decimal // For 2.5d, -2.5d, 2.25d and -2.75d rounded to fewer places.
+	}{
+		{object.RoundHalfEven, []decimal{"2d", "-2d", "2.2d", "-2.8d"}},
+		{object.RoundHalfUp, []decimal{"3d", "-3d", "2.3d", "-2.8d"}},
+		{object.RoundHalfDown, []decimal{"2d", "-2d", "2.2d", "-2.7d"}},
+		{object.RoundUp, []decimal{"3d", "-3d", "2.3d", "-2.8d"}},
+		{object.RoundDown, []decimal{"2d", "-2d", "2.2d", "-2.7d"}},
+		{object.RoundCeiling, []decimal{"3d", "-2d", "2.3d", "-2.7d"}},
+		{object.RoundFloor, []decimal{"2d", "-3d", "2.2d", "-2.8d"}},
+	}
+
+	for _, tt := range tests {
+		arith := object.DefaultArithmetic
+		arith.Rounding = tt.rounding
+
+		arith.Places = 0
+		runConformanceTestsWithArithmetic(t, arith, []conformanceTest{
+			{"5d / 2", tt.results[0]},
+			{"-5d / 2", tt.results[1]},
+			{"decimal(2.25d, 1)", tt.results[2]},
+			{"decimal(-2.75d, 1)", tt.results[3]},
+		})
+	}
+}
+
+func TestRationals(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"rational(1, 3)", rational("1/3")},
+		{"rational(2, -6)", rational("-1/3")},
+		{"rational(6, 3)", 2},
+		{"rational(1, 3) + rational(1, 6)", rational("1/2")},
+		{"rational(1, 3) * 3", 1},
+		{"rational(1, 3) - 1", rational("-2/3")},
+		{"1 / rational(2, 3)", rational("3/2")},
+		{"rational(1, 3) + 0.5d", rational("5/6")},
+		{"rational(2, 3) ** 2", rational("4/9")},
+		{"rational(2, 3) ** -2", rational("9/4")},
+		{"rational(1, 2) == 0.5d", true},
+		{"rational(1, 3) < 0.33d", false},
+		{"-rational(1, 3)", rational("-1/3")},
+		{"rational(18446744073709551616, 3) * 3", bigInt("18446744073709551616")},
+		{"numerator(rational(-4, 6))", -2},
+		{"denominator(rational(-4, 6))", 3},
+		{"denominator(7)", 1},
+		{"let h = {rational(1, 2): 1}; h[rational(2, 4)]", 1},
+		{"let rational = fn(a, b) { a + b }; rational(1, 2)", 3},
+		{"let div = decimal; div(rational(2, 3), 2)", decimal("0.67d")},
+		{"rational(1, 0)", errorMessage("division by zero")},
+		{"rational(1, 3) / 0", errorMessage("division by zero")},
+		{"rational(0, 3) ** -1", errorMessage("negative exponent: -1")}, // rational(0, 3) is the integer 0.
+		{"rational(1, 3) ** -100000000", errorMessage("exponent too large: -100000000")},
+		{"rational(1, 3) % 2", errorMessage("unknown operator: RATIONAL % INTEGER")},
+		{"rational(1)", errorMessage("wrong number of arguments to rational: want=2, got=1")},
+		{"rational(1, 1.5d)", errorMessage("argument 2 to rational must be INTEGER, got DECIMAL")},
+		{"numerator(1.5d)", errorMessage("argument 1 to numerator must be INTEGER or RATIONAL, got DECIMAL")},
+	})
+}
+
+func TestStrings(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{`"monkey"`, str("monkey")},
+		{`""`, str("")},
+		{`"mon" + "key"`, str("monkey")},
+		{`"say \"hi\"\n"`, str("say \"hi\"\n")},
+		{`"\u{1F412}"`, str("🐒")},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{`"a" == 1`, false},
+		{`"abc" < "abd"`, true},
+		{`"b" >= "abc"`, true},
+		{`"é" > "z"`, true},
+		{`"héllo"[1]`, str("é")},
+		{`"héllo"[4]`, str("o")},
+		{`"héllo"[5]`, nil},
+		{`"héllo"[-1]`, nil},
+		{`let s = ""; for (c in "añb") { s = c + s; } s`, str("bña")},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`, 3},
+		{`let s = "a"; s += "b"; s`, str("ab")},
+		{`if ("") { 1 } else { 2 }`, 1},
+		{`"a" - "b"`, errorMessage("unknown operator: STRING - STRING")},
+		{`"a" + 1`, errorMessage("type mismatch: STRING + INTEGER")},
+		{`let s = strings.repeat("a", 134217729); s + s`, errorMessage("string concatenation result is too long")},
+		{`-"a"`, errorMessage("unknown operator: -STRING")},
+		{`"abc"["a"]`, errorMessage("string index must be INTEGER, got STRING")},
+		{`let s = "abc"; s[0] = "x"`, errorMessage("index assignment not supported: STRING")},
+	})
+}
+
+func TestStringsModule(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{`strings.len("héllo 🐒")`, 7},
+		{`strings.split("a,b,,c", ",")`, []string{"a", "b", "", "c"}},
+		{`strings.split("añ🐒", "")`, []string{"a", "ñ", "🐒"}},
+		{`strings.split("", ",")`, []string{""}},
+		{`strings.join(["a", "b", "c"], ", ")`, str("a, b, c")},
+		{`strings.join([], ", ")`, str("")},
+		{`strings.join(strings.split("a b c", " "), "-")`, str("a-b-c")},
+		{`strings.trim(" \t héllo\n ")`, str("héllo")},
+		{`strings.trim("\u{3000}wide\u{a0}")`, str("wide")},
+		{`strings.contains("monkey business", "key b")`, true},
+		{`strings.contains("monkey", "")`, true},
+		{`strings.contains("monkey", "donkey")`, false},
+		{`strings.replace("banana", "an", "AN")`, str("bANANa")},
+		{`strings.replace("añb", "", "-")`, str("-a-ñ-b-")},
+		{`strings.upper("héllo ñ")`, str("HÉLLO Ñ")},
+		{`strings.lower("ÀÉÎ")`, str("àéî")},
+		{`strings.repeat("ab", 3)`, str("ababab")},
+		{`strings.repeat("ab", 0)`, str("")},
+		{`strings.format("{} + {} = {}", 1, 2, 3)`, str("1 + 2 = 3")},
+		{`strings.format("{1}, {0}! {1}?", "world", "hello")`, str("hello, world! hello?")},
+		{`strings.format("{{{}}} {}", "x", [1, "y"])`, str(`{x} [1, "y"]`)},
+		{`strings.format("plain")`, str("plain")},
+		{`let upper = strings.upper; upper("a")`, str("A")},
+		{`let strings = 5; strings`, 5},
+		{`strings.len()`, errorMessage("wrong number of arguments to strings.len: want=1, got=0")},
+		{`strings.split("a")`, errorMessage("wrong number of arguments to strings.split: want=2, got=1")},
+		{`strings.split("a", 1)`, errorMessage("argument 2 to strings.split must be STRING, got INTEGER")},
+		{`strings.join("a", "")`, errorMessage("argument 1 to strings.join must be ARRAY, got STRING")},
+		{`strings.join(["a", 1], "")`, errorMessage("element 1 of argument 1 to strings.join must be STRING, got INTEGER")},
+		{`strings.upper(true)`, errorMessage("argument 1 to strings.upper must be STRING, got BOOLEAN")},
+		{`strings.repeat("a", -1)`, errorMessage("strings.repeat count must be at least 0, got -1")},
+		{`strings.repeat("a", "b")`, errorMessage("argument 2 to strings.repeat must be INTEGER, got STRING")},
+		{`strings.repeat("ab", 1 << 40)`, errorMessage("strings.repeat result is too long")},
+		{`strings.format()`, errorMessage("wrong number of arguments to strings.format: want at least 1, got=0")},
+		{`strings.format("{} {}", 1)`, errorMessage("strings.format template refers to argument 1, but only 1 were given")},
+		{`strings.format("{}", 1, 2)`, errorMessage("strings.format template doesn't use argument 1")},
+		{`strings.format("é {", 1)`, errorMessage("strings.format template has an unmatched { at character 2")},
+		{`strings.format("}")`, errorMessage("strings.format template has an unmatched } at character 0")},
+		{`strings.format("{x}", 1)`, errorMessage("strings.format template has a bad field {x}")},
+		{`strings.nope`, errorMessage("module strings has no member nope")},
+	})
+}
+
+func TestMathModule(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"math.pi", decimal("3.14159265358979323846d")},
+		{"math.e", decimal("2.71828182845904523536d")},
+		{"math.abs(-3)", 3},
+		{"math.abs(-1.50d)", decimal("1.50d")},
+		{"math.abs(rational(-1, 3))", rational("1/3")},
+		{"math.abs(-9223372036854775807 - 1)", bigInt("9223372036854775808")},
+		{"math.min(3, 1.5d, rational(1, 3))", rational("1/3")},
+		{"math.max([1, 2.5d, 2])", decimal("2.5d")},
+		{"math.max(2, 2.0d)", 2},
+		{"math.floor(-2.5d)", -3},
+		{"math.floor(rational(7, 2))", 3},
+		{"math.ceil(-2.5d)", -2},
+		{"math.ceil(7)", 7},
+		{"math.round(2.5d)", 2},
+		{"math.round(-2.51d)", -3},
+		{"math.pow(2, 10)", 1024},
+		{"math.pow(2, -2)", rational("1/4")},
+		{"math.pow(1.5d, 2)", decimal("2.25d")},
+		{"math.pow(2.0d, -3)", decimal("0.1250000000d")},
+		{"math.pow(2, 0.5d)", decimal("1.4142135624d")},
+		{"math.pow(-2, 3.0d)", decimal("-8.0000000000d")},
+		{"math.pow(0, 0.5d)", decimal("0.0000000000d")},
+		{"math.sqrt(16)", 4},
+		{"math.sqrt(rational(9, 4))", rational("3/2")},
+		{"math.sqrt(2)", decimal("1.4142135624d")},
+		{"math.sqrt(6.25d)", decimal("2.5000000000d")},
+		{"math.exp(1)", decimal("2.7182818285d")},
+		{"math.exp(-1)", decimal("0.3678794412d")},
+		{"math.log(10)", decimal("2.3025850930d")},
+		{"math.log(1)", decimal("0.0000000000d")},
+		{"math.log(8, 2)", decimal("3.0000000000d")},
+		{"math.log(2, 1.0001d)", decimal("6931.8183734138d")},
+		{"math.sin(1)", decimal("0.8414709848d")},
+		{"math.sin(math.pi)", decimal("0.0000000000d")},
+		{"math.sin(10 ** 30)", decimal("-0.0901169019d")},
+		{"math.cos(-1)", decimal("0.5403023059d")},
+		{"math.tan(1)", decimal("1.5574077247d")},
+		{"math.asin(-1)", decimal("-1.5707963268d")},
+		{"math.acos(0.5d)", decimal("1.0471975512d")},
+		{"math.atan(1)", decimal("0.7853981634d")},
+		{"math.atan(-1000)", decimal("-1.5697963271d")},
+		{"let sqrt = math.sqrt; sqrt(9)", 3},
+		{"math.sqrt(-4)", errorMessage("math.sqrt of a negative number: -4")},
+		{"math.log(0)", errorMessage("math.log of a non-positive number: 0")},
+		{"math.log(2, 1)", errorMessage("math.log base must be positive and not 1, got 1")},
+		{"math.asin(1.5d)", errorMessage("math.asin argument must be between -1 and 1, got 1.5d")},
+		{"math.pow(-8, rational(1, 3))", errorMessage("math.pow of a negative number to a fractional power: -8, 1/3")},
+		{"math.pow(0, -1)", errorMessage("division by zero")},
+		{"math.pow(0, -0.5d)", errorMessage("division by zero")},
+		{"math.pow(10, 5000.5d)", errorMessage("math.pow result out of range: 10, 5000.5d")},
+		{"math.pow(3, 100000000)", errorMessage("exponent too large: 100000000")},
+		{"math.pow(3, -100000000)", errorMessage("math.pow result out of range: 3, -100000000")},
+		{"math.pow(1.5d, -100000000)", errorMessage("math.pow result out of range: 1.5d, -100000000")},
+		{"math.pow(rational(1, 3), -100000000)", errorMessage("exponent too large: -100000000")},
+		{"math.pow(1, -10000000000)", 1},
+		{"math.exp(10001)", errorMessage("math.exp argument out of range: 10001")},
+		{"math.min()", errorMessage("wrong number of arguments to math.min: want at least 1, got=0")},
+		{"math.min([])", errorMessage("math.min of an empty array")},
+		{"math.max(1, true)", errorMessage("argument 2 to math.max must be a number, got BOOLEAN")},
+		{"math.max([1, \"a\"])", errorMessage("element 1 of argument 1 to math.max must be a number, got STRING")},
+		{"math.sqrt(1, 2)", errorMessage("wrong number of arguments to math.sqrt: want=1, got=2")},
+		{"math.log()", errorMessage("wrong number of arguments to math.log: want=1 or 2, got=0")},
+		{"math.floor(\"1\")", errorMessage("argument 1 to math.floor must be a number, got STRING")},
+	})
+
+	arith := object.DefaultArithmetic
+	arith.Places = 30
+	arith.Rounding = object.RoundDown
+	runConformanceTestsWithArithmetic(t, arith, []conformanceTest{
+		{"math.sqrt(2)", decimal("1.414213562373095048801688724209d")},
+		{"math.log(10)", decimal("2.302585092994045684017991454684d")},
+		{"math.round(2.9d)", 2},
+	})
+}
+
+func TestJSONModule(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{`json.parse("42")`, 42},
+		{`json.parse("-18446744073709551616")`, bigInt("-18446744073709551616")},
+		{`json.parse("2.50")`, decimal("2.50d")},
+		{`json.parse("-1.5e2")`, decimal("-150d")},
+		{`json.parse("25E-3")`, decimal("0.025d")},
+		{`json.parse(" true ")`, true},
+		{`json.parse("null")`, nil},
+		{`json.parse("\"h\\u00e9 \\ud83d\\udc12\\n\"")`, str("hé 🐒\n")},
+		{`json.parse("[1, [2], []]")[1][0]`, 2},
+		{`let h = json.parse("{\"a\": {\"b\": [1, 2]}}"); h["a"]["b"][1]`, 2},
+		{`json.parse("{\"a\": 1, \"a\": 2}")["a"]`, 2},
+		{`json.stringify(json.parse(" { \"b\" : [ 1, 2.50, null ], \"a\" : \"x\" } "))`, str(`{"a":"x","b":[1,2.50,null]}`)},
+		{`json.stringify({"b": 1, "a": [true, false], "c": {}})`, str(`{"a":[true,false],"b":1,"c":{}}`)},
+		{`json.stringify({"b": [1, {"c": true}], "a": []}, 2)`, str("{\n  \"a\": [],\n  \"b\": [\n    1,\n    {\n      \"c\": true\n    }\n  ]\n}")},
+		{`json.stringify([1, 2], "\t")`, str("[\n\t1,\n\t2\n]")},
+		{`json.stringify([1], 0)`, str("[\n1\n]")},
+		{`json.stringify("say \"hi\"\n\u{1}é")`, str(`"say \"hi\"\n\u0001é"`)},
+		{`json.stringify(-12.50d)`, str("-12.50")},
+		{`json.stringify(2 ** 64)`, str("18446744073709551616")},
+		{`json.parse("")`, errorMessage("json.parse error at byte 0: unexpected end of input")},
+		{`json.parse("[1, 2")`, errorMessage("json.parse error at byte 5: unexpected end of input")},
+		{`json.parse("[1, 2,]")`, errorMessage("json.parse error at byte 6: unexpected character ']'")},
+		{`json.parse("{\"a\" 1}")`, errorMessage("json.parse error at byte 5: unexpected character '1'")},
+		{`json.parse("{1: 2}")`, errorMessage("json.parse error at byte 1: unexpected character '1'")},
+		{`json.parse("01")`, errorMessage("json.parse error at byte 1: unexpected character '1'")},
+		{`json.parse("1.")`, errorMessage("json.parse error at byte 2: unexpected end of input")},
+		{`json.parse("nul")`, errorMessage("json.parse error at byte 0: unexpected character 'n'")},
+		{`json.parse("[é]")`, errorMessage("json.parse error at byte 1: unexpected character 'é'")},
+		{`json.parse("1e99999")`, errorMessage("json.parse error at byte 0: number 1e99999 out of range")},
+		{`json.parse("[\"abc")`, errorMessage("json.parse error at byte 1: unterminated string")},
+		{`json.parse("\"a\\x\"")`, errorMessage(`json.parse error at byte 2: invalid escape "\\x"`)},
+		{`json.parse("\"a\tb\"")`, errorMessage(`json.parse error at byte 2: control character '\t' in string`)},
+		{`json.parse(strings.repeat("[", 1001))`, errorMessage("json.parse error at byte 1000: nested more than 1000 deep")},
+		{`json.parse(1)`, errorMessage("argument 1 to json.parse must be STRING, got INTEGER")},
+		{`json.stringify(rational(1, 3))`, errorMessage("json.stringify can't encode RATIONAL")},
+		{`json.stringify([json.parse])`, errorMessage("json.stringify can't encode BUILTIN")},
+		{`json.stringify({1: 2})`, errorMessage("json.stringify can't encode a hash key of type INTEGER")},
+		{`let a = [1]; a[0] = a; json.stringify(a)`, errorMessage("json.stringify value is nested more than 1000 deep, or contains itself")},
+		{`json.stringify(1, 17)`, errorMessage("json.stringify indent must be between 0 and 16, got 17")},
+		{`json.stringify(1, "x")`, errorMessage(`json.stringify indent must be at most 16 spaces and tabs, got "x"`)},
+		{`json.stringify(1, true)`, errorMessage("argument 2 to json.stringify must be INTEGER or STRING, got BOOLEAN")},
+		{`json.stringify()`, errorMessage("wrong number of arguments to json.stringify: want=1 or 2, got=0")},
+	})
+}
+
+func TestFSModule(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"data/a.txt":     "héllo\n",
+		"data/sub/b.txt": "",
+		"secret/key":     "k",
+		"out/old.txt":    "old",
+	})
+	if err := os.Symlink(filepath.Join("..", "secret", "key"), filepath.Join(dir, "data", "key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "secret", "new"), filepath.Join(dir, "out", "new")); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := builtins.ResolvePath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perms := object.Permissions{
+		Read:  []string{filepath.Join(root, "data"), filepath.Join(root, "out")},
+		Write: []string{filepath.Join(root, "out")},
+	}
+
+	// Programs refer to the directory the files are in as $DIR.
+	tests := []conformanceTest{
+		{`fs.read("$DIR/data/a.txt")`, str("héllo\n")},
+		{`fs.read("$DIR/out/../data/sub/b.txt")`, str("")},
+		{`fs.list("$DIR/data")`, []string{"a.txt", "key", "sub"}},
+		{`fs.exists("$DIR/data/sub")`, true},
+		{`fs.exists("$DIR/data/nope")`, false},
+		{`fs.write("$DIR/out/new.txt", "a"); fs.write("$DIR/out/new.txt", "b"); fs.read("$DIR/out/new.txt")`, str("b")},
+		{`fs.write("$DIR/out/old.txt", "new")`, nil},
+		{`fs.read("$DIR/data/key")`, errorMessage("fs.read of $DIR/data/key is not allowed")},
+		{`fs.read("$DIR/data/../secret/key")`, errorMessage("fs.read of $DIR/data/../secret/key is not allowed")},
+		{`fs.exists("$DIR/secret/key")`, errorMessage("fs.exists of $DIR/secret/key is not allowed")},
+		{`fs.list("$DIR")`, errorMessage("fs.list of $DIR is not allowed")},
+		{`fs.write("$DIR/data/a.txt", "x")`, errorMessage("fs.write of $DIR/data/a.txt is not allowed")},
+		{`fs.write("$DIR/out/new", "x")`, errorMessage("fs.write of $DIR/out/new is not allowed")},
+		{`fs.read("$DIR/data/nope")`, errorMessage("fs.read of $DIR/data/nope failed: no such file or directory")},
+		{`fs.read("$DIR/data/sub")`, errorMessage("fs.read of $DIR/data/sub failed: is a directory")},
+		{`fs.write("$DIR/out/x", 1)`, errorMessage("argument 2 to fs.write must be STRING, got INTEGER")},
+		{`fs.read()`, errorMessage("wrong number of arguments to fs.read: want=1, got=0")},
+	}
+	for i := range tests {
+		tests[i].input = strings.ReplaceAll(tests[i].input, "$DIR", filepath.ToSlash(dir))
+		if msg, ok := tests[i].expected.(errorMessage); ok {
+			tests[i].expected = errorMessage(strings.ReplaceAll(string(msg), "$DIR", filepath.ToSlash(dir)))
+		}
+	}
+	runConformanceTestsIn(t, "", settings{arith: object.DefaultArithmetic, perms: perms}, tests)
+
+	if src, err := os.ReadFile(filepath.Join(dir, "out", "old.txt")); err != nil || string(src) != "new" {
+		t.Errorf("expected out/old.txt to have been written, got %q, %v", src, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "secret", "new")); !os.IsNotExist(err) {
+		t.Errorf("expected secret/new not to have been written through the symlink, got %v", err)
+	}
+
+	// Without permissions, the module can't do anything.
+	runConformanceTestsWithArithmetic(t, object.DefaultArithmetic, []conformanceTest{
+		{`fs.exists(".")`, errorMessage("fs.exists of . is not allowed")},
+	})
+}
+
+func TestProcess(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VALUE", "héllo")
+	os.Unsetenv("MONKEY_TEST_UNSET")
+
+	runConformanceTestsIn(t, "", settings{arith: object.DefaultArithmetic, perms: object.Permissions{Env: true}, args: []string{"a", "b c"}}, []conformanceTest{
+		{`args`, []string{"a", "b c"}},
+		{`let f = fn() { args[1] }; f()`, str("b c")},
+		{`args[0] = "x"; args`, []string{"x", "b c"}},
+		{`env("MONKEY_TEST_VALUE")`, str("héllo")},
+		{`env("MONKEY_TEST_UNSET")`, nil},
+		{`exit(3)`, exitCode(3)},
+		{`exit()`, exitCode(0)},
+		{`let f = fn() { exit(1); 2 }; [f(), 3]`, exitCode(1)},
+		{`for (x in [1, 2]) { if (x == 2) { exit(x) } }`, exitCode(2)},
+		{`exit(256)`, errorMessage("exit code must be between 0 and 255, got 256")},
+		{`exit("1")`, errorMessage("argument 1 to exit must be INTEGER, got STRING")},
+		{`exit(1, 2)`, errorMessage("wrong number of arguments to exit: want=0 or 1, got=2")},
+		{`env(1)`, errorMessage("argument 1 to env must be STRING, got INTEGER")},
+	})
+
+	// Programs run without arguments see an empty array, and can't read the
+	// environment unless they're allowed to.
+	runConformanceTests(t, []conformanceTest{
+		{`args`, []string{}},
+		{`env("MONKEY_TEST_VALUE")`, errorMessage("env of MONKEY_TEST_VALUE is not allowed")},
+	})
+}
+
+func TestErrors(t *testing.T) {
+	runConformanceTests(t, []conformanceTest{
+		{"5 + true;", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"5 + true; 5;", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"-true", errorMessage("unknown operator: -BOOLEAN")},
+		{"true + false;", errorMessage("unknown operator: BOOLEAN + BOOLEAN")},
+		{"5; true + false; 5", errorMessage("unknown operator: BOOLEAN + BOOLEAN")},
+		{"if (10 > 1) { true + false; }", errorMessage("unknown operator: BOOLEAN + BOOLEAN")},
+		{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }", errorMessage("unknown operator: BOOLEAN + BOOLEAN")},
+		{"let f = fn() { 1 }; f(1)", errorMessage("wrong number of arguments: want=0, got=1")},
+		{"let f = fn(a, b) { 1 }; f(1)", errorMessage("wrong number of arguments: want=2, got=1")},
+		{"5()", errorMessage("not a function: INTEGER")},
+		{"let f = fn(x) { x + true }; f(1)", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"let f = fn() { g }; f(); let g = 1;", errorMessage("identifier used before definition: g")},
+		{"if (false) { let a = 1; } a", errorMessage("identifier used before definition: a")},
+		{"fn() { if (false) { let a = 1; } a }()", errorMessage("identifier used before definition: a")},
+		{"for (x in 5) { x }", errorMessage("cannot iterate over INTEGER")},
+		{"while (true) { -true }", errorMessage("unknown operator: -BOOLEAN")},
+		{"1[0]", errorMessage("index operator not supported: INTEGER")},
+		{"[1][true]", errorMessage("array index must be INTEGER, got BOOLEAN")},
+		{"{[1]: 2}", errorMessage("unusable as hash key: ARRAY")},
+		{"{1: 2}[{}]", errorMessage("unusable as hash key: HASH")},
+		{"let xs = [1]; xs[1] = 2", errorMessage("index out of range: 1")},
+		{"let x = 1; x = true; x += 1", errorMessage("type mismatch: BOOLEAN + INTEGER")},
+		{"let x = 5; x[0] = 1", errorMessage("index assignment not supported: INTEGER")},
+		{"let f = fn() { g += 1 }; f(); let g = 1;", errorMessage("identifier used before definition: g")},
+		{"let f = fn() { let h = fn() { n }; h() ; let n = 1; n = 2 }; f()", errorMessage("identifier used before definition: n")},
+		{"2 ** -1", errorMessage("negative exponent: -1")},
+		{"true <= false", errorMessage("unknown operator: BOOLEAN <= BOOLEAN")},
+		{"true && 1 % true", errorMessage("type mismatch: INTEGER % BOOLEAN")},
+		{"1 << -1", errorMessage("negative shift count: -1")},
+		{"8 >> (1 - 3)", errorMessage("negative shift count: -2")},
+		{"~true", errorMessage("unknown operator: ~BOOLEAN")},
+		{"true & false", errorMessage("unknown operator: BOOLEAN & BOOLEAN")},
+	})
+}
+
+func TestModules(t *testing.T) {
+	runConformanceTestsWithModules(t, map[string]string{
+		"counter.monkey": "let count = 0; let bump = fn() { count += 1; count };",
+		"lib/money.monkey": `
+			import "../counter.monkey" as counter;
+			let cents = 100;
+			let total = fn(dollars) { dollars * cents };
+			let loaded = counter.bump();
+		`,
+		"lib/shadow.monkey": "let x = 1; let x = 2; let hidden = fn() { x }; let y = hidden();",
+		"lib/block.monkey":  "if (true) { let inner = 1; } let outer = 2;",
+	}, []conformanceTest{
+		{`import "lib/money.monkey" as money; money.total(3)`, 300},
+		{`import "lib/money.monkey" as money; money.cents`, 100},
+		{`import "lib/money.monkey" as money; let cents = 5; [cents, money.cents]`, []int{5, 100}},
+		// Each module runs once, however many times it is imported.
+		{`import "lib/money.monkey" as a; import "lib/money.monkey" as b; [a.loaded, b.loaded]`, []int{1, 1}},
+		// Members are the values a module's names had when it finished
+		// running; assigning to the names later doesn't change them.
+		{`import "lib/money.monkey" as money; import "counter.monkey" as counter; [money.loaded, counter.count]`, []int{1, 0}},
+		{`import "counter.monkey" as counter; counter.bump(); counter.bump()`, 2},
+		{`import "counter.monkey" as counter; let f = fn() { counter.bump() }; f(); counter.count`, 0},
+		{`import "lib/shadow.monkey" as s; [s.x, s.y]`, []int{2, 2}},
+		{`import "lib/money.monkey" as money; money.nope`, errorMessage("module money.monkey has no member nope")},
+		{`import "lib/block.monkey" as b; b.inner`, errorMessage("module block.monkey has no member inner")},
+		{`import "lib/block.monkey" as b; b.outer`, 2},
+		{`let x = 1; x.y`, errorMessage("member access not supported: INTEGER")},
+	})
+}
+
+// runConformanceTestsWithModules writes files, which map paths to module
+// sources, to a new directory, and runs tests with their imports relative to
+// it.
+func runConformanceTestsWithModules(t *testing.T, files map[string]string, tests []conformanceTest) {
+	t.Helper()
+	runConformanceTestsIn(t, writeFiles(t, files), settings{arith: object.DefaultArithmetic}, tests)
+}
+
+// writeFiles writes files, keyed by their paths, to a new directory and returns
+// it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for path, src := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func runConformanceTests(t *testing.T, tests []conformanceTest) {
+	t.Helper()
+	runConformanceTestsWithOverflow(t, object.OverflowPromote, tests)
+}
+
+func runConformanceTestsWithOverflow(t *testing.T, overflow object.Overflow, tests []conformanceTest) {
+	t.Helper()
+	arith := object.DefaultArithmetic
+	arith.Overflow = overflow
+	runConformanceTestsWithArithmetic(t, arith, tests)
+}
+
+func runConformanceTestsWithArithmetic(t *testing.T, arith object.Arithmetic, tests []conformanceTest) {
+	t.Helper()
+	runConformanceTestsIn(t, "", settings{arith: arith}, tests)
+}
+
+// runConformanceTestsIn runs tests with s, loading the modules they import
+// from dir.
+func runConformanceTestsIn(t *testing.T, dir string, s settings, tests []conformanceTest) {
+	t.Helper()
+
+	for _, e := range engines {
+		for i, tt := range tests {
+			result := e.run(t, parse(t, tt.input, dir), s)
+			if result == nil {
+				t.Errorf("[%s %d] %q: got nil result", e.name, i, tt.input)
+				continue
+			}
+			checkResult(t, e.name, i, tt, result)
+		}
+	}
+}
+
+func checkResult(t *testing.T, engine string, i int, tt conformanceTest, result object.Object) {
+	t.Helper()
+
+	switch expected := tt.expected.(type) {
+	case int:
+		integer, ok := result.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("[%s %d] %q: expected %d, got %s", engine, i, tt.input, expected, result.Inspect())
+		}
+	case bool:
+		boolean, ok := result.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("[%s %d] %q: expected %t, got %s", engine, i, tt.input, expected, result.Inspect())
+		}
+	case []int:
+		array, ok := result.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("[%s %d] %q: expected %v, got %s", engine, i, tt.input, expected, result.Inspect())
+			return
+		}
+		for j, el := range array.Elements {
+			if integer, ok := el.(*object.Integer); !ok || integer.Value != int64(expected[j]) {
+				t.Errorf("[%s %d] %q: expected %v, got %s", engine, i, tt.input, expected, result.Inspect())
+				return
+			}
+		}
+	case bigInt:
+		bi, ok := result.(*object.BigInt)
+		if !ok || bi.Inspect() != string(expected) {
+			t.Errorf("[%s %d] %q: expected BigInt %s, got %s", engine, i, tt.input, expected, result.Inspect())
+		}
+	case decimal:
+		dec, ok := result.(*object.Decimal)
+		if !ok || dec.Inspect() != string(expected) {
+			t.Errorf("[%s %d] %q: expected Decimal %s, got %s", engine, i, tt.input, expected, result.Inspect())
+		}
+	case rational:
+		rat, ok := result.(*object.Rational)
+		if !ok || rat.Inspect() != string(expected) {
+			t.Errorf("[%s %d] %q: expected Rational %s, got %s", engine, i, tt.input, expected, result.Inspect())
+		}
+	case str:
+		s, ok := result.(*object.String)
+		if !ok || s.Value != string(expected) {
+			t.Errorf("[%s %d] %q: expected String %q, got %s", engine, i, tt.input, expected, result.Inspect())
+		}
+	case []string:
+		array, ok := result.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("[%s %d] %q: expected %q, got %s", engine, i, tt.input, expected, result.Inspect())
+			return
+		}
+		for j, el := range array.Elements {
+			if s, ok := el.(*object.String); !ok || s.Value != expected[j] {
+				t.Errorf("[%s %d] %q: expected %q, got %s", engine, i, tt.input, expected, result.Inspect())
+				return
+			}
+		}
+	case errorMessage:
+		errobj, ok := result.(*object.Error)
+		if !ok || errobj.Message != string(expected) {
+			t.Errorf("[%s %d] %q: expected error %q, got %s", engine, i, tt.input, expected, result.Inspect())
+		}
+	case exitCode:
+		errobj, ok := result.(*object.Error)
+		if !ok || errobj.Exit == nil || errobj.Exit.Code != int(expected) {
+			t.Errorf("[%s %d] %q: expected exit %d, got %s", engine, i, tt.input, expected, result.Inspect())
+		}
+	case nil:
+		if result != object.NULL_OBJ {
+			t.Errorf("[%s %d] %q: expected null, got %s", engine, i, tt.input, result.Inspect())
+		}
+	default:
+		t.Fatalf("[%s %d] unhandled expected type %T", engine, i, tt.expected)
+	}
+}
+
+func runEval(t testing.TB, program *ast.Program, s settings) object.Object {
+	env := object.NewEnvironment(program.NumSlots)
+	env.Arithmetic = s.arith
+	env.Permissions = s.perms
+	env.Args = argsArray(s.args)
+	return eval.Eval(program, env)
+}
+
+func runVM(t testing.TB, program *ast.Program, s settings) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error on %s: %s", program.String(), err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.Arithmetic = s.arith
+	machine.Permissions = s.perms
+	machine.Args = argsArray(s.args)
+	if err := machine.Run(); err != nil {
+		if rterr, ok := err.(*object.Error); ok {
+			return rterr
+		}
+		t.Fatalf("vm error on %s: %s", program.String(), err)
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+// argsArray returns args as the array a program refers to them by, or nil if
+// there aren't any, which engines treat as an empty array.
+func argsArray(args []string) *object.Array {
+	if args == nil {
+		return nil
+	}
+	array := &object.Array{Elements: []object.Object{}}
+	for _, arg := range args {
+		array.Elements = append(array.Elements, &object.String{Value: arg})
+	}
+	return array
+}
+
+// parse parses and resolves input, loading the modules it imports from dir.
+func parse(t testing.TB, input string, dir string) *ast.Program {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+
+	if p.HasErrors() {
+		for _, perr := range p.Errors() {
+			t.Errorf("parser error: %s", perr.String())
+		}
+		t.FailNow()
+	}
+
+	if errs := loader.New().Import(program, dir); len(errs) > 0 {
+		for _, lerr := range errs {
+			t.Errorf("%s error: %s", lerr.Kind, lerr.String())
+		}
+		t.FailNow()
+	}
+
+	if errs := resolver.New().Resolve(program); len(errs) > 0 {
+		for _, rerr := range errs {
+			t.Errorf("resolver error: %s", rerr.String())
+		}
+		t.FailNow()
+	}
+
+	return program
+}
+
+// benchmarks are programs whose inner loops the engines are timed on.
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	{"loop", "let i = 0; let sum = 0; while (i < 100000) { sum += i % 7; i += 1; } sum"},
+	{"loop-in-fn", "let f = fn() { let i = 0; let sum = 0; while (i < 100000) { sum += i % 7; i += 1; } sum }; f()"},
+	{"for-in", "let sum = 0; for (x in [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]) { for (y in [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]) { sum += x * y; } } sum"},
+	{"fib", "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)"},
+}
+
+func BenchmarkEngines(b *testing.B) {
+	for _, bm := range benchmarks {
+		for _, e := range engines {
+			b.Run(bm.name+"/"+e.name, func(b *testing.B) {
+				program := parse(b, bm.input, "")
+				s := settings{arith: object.DefaultArithmetic}
+				for i := 0; i < b.N; i++ {
+					if result := e.run(b, program, s); result.Type() == object.O_ERROR {
+						b.Fatalf("%s", result.Inspect())
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package conformance holds the tests that every Monkey engine (the
+// tree-walking evaluator and the VM) must pass with identical results.
+package conformance
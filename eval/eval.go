@@ -1,59 +1,576 @@
 package eval
 
 import (
+	"fmt"
+
 	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/builtins"
+	"github.com/MichaelDiBernardo/monkey/lexer"
 	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/resolver"
 	"github.com/MichaelDiBernardo/monkey/token"
 )
 
-func Eval(root ast.Node) object.Object {
+// Eval evaluates the AST rooted at root in env, and returns the resulting
+// value. Runtime errors are returned as *object.Error. root must have been
+// resolved by the resolver package, and env must hold the globals of any
+// programs resolved before it by the same resolver. Macros must be expanded,
+// with DefineMacros and ExpandMacros, before root is resolved.
+func Eval(root ast.Node, env *object.Environment) object.Object {
 	switch node := root.(type) {
 	case *ast.Program:
-		return evalStatements(node.Statements)
+		return evalStatements(node.Statements, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Value)
+		return Eval(node.Value, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node.Statements, env)
+	case *ast.ReturnStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Binding, val)
+		return object.NULL_OBJ
+	case *ast.ImportStatement:
+		mod := evalImportStatement(node, env)
+		if isError(mod) {
+			return mod
+		}
+		env.Set(node.Name.Binding, mod)
+		return object.NULL_OBJ
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return object.BREAK_OBJ
+	case *ast.ContinueStatement:
+		return object.CONTINUE_OBJ
 	case *ast.PrefixExpression:
-		return evalPrefixExpression(node)
+		return evalPrefixExpression(node, env)
+	case *ast.InfixExpression:
+		return evalInfixExpression(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.DecimalLiteral:
+		return &object.Decimal{Value: node.Value, Scale: node.Scale}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
 	case *ast.BooleanLiteral:
-		if node.Value {
-			return object.TRUE_OBJ
+		return object.NativeBoolToBooleanObject(node.Value)
+	case *ast.ArrayLiteral:
+		return evalArrayLiteral(node, env)
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		return evalIndexExpression(node, env)
+	case *ast.MemberExpression:
+		return evalMemberExpression(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env, NumSlots: node.NumSlots}
+	case *ast.MacroLiteral:
+		return newError(node.MacroToken.Location, "macros can only be defined by a let at the top level")
+	case *ast.CallExpression:
+		if node.CalleeName() == "quote" {
+			return evalQuote(node, env)
 		}
-		return object.FALSE_OBJ
+		return evalCallExpression(node, env)
 	}
 	return nil
 }
 
-func evalStatements(statements []ast.Statement) object.Object {
-	var val object.Object = &object.Null{}
+// Importer loads the modules that the import statements in program refer to,
+// as loader.Loader's Import does, returning the errors that stopped it.
+type Importer func(program *ast.Program) []error
+
+// EvalString parses src, expands its macros, resolves it and evaluates it in a
+// new environment with the default arithmetic and no permissions. If src can't
+// be run, the errors that stopped it are returned: *parser.ParseError,
+// *object.Error for macros or *resolver.ResolveError. A runtime error is
+// returned both as the *object.Error value, as Eval returns it, and in the
+// errors. A program that calls exit returns an *object.Error whose Exit is set,
+// which isn't an error. src can't import modules; see EvalStringWithImporter.
+func EvalString(src string) (object.Object, []error) {
+	return EvalStringWithImporter(src, nil)
+}
+
+// EvalStringWithImporter is EvalString for a src that imports modules, which
+// are loaded with importer after its macros are expanded. The importer's
+// errors are returned if it fails. If importer is nil, src can't import
+// modules.
+func EvalStringWithImporter(src string, importer Importer) (object.Object, []error) {
+	p := parser.New(lexer.NewFromString(src))
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		errs := []error{}
+		for _, perr := range p.Errors() {
+			perr := perr
+			errs = append(errs, &perr)
+		}
+		return nil, errs
+	}
+
+	macros := Macros{}
+	merrs := DefineMacros(program, macros)
+	if len(merrs) == 0 {
+		merrs = ExpandMacros(program, macros)
+	}
+	if len(merrs) > 0 {
+		errs := []error{}
+		for _, merr := range merrs {
+			errs = append(errs, merr)
+		}
+		return nil, errs
+	}
+
+	if importer != nil {
+		if errs := importer(program); len(errs) > 0 {
+			return nil, errs
+		}
+	}
+
+	if rerrs := resolver.New().Resolve(program); len(rerrs) > 0 {
+		errs := []error{}
+		for _, rerr := range rerrs {
+			rerr := rerr
+			errs = append(errs, &rerr)
+		}
+		return nil, errs
+	}
+
+	evaled := Eval(program, object.NewEnvironment(program.NumSlots))
+	if rterr, ok := evaled.(*object.Error); ok && rterr.Exit == nil {
+		return evaled, []error{rterr}
+	}
+	return evaled, nil
+}
+
+func evalStatements(statements []ast.Statement, env *object.Environment) object.Object {
+	var val object.Object = object.NULL_OBJ
 
 	for _, s := range statements {
-		val = Eval(s)
+		val = Eval(s, env)
+
+		switch result := val.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
 	}
 
 	return val
 }
 
-func evalPrefixExpression(node *ast.PrefixExpression) object.Object {
-	rhsval := Eval(node.RHS)
-	switch node.OperatorToken.Type {
-	case token.BANG:
-		return evalBangOperatorExpression(rhsval)
+// evalBlockStatement is like evalStatements, but leaves return values wrapped so
+// that they keep unwinding through any enclosing blocks. Breaks and continues
+// unwind the same way, up to the loop they're in.
+func evalBlockStatement(statements []ast.Statement, env *object.Environment) object.Object {
+	var val object.Object = object.NULL_OBJ
+
+	for _, s := range statements {
+		val = Eval(s, env)
+
+		if val == nil {
+			continue
+		}
+		switch val.Type() {
+		case object.O_RETURN_VALUE, object.O_ERROR, object.O_BREAK, object.O_CONTINUE:
+			return val
+		}
+	}
+
+	return val
+}
+
+// evalWhileStatement runs a while loop. Loops are run iteratively, so that
+// they don't grow the Go stack however many times they go around.
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !ops.IsTruthy(condition) {
+			return object.NULL_OBJ
+		}
+
+		if val, done := evalLoopBody(node.Body, env); done {
+			return val
+		}
+	}
+}
+
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	elements, err := ops.Elements(iterable)
+	if err != nil {
+		return newError(node.Iterable.Token().Location, "%s", err)
+	}
+
+	for _, el := range elements {
+		env.Set(node.Variable.Binding, el)
+
+		if val, done := evalLoopBody(node.Body, env); done {
+			return val
+		}
+	}
+
+	return object.NULL_OBJ
+}
+
+// evalLoopBody runs one iteration of a loop. If the loop should stop, it
+// returns true along with the value that the loop should evaluate to.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	val := Eval(body, env)
+	if val == nil {
+		return nil, false
+	}
+
+	switch val.Type() {
+	case object.O_RETURN_VALUE, object.O_ERROR:
+		return val, true
+	case object.O_BREAK:
+		return object.NULL_OBJ, true
 	default:
+		return nil, false
+	}
+}
+
+func evalArrayLiteral(node *ast.ArrayLiteral, env *object.Environment) object.Object {
+	elements := []object.Object{}
+	for _, el := range node.Elements {
+		val := Eval(el, env)
+		if isError(val) {
+			return val
+		}
+		elements = append(elements, val)
+	}
+	return &object.Array{Elements: elements}
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	for i, k := range node.Keys {
+		keyval := Eval(k, env)
+		if isError(keyval) {
+			return keyval
+		}
+
+		key, err := ops.HashKey(keyval)
+		if err != nil {
+			return newError(node.LBToken.Location, "%s", err)
+		}
+
+		val := Eval(node.Values[i], env)
+		if isError(val) {
+			return val
+		}
+		hash.Set(key, val)
+	}
+	return hash
+}
+
+func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) object.Object {
+	container := Eval(node.Left, env)
+	if isError(container) {
+		return container
+	}
+
+	index := Eval(node.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	val, err := ops.Index(container, index)
+	if err != nil {
+		return newError(node.LBToken.Location, "%s", err)
+	}
+	return val
+}
+
+// evalImportStatement returns the module that node imports. A module is run in
+// an environment of its own the first time it is imported; later imports of it,
+// from any file, share the same members.
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	mod := node.Module
+	if mod == nil {
+		return newError(node.ImportToken.Location, "module %s was not loaded", node.Path)
+	}
+	if loaded, ok := env.Modules[mod.Path]; ok {
+		return loaded
+	}
+
+	modenv := object.NewEnvironment(mod.Program.NumSlots)
+	modenv.Arithmetic = env.Arithmetic
+	modenv.Permissions = env.Permissions
+	modenv.Args = env.Args
+	modenv.Modules = env.Modules
+
+	if val := Eval(mod.Program, modenv); isError(val) {
+		return val
+	}
+
+	loaded := &object.Module{Path: mod.Path, Members: map[string]object.Object{}}
+	for _, name := range mod.Exports() {
+		if val, ok := modenv.Get(name.Binding); ok {
+			loaded.Members[name.Value] = val
+		}
+	}
+	env.Modules[mod.Path] = loaded
+	return loaded
+}
+
+func evalMemberExpression(node *ast.MemberExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	val, err := ops.Member(left, node.Member.Value)
+	if err != nil {
+		return newError(node.DotToken.Location, "%s", err)
+	}
+	return val
+}
+
+func evalPrefixExpression(node *ast.PrefixExpression, env *object.Environment) object.Object {
+	rhsval := Eval(node.RHS, env)
+	if isError(rhsval) {
+		return rhsval
+	}
+
+	val, err := ops.Prefix(node.OperatorToken.Type, rhsval, env.Arithmetic)
+	if err != nil {
+		return newError(node.OperatorToken.Location, "%s", err)
+	}
+	return val
+}
+
+func evalInfixExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	lhsval := Eval(node.LHS, env)
+	if isError(lhsval) {
+		return lhsval
+	}
+
+	// && and || only evaluate their right-hand side if the left-hand side
+	// doesn't already decide the result.
+	switch node.OperatorToken.Type {
+	case token.AND, token.OR:
+		if ops.IsTruthy(lhsval) == (node.OperatorToken.Type == token.OR) {
+			return object.NativeBoolToBooleanObject(ops.IsTruthy(lhsval))
+		}
+		rhsval := Eval(node.RHS, env)
+		if isError(rhsval) {
+			return rhsval
+		}
+		return object.NativeBoolToBooleanObject(ops.IsTruthy(rhsval))
+	}
+
+	rhsval := Eval(node.RHS, env)
+	if isError(rhsval) {
+		return rhsval
+	}
+
+	val, err := ops.Infix(node.OperatorToken.Type, lhsval, rhsval, env.Arithmetic)
+	if err != nil {
+		return newError(node.OperatorToken.Location, "%s", err)
+	}
+	return val
+}
+
+// evalAssignExpression stores a new value in the binding or element that node
+// assigns to, and returns the value. The target's container and index are
+// evaluated before the value.
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		if !target.Binding.Resolved {
+			return newError(target.IdentToken.Location, "cannot assign to undeclared identifier: %s", target.Value)
+		}
+
+		val := evalAssignedValue(node, env, func() object.Object {
+			return evalIdentifier(target, env)
+		})
+		if isError(val) {
+			return val
+		}
+		return env.Set(target.Binding, val)
+
+	case *ast.IndexExpression:
+		container := Eval(target.Left, env)
+		if isError(container) {
+			return container
+		}
+
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		val := evalAssignedValue(node, env, func() object.Object {
+			current, err := ops.Index(container, index)
+			if err != nil {
+				return newError(target.LBToken.Location, "%s", err)
+			}
+			return current
+		})
+		if isError(val) {
+			return val
+		}
+
+		if err := ops.SetIndex(container, index, val); err != nil {
+			return newError(target.LBToken.Location, "%s", err)
+		}
+		return val
+	}
+
+	return newError(node.OperatorToken.Location, "cannot assign to %s", node.Target.String())
+}
+
+// evalAssignedValue evaluates the value that node assigns. A compound
+// assignment applies its operator to the target's value, as returned by
+// current, and the value on its right.
+func evalAssignedValue(node *ast.AssignExpression, env *object.Environment, current func() object.Object) object.Object {
+	op, ok := ops.Compound[node.OperatorToken.Type]
+	if !ok {
+		return Eval(node.Value, env)
+	}
+
+	lhsval := current()
+	if isError(lhsval) {
+		return lhsval
+	}
+
+	rhsval := Eval(node.Value, env)
+	if isError(rhsval) {
+		return rhsval
+	}
+
+	val, err := ops.Infix(op, lhsval, rhsval, env.Arithmetic)
+	if err != nil {
+		return newError(node.OperatorToken.Location, "%s", err)
+	}
+	return val
+}
+
+func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(node.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if ops.IsTruthy(condition) {
+		return Eval(node.Consequence, env)
+	} else if node.Alternative != nil {
+		return Eval(node.Alternative, env)
+	} else {
 		return object.NULL_OBJ
 	}
 }
 
-func evalBangOperatorExpression(rhsval object.Object) object.Object {
-	switch rhsval {
-	case object.TRUE_OBJ:
-		return object.FALSE_OBJ
-	case object.FALSE_OBJ:
-		return object.TRUE_OBJ
-	case object.NULL_OBJ:
-		return object.TRUE_OBJ
-	default:
-		return object.FALSE_OBJ
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if !node.Binding.Resolved {
+		return newError(node.IdentToken.Location, "identifier not found: %s", node.Value)
+	}
+	if node.Binding.Builtin {
+		if b := builtins.Builtins[node.Binding.Slot]; b != builtins.Args {
+			return b
+		}
+		if env.Args == nil {
+			return &object.Array{Elements: []object.Object{}}
+		}
+		return env.Args
+	}
+
+	// The resolver only lets a name be used before it is bound from inside a
+	// function, which might be called before the binding has run.
+	val, ok := env.Get(node.Binding)
+	if !ok {
+		return newError(node.IdentToken.Location, "identifier used before definition: %s", node.Value)
+	}
+	return val
+}
+
+func evalCallExpression(node *ast.CallExpression, env *object.Environment) object.Object {
+	function := Eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+
+	args := []object.Object{}
+	for _, a := range node.Arguments {
+		val := Eval(a, env)
+		if isError(val) {
+			return val
+		}
+		args = append(args, val)
+	}
+
+	return applyFunction(node.LPToken.Location, function, args, env)
+}
+
+// applyFunction calls fnobj with args. Builtins are passed the arithmetic
+// settings and permissions of env, the caller's environment.
+func applyFunction(loc token.Location, fnobj object.Object, args []object.Object, env *object.Environment) object.Object {
+	if builtin, ok := fnobj.(*object.Builtin); ok {
+		val, err := builtin.Fn(env.Arithmetic, env.Permissions, args...)
+		if exit, ok := err.(*object.Exit); ok {
+			return &object.Error{Message: exit.Error(), Location: loc, Exit: exit}
+		}
+		if err != nil {
+			return newError(loc, "%s", err)
+		}
+		return val
+	}
+
+	fn, ok := fnobj.(*object.Function)
+	if !ok {
+		return newError(loc, "not a function: %s", fnobj.Type())
+	}
+
+	if want, got := len(fn.Parameters), len(args); want != got {
+		return newError(loc, "wrong number of arguments: want=%d, got=%d", want, got)
+	}
+
+	fnenv := object.NewEnclosedEnvironment(fn.Env, fn.NumSlots)
+	for i, param := range fn.Parameters {
+		fnenv.Set(param.Binding, args[i])
+	}
+
+	val := Eval(fn.Body, fnenv)
+
+	if rv, ok := val.(*object.ReturnValue); ok {
+		return rv.Value
 	}
+	return val
+}
+
+func newError(loc token.Location, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Location: loc}
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.O_ERROR
 }
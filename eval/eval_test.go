@@ -1,11 +1,14 @@
 package eval
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/MichaelDiBernardo/monkey/ast"
 	"github.com/MichaelDiBernardo/monkey/lexer"
 	"github.com/MichaelDiBernardo/monkey/object"
 	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/resolver"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -50,6 +53,165 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestFunctionObject(t *testing.T) {
+	result := evalProgram(t, "fn(x) { x + 2; };")
+
+	fn, ok := result.(*object.Function)
+	if !ok {
+		t.Fatalf("expected *object.Function, got %T", result)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("expected 1 parameter, got %d", len(fn.Parameters))
+	}
+
+	if exp, act := "x", fn.Parameters[0].String(); exp != act {
+		t.Errorf("expected parameter %q, got %q", exp, act)
+	}
+
+	if exp, act := "{(x + 2)}", fn.Body.String(); exp != act {
+		t.Errorf("expected body %q, got %q", exp, act)
+	}
+}
+
+func TestErrorLocations(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"5 + true", "type mismatch: INTEGER + BOOLEAN", 1, 3},
+		{"let x = 1;\n-true", "unknown operator: -BOOLEAN", 2, 1},
+		{"let f = fn() {\n  g\n};\nf();\nlet g = 1;", "identifier used before definition: g", 2, 3},
+		{"let f = fn(x) { x };\nf(1, 2)", "wrong number of arguments: want=1, got=2", 2, 2},
+		{"let f = fn(x) { x > true };\nf(1)", "type mismatch: INTEGER > BOOLEAN", 1, 19},
+		{"for (x in\n  true) { x }", "cannot iterate over BOOLEAN", 2, 3},
+		{"let x = true;\nx += 1", "type mismatch: BOOLEAN + INTEGER", 2, 3},
+		{"let xs = [1];\nxs[1] = 2", "index out of range: 1", 2, 3},
+		{"let h = {[1]: 2}", "unusable as hash key: ARRAY", 1, 9},
+		{"let x = 1;\nx / (x - 1)", "division by zero", 2, 3},
+		{"let big = 9223372036854775807 + 1;\nbig %\n  0", "division by zero", 2, 5},
+		{"let s = \"a\";\nstrings.split(\n  s, 1)", "argument 2 to strings.split must be STRING, got INTEGER", 2, 14},
+	}
+
+	for i, tt := range tests {
+		result := evalProgram(t, tt.input)
+
+		errobj, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("[%d] expected *object.Error, got %T", i, result)
+			continue
+		}
+
+		if errobj.Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, errobj.Message)
+		}
+
+		if loc := errobj.Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestEnvironmentIsShared(t *testing.T) {
+	env := object.NewEnvironment(0)
+	r := resolver.New()
+
+	var result object.Object
+	for _, input := range []string{"let x = 5;", "let y = x * 2;", "y"} {
+		p := parser.New(lexer.NewFromString(input))
+		program := p.ParseProgram()
+		if errs := r.Resolve(program); len(errs) > 0 {
+			t.Fatalf("resolver errors on %q: %v", input, errs)
+		}
+		result = Eval(program, env)
+	}
+
+	testIntegerResult(t, result, 10)
+}
+
+func TestUnresolvedIdentifier(t *testing.T) {
+	p := parser.New(lexer.NewFromString("let x = 1; x"))
+	result := Eval(p.ParseProgram(), object.NewEnvironment(0))
+
+	errobj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("expected *object.Error, got %T", result)
+	}
+	if exp := "identifier not found: x"; errobj.Message != exp {
+		t.Errorf("expected message %q, got %q", exp, errobj.Message)
+	}
+}
+
+func TestEvalStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{"let = 1;", &parser.ParseError{}},
+		{"let m = macro(x) { 1 }; m(2);", &object.Error{}},
+		{"x + 1", &resolver.ResolveError{}},
+	}
+
+	for _, tt := range tests {
+		evaled, errs := EvalString(tt.input)
+		if evaled != nil || len(errs) == 0 {
+			t.Errorf("%q: expected errors, got %v and %v", tt.input, evaled, errs)
+			continue
+		}
+		if exp, act := fmt.Sprintf("%T", tt.expected), fmt.Sprintf("%T", errs[0]); exp != act {
+			t.Errorf("%q: expected %s, got %s: %v", tt.input, exp, act, errs[0])
+		}
+	}
+
+	// Runtime errors are values, as they are from Eval, and errors.
+	evaled, errs := EvalString("1 / 0")
+	errobj, ok := evaled.(*object.Error)
+	if !ok {
+		t.Fatalf("expected *object.Error, got %T", evaled)
+	}
+	if len(errs) != 1 || errs[0] != error(errobj) {
+		t.Errorf("expected the runtime error in errs, got %v", errs)
+	}
+
+	// Exiting isn't an error.
+	evaled, errs = EvalString("exit(3)")
+	if errobj, ok := evaled.(*object.Error); !ok || errobj.Exit == nil || errobj.Exit.Code != 3 {
+		t.Errorf("expected exit 3, got %v", evaled)
+	}
+	if len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+func TestEvalStringWithImporter(t *testing.T) {
+	mod := parseProgram(t, "let two = 2;")
+	if errs := resolver.New().Resolve(mod); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	importer := func(program *ast.Program) []error {
+		imp := program.Statements[0].(*ast.ImportStatement)
+		if imp.Path != "two.monkey" {
+			return []error{fmt.Errorf("cannot find %s", imp.Path)}
+		}
+		imp.Module = &ast.Module{Path: "/src/two.monkey", Program: mod}
+		return nil
+	}
+
+	evaled, errs := EvalStringWithImporter(`import "two.monkey" as lib; lib.two + 1`, importer)
+	if len(errs) > 0 {
+		t.Fatalf("EvalStringWithImporter errors: %v", errs)
+	}
+	testIntegerResult(t, evaled, 3)
+
+	evaled, errs = EvalStringWithImporter(`import "three.monkey" as lib; lib.three`, importer)
+	if evaled != nil || len(errs) != 1 || errs[0].Error() != "cannot find three.monkey" {
+		t.Errorf("expected the importer's error, got %v and %v", evaled, errs)
+	}
+}
+
 func testIntegerResult(t *testing.T, result object.Object, expected int64) bool {
 	intobj, ok := result.(*object.Integer)
 
@@ -80,17 +242,14 @@ func testBooleanResult(t *testing.T, result object.Object, expected bool) bool {
 	return true
 }
 
+// evalProgram runs input, which must run, and returns its value. Runtime
+// errors are returned as values.
 func evalProgram(t *testing.T, input string) object.Object {
-	l := lexer.NewFromString(input)
-	p := parser.New(l)
-
-	program := p.ParseProgram()
-	failIfParserHasErrors(t, p)
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil")
+	evaled, errs := EvalString(input)
+	if evaled == nil {
+		t.Fatalf("EvalString errors: %v", errs)
 	}
-
-	return Eval(program)
+	return evaled
 }
 
 func failIfParserHasErrors(t *testing.T, p *parser.Parser) {
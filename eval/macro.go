@@ -0,0 +1,188 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/resolver"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// Macros are the macros that a program has defined, by name.
+type Macros map[string]*object.Macro
+
+// DefineMacros removes each top-level `let name = macro(...) { ... };` from
+// program and adds the macro to macros. Macro bodies can only refer to their
+// own parameters and locals, since they are run before the program is.
+func DefineMacros(program *ast.Program, macros Macros) []*object.Error {
+	errs := []*object.Error{}
+	stmts := []ast.Statement{}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			stmts = append(stmts, stmt)
+			continue
+		}
+		lit, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			stmts = append(stmts, stmt)
+			continue
+		}
+
+		body := &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Value: lit}}}
+		if rerrs := resolver.New().Resolve(body); len(rerrs) > 0 {
+			for _, rerr := range rerrs {
+				errs = append(errs, newError(rerr.Location, "%s", rerr.Message))
+			}
+			continue
+		}
+
+		macros[let.Name.Value] = &object.Macro{
+			Parameters: lit.Parameters,
+			Body:       lit.Body,
+			Env:        object.NewEnvironment(0),
+			NumSlots:   lit.NumSlots,
+		}
+	}
+
+	program.Statements = stmts
+	return errs
+}
+
+// MaxMacroDepth is how deeply macro calls may be nested in the code that
+// other macros return, so that a macro that always returns a call to itself
+// is reported rather than expanded forever.
+const MaxMacroDepth = 100
+
+// ExpandMacros replaces each call to a macro in program with the code that
+// the macro returns for it. The macro is called with its arguments quoted,
+// and must return a quote. The calls to macros in the returned code are
+// expanded in turn. Errors are reported at the location of the call.
+func ExpandMacros(program *ast.Program, macros Macros) []*object.Error {
+	errs := []*object.Error{}
+	expandMacroCalls(program, macros, 0, &errs)
+	return errs
+}
+
+// expandMacroCalls expands the calls to macros in node, which is code that
+// depth macros have returned, and returns the expanded node.
+func expandMacroCalls(node ast.Node, macros Macros, depth int, errs *[]*object.Error) ast.Node {
+	return ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		macro, ok := macros[call.CalleeName()]
+		if !ok {
+			return node
+		}
+
+		if depth >= MaxMacroDepth {
+			*errs = append(*errs, newError(call.LPToken.Location, "macro %s is nested more than %d expansions deep", call.CalleeName(), MaxMacroDepth))
+			return node
+		}
+
+		expanded, err := expandMacro(call, macro)
+		if err != nil {
+			*errs = append(*errs, err)
+			return node
+		}
+		return expandMacroCalls(expanded, macros, depth+1, errs)
+	})
+}
+
+func expandMacro(call *ast.CallExpression, macro *object.Macro) (ast.Node, *object.Error) {
+	loc := call.LPToken.Location
+	name := call.CalleeName()
+
+	if want, got := len(macro.Parameters), len(call.Arguments); want != got {
+		return nil, newError(loc, "wrong number of arguments to macro %s: want=%d, got=%d", name, want, got)
+	}
+
+	env := object.NewEnclosedEnvironment(macro.Env, macro.NumSlots)
+	for i, param := range macro.Parameters {
+		env.Set(param.Binding, &object.Quote{Node: call.Arguments[i]})
+	}
+
+	val := Eval(macro.Body, env)
+	if rv, ok := val.(*object.ReturnValue); ok {
+		val = rv.Value
+	}
+
+	switch val := val.(type) {
+	case *object.Error:
+		return nil, newError(loc, "error expanding macro %s: %s", name, val.Message)
+	case *object.Quote:
+		return val.Node, nil
+	default:
+		return nil, newError(loc, "macro %s must return a QUOTE, got %s", name, val.Type())
+	}
+}
+
+// evalQuote returns the argument of a call to quote without evaluating it,
+// except for the calls to unquote inside it, which are replaced by their
+// values.
+func evalQuote(node *ast.CallExpression, env *object.Environment) object.Object {
+	if len(node.Arguments) != 1 {
+		return newError(node.LPToken.Location, "wrong number of arguments to quote: want=1, got=%d", len(node.Arguments))
+	}
+
+	var err *object.Error
+	quoted := ast.Modify(ast.Copy(node.Arguments[0]), func(n ast.Node) ast.Node {
+		call, ok := n.(*ast.CallExpression)
+		if !ok || call.CalleeName() != "unquote" || err != nil {
+			return n
+		}
+
+		if len(call.Arguments) != 1 {
+			err = newError(call.LPToken.Location, "wrong number of arguments to unquote: want=1, got=%d", len(call.Arguments))
+			return n
+		}
+
+		val := Eval(call.Arguments[0], env)
+		if e, ok := val.(*object.Error); ok {
+			err = e
+			return n
+		}
+
+		var unquoted ast.Node
+		unquoted, err = objectToNode(call.LPToken.Location, val)
+		return unquoted
+	})
+
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: quoted}
+}
+
+// objectToNode converts the value of an unquote back into source, located at
+// loc.
+func objectToNode(loc token.Location, obj object.Object) (ast.Node, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		tok := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value), Location: loc}
+		return &ast.IntegerLiteral{IntToken: tok, Value: obj.Value}, nil
+	case *object.BigInt:
+		tok := token.Token{Type: token.INT, Literal: obj.Value.String(), Location: loc}
+		return &ast.IntegerLiteral{IntToken: tok, Big: obj.Value}, nil
+	case *object.Decimal:
+		tok := token.Token{Type: token.DECIMAL, Literal: obj.Inspect(), Location: loc}
+		return &ast.DecimalLiteral{DecimalToken: tok, Value: obj.Value, Scale: obj.Scale}, nil
+	case *object.String:
+		tok := token.Token{Type: token.STRING, Literal: obj.Value, Location: loc}
+		return &ast.StringLiteral{StringToken: tok, Value: obj.Value}, nil
+	case *object.Boolean:
+		tok := token.Token{Type: token.FALSE, Literal: "false", Location: loc}
+		if obj.Value {
+			tok = token.Token{Type: token.TRUE, Literal: "true", Location: loc}
+		}
+		return &ast.BooleanLiteral{BoolToken: tok, Value: obj.Value}, nil
+	case *object.Quote:
+		return ast.Copy(obj.Node), nil
+	default:
+		return nil, newError(loc, "cannot unquote %s", obj.Type())
+	}
+}
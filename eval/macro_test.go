@@ -0,0 +1,221 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/resolver"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"quote(5)", "5"},
+		{"quote(5 + 8)", "(5 + 8)"},
+		{"quote(foobar)", "foobar"},
+		{"quote(foobar + barfoo)", "(foobar + barfoo)"},
+		{"quote(unquote(4 + 4))", "8"},
+		{"quote(8 + unquote(4 + 4))", "(8 + 8)"},
+		{"let foobar = 8; quote(unquote(foobar))", "8"},
+		{"quote(unquote(true == false))", "false"},
+		{"quote(unquote(quote(4 + 4)))", "(4 + 4)"},
+		{"let q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))", "(8 + (4 + 4))"},
+		{"let f = fn(x) { quote(x + unquote(x)) }; f(1)", "(x + 1)"},
+	}
+
+	for i, tt := range tests {
+		result := evalProgram(t, tt.input)
+
+		quote, ok := result.(*object.Quote)
+		if !ok {
+			t.Errorf("[%d] expected *object.Quote, got %T (%v)", i, result, result)
+			continue
+		}
+
+		if act := quote.Node.String(); act != tt.expected {
+			t.Errorf("[%d] expected %q, got %q", i, tt.expected, act)
+		}
+	}
+}
+
+func TestQuoteDoesNotModifySource(t *testing.T) {
+	result := evalProgram(t, "let f = fn(x) { quote(unquote(x)) }; f(1); f(2)")
+
+	quote, ok := result.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote, got %T", result)
+	}
+	if act := quote.Node.String(); act != "2" {
+		t.Errorf("expected %q, got %q", "2", act)
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+let number = 1;
+let function = fn(x, y) { x + y };
+let mymacro = macro(x, y) { x + y; };
+`
+	program := parseProgram(t, input)
+	macros := Macros{}
+
+	if errs := DefineMacros(program, macros); len(errs) > 0 {
+		t.Fatalf("macro errors: %v", errs)
+	}
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Statements))
+	}
+
+	macro, ok := macros["mymacro"]
+	if !ok {
+		t.Fatalf("macro not defined")
+	}
+
+	if len(macro.Parameters) != 2 || macro.Parameters[0].Value != "x" || macro.Parameters[1].Value != "y" {
+		t.Errorf("unexpected macro parameters %v", macro.Parameters)
+	}
+
+	if exp, act := "{(x + y)}", macro.Body.String(); exp != act {
+		t.Errorf("expected body %q, got %q", exp, act)
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let infix = macro() { quote(1 + 2) }; infix()",
+			"(1 + 2)",
+		},
+		{
+			"let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) }; reverse(2 + 2, 10 - 5)",
+			"((10 - 5) - (2 + 2))",
+		},
+		{
+			`let unless = macro(cond, cons, alt) {
+				quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) })
+			};
+			unless(10 > 5, a, b)`,
+			"if (!(10 > 5)) { a } else { b }",
+		},
+		{
+			"let twice = macro(x) { quote(unquote(x) * 2) }; twice(twice(3))",
+			"((3 * 2) * 2)",
+		},
+		{
+			`let id = macro(x) { x };
+			let twice = macro(x) { quote(id(unquote(x)) + id(unquote(x))) };
+			twice(2)`,
+			"(2 + 2)",
+		},
+	}
+
+	for i, tt := range tests {
+		program := parseProgram(t, tt.input)
+		expected := parseProgram(t, tt.expected)
+
+		macros := Macros{}
+		errs := DefineMacros(program, macros)
+		errs = append(errs, ExpandMacros(program, macros)...)
+		if len(errs) > 0 {
+			t.Errorf("[%d] macro errors: %v", i, errs)
+			continue
+		}
+
+		if exp, act := expected.String(), program.String(); exp != act {
+			t.Errorf("[%d] expected %q, got %q", i, exp, act)
+		}
+	}
+}
+
+func TestExpandedMacrosRun(t *testing.T) {
+	input := `
+let unless = macro(cond, cons, alt) {
+	quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) })
+};
+let f = fn(x) { unless(x > 5, x * 2, x) };
+f(3) + f(10)
+`
+	program := parseProgram(t, input)
+
+	macros := Macros{}
+	if errs := DefineMacros(program, macros); len(errs) > 0 {
+		t.Fatalf("macro errors: %v", errs)
+	}
+	if errs := ExpandMacros(program, macros); len(errs) > 0 {
+		t.Fatalf("macro errors: %v", errs)
+	}
+
+	if errs := resolver.New().Resolve(program); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	result := Eval(program, object.NewEnvironment(program.NumSlots))
+	testIntegerResult(t, result, 16)
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"let m = macro(x) { x };\nm(1, 2)", "wrong number of arguments to macro m: want=1, got=2", 2, 2},
+		{"let m = macro(x) { 1 };\n  m(2)", "macro m must return a QUOTE, got INTEGER", 2, 4},
+		{"let m = macro(x) { -true };\nm(2)", "error expanding macro m: unknown operator: -BOOLEAN", 2, 2},
+		{"let m = macro(x) { quote(unquote(fn() { 1 })) };\nm(2)", "error expanding macro m: cannot unquote FUNCTION", 2, 2},
+		{"let y = 1;\nlet m = macro(x) { y };", "identifier not found: y", 2, 20},
+		{"let m = macro(x) {\n quote(m(unquote(x)))\n};\nm(1)", "macro m is nested more than 100 expansions deep", 2, 9},
+	}
+
+	for i, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		macros := Macros{}
+		errs := DefineMacros(program, macros)
+		if len(errs) == 0 {
+			errs = ExpandMacros(program, macros)
+		}
+
+		if len(errs) != 1 {
+			t.Errorf("[%d] expected 1 error, got %v", i, errs)
+			continue
+		}
+
+		if errs[0].Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, errs[0].Message)
+		}
+
+		if loc := errs[0].Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestMacroOutsideTopLevelLet(t *testing.T) {
+	result := evalProgram(t, "let f = fn() { macro(x) { x } }; f()")
+
+	errobj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("expected *object.Error, got %T", result)
+	}
+	if exp := "macros can only be defined by a let at the top level"; errobj.Message != exp {
+		t.Errorf("expected message %q, got %q", exp, errobj.Message)
+	}
+}
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+	failIfParserHasErrors(t, p)
+	return program
+}
@@ -3,6 +3,9 @@ package lexer
 import (
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/MichaelDiBernardo/monkey/token"
 )
@@ -18,8 +21,15 @@ type Lexer struct {
 const NUL byte = 0
 
 func NewFromString(input string) *Lexer {
-	l := &Lexer{input: input, currentLoc: token.Location{Path: token.NO_FILEPATH, CharN: 0, LineN: 1}}
+	return NewFromSource(token.NO_FILEPATH, input)
+}
+
+// NewFromSource returns a lexer for input, which was read from path. A #! line
+// at the start of input is skipped, so that programs can be run as scripts.
+func NewFromSource(path string, input string) *Lexer {
+	l := &Lexer{input: input, currentLoc: token.Location{Path: path, CharN: 0, LineN: 1}}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
@@ -38,11 +48,7 @@ func NewFromPath(path string) (*Lexer, error) {
 		return nil, err
 	}
 
-	input := string(bytes[:])
-
-	l := &Lexer{input: input, currentLoc: token.Location{Path: path, CharN: 0, LineN: 1}}
-	l.readChar()
-	return l, nil
+	return NewFromSource(path, string(bytes[:])), nil
 }
 
 func (l *Lexer) NextToken() token.Token {
@@ -66,17 +72,79 @@ func (l *Lexer) NextToken() token.Token {
 			tok = token.NewOneCharToken(token.BANG, l.ch, l.currentLoc)
 		}
 	case '+':
-		tok = token.NewOneCharToken(token.PLUS, l.ch, l.currentLoc)
+		if l.peek() == '=' {
+			tok = token.NewTwoCharToken(token.PLUS_ASSIGN, "+=", l.currentLoc)
+			l.readChar()
+		} else {
+			tok = token.NewOneCharToken(token.PLUS, l.ch, l.currentLoc)
+		}
 	case '-':
-		tok = token.NewOneCharToken(token.MINUS, l.ch, l.currentLoc)
+		if l.peek() == '>' {
+			tok = token.NewTwoCharToken(token.ARROW, "->", l.currentLoc)
+			l.readChar()
+		} else if l.peek() == '=' {
+			tok = token.NewTwoCharToken(token.MINUS_ASSIGN, "-=", l.currentLoc)
+			l.readChar()
+		} else {
+			tok = token.NewOneCharToken(token.MINUS, l.ch, l.currentLoc)
+		}
 	case '*':
-		tok = token.NewOneCharToken(token.ASTERISK, l.ch, l.currentLoc)
+		if l.peek() == '=' {
+			tok = token.NewTwoCharToken(token.ASTERISK_ASSIGN, "*=", l.currentLoc)
+			l.readChar()
+		} else if l.peek() == '*' {
+			tok = token.NewTwoCharToken(token.POWER, "**", l.currentLoc)
+			l.readChar()
+		} else {
+			tok = token.NewOneCharToken(token.ASTERISK, l.ch, l.currentLoc)
+		}
 	case '/':
-		tok = token.NewOneCharToken(token.RSLASH, l.ch, l.currentLoc)
+		if l.peek() == '=' {
+			tok = token.NewTwoCharToken(token.RSLASH_ASSIGN, "/=", l.currentLoc)
+			l.readChar()
+		} else {
+			tok = token.NewOneCharToken(token.RSLASH, l.ch, l.currentLoc)
+		}
+	case '%':
+		tok = token.NewOneCharToken(token.PERCENT, l.ch, l.currentLoc)
+	case '&':
+		if l.peek() == '&' {
+			tok = token.NewTwoCharToken(token.AND, "&&", l.currentLoc)
+			l.readChar()
+		} else {
+			tok = token.NewOneCharToken(token.AMPERSAND, l.ch, l.currentLoc)
+		}
+	case '|':
+		if l.peek() == '|' {
+			tok = token.NewTwoCharToken(token.OR, "||", l.currentLoc)
+			l.readChar()
+		} else {
+			tok = token.NewOneCharToken(token.PIPE, l.ch, l.currentLoc)
+		}
+	case '^':
+		tok = token.NewOneCharToken(token.CARET, l.ch, l.currentLoc)
+	case '~':
+		tok = token.NewOneCharToken(token.TILDE, l.ch, l.currentLoc)
 	case ',':
 		tok = token.NewOneCharToken(token.COMMA, l.ch, l.currentLoc)
 	case ';':
 		tok = token.NewOneCharToken(token.SEMICOLON, l.ch, l.currentLoc)
+	case ':':
+		tok = token.NewOneCharToken(token.COLON, l.ch, l.currentLoc)
+	case '.':
+		tok = token.NewOneCharToken(token.DOT, l.ch, l.currentLoc)
+	case '"':
+		start := l.currentLoc
+		literal, ok := l.readString()
+		if !ok {
+			tok = token.NewMultiCharToken(token.ILLEGAL, literal, start)
+			// An unterminated string leaves the end of its line to be read.
+			if l.ch != '"' {
+				return tok
+			}
+		} else {
+			tok = token.NewMultiCharToken(token.STRING, literal, start)
+		}
 	case '(':
 		tok = token.NewOneCharToken(token.LPAREN, l.ch, l.currentLoc)
 	case ')':
@@ -85,20 +153,42 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.NewOneCharToken(token.LBRACE, l.ch, l.currentLoc)
 	case '}':
 		tok = token.NewOneCharToken(token.RBRACE, l.ch, l.currentLoc)
+	case '[':
+		tok = token.NewOneCharToken(token.LBRACKET, l.ch, l.currentLoc)
+	case ']':
+		tok = token.NewOneCharToken(token.RBRACKET, l.ch, l.currentLoc)
 	case '<':
-		tok = token.NewOneCharToken(token.LANGLE, l.ch, l.currentLoc)
+		if l.peek() == '=' {
+			tok = token.NewTwoCharToken(token.LANGLE_EQ, "<=", l.currentLoc)
+			l.readChar()
+		} else if l.peek() == '<' {
+			tok = token.NewTwoCharToken(token.LSHIFT, "<<", l.currentLoc)
+			l.readChar()
+		} else {
+			tok = token.NewOneCharToken(token.LANGLE, l.ch, l.currentLoc)
+		}
 	case '>':
-		tok = token.NewOneCharToken(token.RANGLE, l.ch, l.currentLoc)
+		if l.peek() == '=' {
+			tok = token.NewTwoCharToken(token.RANGLE_EQ, ">=", l.currentLoc)
+			l.readChar()
+		} else if l.peek() == '>' {
+			tok = token.NewTwoCharToken(token.RSHIFT, ">>", l.currentLoc)
+			l.readChar()
+		} else {
+			tok = token.NewOneCharToken(token.RANGLE, l.ch, l.currentLoc)
+		}
 	case NUL:
 		tok = token.NewOneCharToken(token.EOF, NUL, l.currentLoc)
 	default:
+		start := l.currentLoc
 		if isIdentifierChar(l.ch) {
 			literal := l.readIdentifier()
-			tok = token.NewMultiCharToken(token.LookupMulticharTokenType(literal), literal, l.currentLoc)
+			tok = token.NewMultiCharToken(token.LookupMulticharTokenType(literal), literal, start)
 			return tok
 		}
 		if isNumericChar(l.ch) {
-			tok = token.NewMultiCharToken(token.INT, l.readNumericLiteral(), l.currentLoc)
+			literal, tt := l.readNumericLiteral()
+			tok = token.NewMultiCharToken(tt, literal, start)
 			return tok
 		}
 		tok = token.NewOneCharToken(token.ILLEGAL, l.ch, l.currentLoc)
@@ -132,12 +222,114 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[pos:l.currentPos]
 }
 
-func (l *Lexer) readNumericLiteral() string {
+// readNumericLiteral reads an integer or a decimal literal. Decimals have a
+// fractional part, or a d suffix, or both, as in 12.50d; one with a fractional
+// part but no suffix is still lexed as a decimal, so that the parser can report
+// the missing suffix.
+func (l *Lexer) readNumericLiteral() (string, token.TokenType) {
+	pos := l.currentPos
+	tt := token.INT
+	l.readDigits()
+
+	if l.ch == '.' && isNumericChar(l.peek()) {
+		tt = token.DECIMAL
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'd' {
+		tt = token.DECIMAL
+		l.readChar()
+	}
+	return l.input[pos:l.currentPos], tt
+}
+
+// readString reads a string literal, like the path in an import, and returns
+// the text between its quotes with its escapes replaced. Strings can't span
+// lines; one that isn't closed before the end of its line, or that has an
+// escape other than \", \\, \n, \r, \t or \u{hex}, is returned as it was
+// written, from its opening quote, along with false.
+func (l *Lexer) readString() (string, bool) {
 	pos := l.currentPos
+	var out strings.Builder
+	ok := true
+
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			if !ok {
+				return l.input[pos : l.currentPos+1], false
+			}
+			return out.String(), true
+		case '\n', NUL:
+			return l.input[pos:l.currentPos], false
+		case '\\':
+			if r, escaped := l.readEscape(); escaped {
+				out.WriteRune(r)
+			} else {
+				ok = false
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+// readEscape reads the escape that starts at the backslash under the read
+// head, leaving the head on its last char, and returns the rune it stands for.
+func (l *Lexer) readEscape() (rune, bool) {
+	switch l.peek() {
+	case '"', '\\':
+		l.readChar()
+		return rune(l.ch), true
+	case 'n':
+		l.readChar()
+		return '\n', true
+	case 'r':
+		l.readChar()
+		return '\r', true
+	case 't':
+		l.readChar()
+		return '\t', true
+	case 'u':
+		l.readChar()
+		if l.peek() != '{' {
+			return 0, false
+		}
+		l.readChar()
+		pos := l.currentPos + 1
+		for isHexChar(l.peek()) {
+			l.readChar()
+		}
+		if l.peek() != '}' {
+			return 0, false
+		}
+		hex := l.input[pos : l.currentPos+1]
+		l.readChar()
+		r, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return 0, false
+		}
+		return rune(r), true
+	}
+	return 0, false
+}
+
+func (l *Lexer) readDigits() {
 	for isNumericChar(l.ch) {
 		l.readChar()
 	}
-	return l.input[pos:l.currentPos]
+}
+
+// skipShebang skips a #! line at the very start of the input. The newline that
+// ends it is left to be read, so that the lines after it keep their numbers.
+func (l *Lexer) skipShebang() {
+	if !strings.HasPrefix(l.input, "#!") {
+		return
+	}
+	for l.ch != '\n' && l.ch != NUL {
+		l.readChar()
+	}
 }
 
 func (l *Lexer) eatWhitespace() {
@@ -161,6 +353,10 @@ func isNumericChar(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexChar(ch byte) bool {
+	return isNumericChar(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func isWhitespace(ch byte) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
@@ -133,6 +133,246 @@ if (5 < 10) {
 	compareExpectedTokens(t, program, expectedTokens)
 }
 
+func TestNextTokenWithTypeAnnotations(t *testing.T) {
+	input := `let x: int = fn(a: int) -> int { a - 1 };`
+
+	tests := []expectedToken{
+		{token.LET, "let"},
+		{token.IDENTIFIER, "x"},
+		{token.COLON, ":"},
+		{token.IDENTIFIER, "int"},
+		{token.ASSIGN, "="},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "a"},
+		{token.COLON, ":"},
+		{token.IDENTIFIER, "int"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.IDENTIFIER, "int"},
+		{token.LBRACE, "{"},
+		{token.IDENTIFIER, "a"},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
+func TestNextTokenWithMacro(t *testing.T) {
+	input := `macro(x) { quote(x) }`
+
+	tests := []expectedToken{
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENTIFIER, "quote"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "x"},
+		{token.RPAREN, ")"},
+		{token.RBRACE, "}"},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
+func TestNextTokenWithLoops(t *testing.T) {
+	input := `while (x) { break; } for (y in [1]) { continue; }`
+
+	tests := []expectedToken{
+		{token.WHILE, "while"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.BREAK, "break"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "y"},
+		{token.IN, "in"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.RBRACKET, "]"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.CONTINUE, "continue"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
+func TestNextTokenWithAssignments(t *testing.T) {
+	input := `x = 1; x += 2; x -= 3; x *= 4; x /= 5; a[0] = {1: 2};`
+
+	tests := []expectedToken{
+		{token.IDENTIFIER, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.RSLASH_ASSIGN, "/="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "a"},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.ASSIGN, "="},
+		{token.LBRACE, "{"},
+		{token.INT, "1"},
+		{token.COLON, ":"},
+		{token.INT, "2"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
+func TestNextTokenWithLogicalOperators(t *testing.T) {
+	input := `a <= b && c >= d || !e; 7 % 2 ** 3; a & b | c`
+
+	tests := []expectedToken{
+		{token.IDENTIFIER, "a"},
+		{token.LANGLE_EQ, "<="},
+		{token.IDENTIFIER, "b"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "c"},
+		{token.RANGLE_EQ, ">="},
+		{token.IDENTIFIER, "d"},
+		{token.OR, "||"},
+		{token.BANG, "!"},
+		{token.IDENTIFIER, "e"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "7"},
+		{token.PERCENT, "%"},
+		{token.INT, "2"},
+		{token.POWER, "**"},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "a"},
+		{token.AMPERSAND, "&"},
+		{token.IDENTIFIER, "b"},
+		{token.PIPE, "|"},
+		{token.IDENTIFIER, "c"},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
+func TestNextTokenWithBitwiseOperators(t *testing.T) {
+	input := `~a & b | c ^ d << 2 >> 1; a&&b||c; a & &b`
+
+	tests := []expectedToken{
+		{token.TILDE, "~"},
+		{token.IDENTIFIER, "a"},
+		{token.AMPERSAND, "&"},
+		{token.IDENTIFIER, "b"},
+		{token.PIPE, "|"},
+		{token.IDENTIFIER, "c"},
+		{token.CARET, "^"},
+		{token.IDENTIFIER, "d"},
+		{token.LSHIFT, "<<"},
+		{token.INT, "2"},
+		{token.RSHIFT, ">>"},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "a"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "b"},
+		{token.OR, "||"},
+		{token.IDENTIFIER, "c"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "a"},
+		{token.AMPERSAND, "&"},
+		{token.AMPERSAND, "&"},
+		{token.IDENTIFIER, "b"},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
+func TestNextTokenWithDecimals(t *testing.T) {
+	input := `12.50d + 3d * 0.5; 7.25 1.foo`
+
+	tests := []expectedToken{
+		{token.DECIMAL, "12.50d"},
+		{token.PLUS, "+"},
+		{token.DECIMAL, "3d"},
+		{token.ASTERISK, "*"},
+		{token.DECIMAL, "0.5"},
+		{token.SEMICOLON, ";"},
+		{token.DECIMAL, "7.25"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.IDENTIFIER, "foo"},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
+func TestNextTokenWithImports(t *testing.T) {
+	input := `import "lib/money.monkey" as money;
+money.round(1) "unterminated
+import`
+
+	tests := []expectedToken{
+		{token.IMPORT, "import"},
+		{token.STRING, "lib/money.monkey"},
+		{token.AS, "as"},
+		{token.IDENTIFIER, "money"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "money"},
+		{token.DOT, "."},
+		{token.IDENTIFIER, "round"},
+		{token.LPAREN, "("},
+		{token.INT, "1"},
+		{token.RPAREN, ")"},
+		{token.ILLEGAL, "\"unterminated"},
+		{token.IMPORT, "import"},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
+func TestNextTokenWithStrings(t *testing.T) {
+	input := `"" "héllo, wörld" "say \"hi\"\n\t\\" "\u{1F412}\u{e9}" "bad \q escape" "\u{110000}" "\u{12"; "open \`
+
+	tests := []expectedToken{
+		{token.STRING, ""},
+		{token.STRING, "héllo, wörld"},
+		{token.STRING, "say \"hi\"\n\t\\"},
+		{token.STRING, "🐒é"},
+		{token.ILLEGAL, `"bad \q escape"`},
+		{token.ILLEGAL, `"\u{110000}"`},
+		{token.ILLEGAL, `"\u{12"`},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, `"open \`},
+		{token.EOF, "\x00"},
+	}
+	compareExpectedTokens(t, input, tests)
+}
+
 func TestTokenLocations(t *testing.T) {
 	program := `let one = 1;
 
@@ -178,6 +418,44 @@ two != one;
 
 }
 
+func TestTokenLocationsAtEndOfLine(t *testing.T) {
+	lexer := NewFromString("foo\n42\nbar")
+
+	expectedLocations := []token.Location{
+		{Path: token.NO_FILEPATH, LineN: 1, CharN: 1},
+		{Path: token.NO_FILEPATH, LineN: 2, CharN: 1},
+		{Path: token.NO_FILEPATH, LineN: 3, CharN: 1},
+	}
+
+	for i, expected := range expectedLocations {
+		tok := lexer.NextToken()
+		if tok.Location != expected {
+			t.Fatalf("tests[%d] - wrong location. expected=%q, got=%q", i, expected, tok.Location)
+		}
+	}
+}
+
+func TestShebangIsSkipped(t *testing.T) {
+	lexer := NewFromSource("script", "#!/usr/bin/env monkey run\nfoo\n#!")
+
+	expected := []token.Token{
+		{Type: token.IDENTIFIER, Literal: "foo", Location: token.Location{Path: "script", LineN: 2, CharN: 1}},
+		{Type: token.ILLEGAL, Literal: "#", Location: token.Location{Path: "script", LineN: 3, CharN: 1}},
+	}
+
+	for i, tt := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != tt.Type || tok.Literal != tt.Literal || tok.Location != tt.Location {
+			t.Fatalf("tests[%d] - expected %s %q at %v, got %s %q at %v", i, tt.Type, tt.Literal, tt.Location, tok.Type, tok.Literal, tok.Location)
+		}
+	}
+
+	// A script of nothing but a #! line has no tokens.
+	if tok := NewFromString("#!/bin/monkey").NextToken(); tok.Type != token.EOF {
+		t.Errorf("expected EOF, got %s %q", tok.Type, tok.Literal)
+	}
+}
+
 func compareExpectedTokens(t *testing.T, input string, expectedTokens []expectedToken) {
 	lexer := NewFromString(input)
 
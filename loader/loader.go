@@ -0,0 +1,302 @@
+// Package loader reads Monkey programs from files, along with the modules they
+// import. Each module is parsed, has its macros expanded and is resolved on
+// its own, so that it has its own namespace, and each file is loaded only once
+// however many files import it.
+//
+// An import of a path that starts with ./ or ../ refers to the file at that
+// path relative to the importing file. Any other relative path is looked for
+// relative to the importing file, then under the project root if it starts
+// with the module name in the project's manifest, then under each of the
+// manifest's roots, and then under each directory in the search path.
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/eval"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/resolver"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// Error is emitted by the loader when a program or one of the modules it
+// imports can't be loaded. Message should be legible by the program author.
+type Error struct {
+	Kind     string // The kind of mistake: "parse", "macro", "name", "import" or "manifest".
+	Message  string
+	Location token.Location
+}
+
+// String() should be legible by the program author.
+func (e *Error) String() string {
+	msg := "%s (at line %d, col %d)"
+	return fmt.Sprintf(msg, e.Message, e.Location.LineN, e.Location.CharN)
+}
+
+func (e *Error) Error() string {
+	return e.String()
+}
+
+// Loader loads programs and the modules they import. Modules are cached by
+// path, so that programs loaded by the same Loader share them.
+type Loader struct {
+	Manifest *Manifest // The project's manifest, if it has one.
+	Path     []string  // Absolute paths of directories to search for imports.
+
+	modules map[string]*ast.Module
+	loading []string // Paths of the files being loaded, outermost first.
+}
+
+func New() *Loader {
+	return &Loader{modules: map[string]*ast.Module{}}
+}
+
+// Load parses the program in the file at path, expands its macros, and loads
+// the modules it imports. The program itself is left for the caller to
+// resolve, as the modules it imports have been.
+func (l *Loader) Load(path string) (*ast.Program, []Error) {
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, []Error{{Kind: "import", Message: err.Error(), Location: token.Location{Path: path}}}
+	}
+
+	lex, errs := l.read(abspath, token.Location{Path: abspath})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return l.load(abspath, lex, filepath.Dir(abspath))
+}
+
+// LoadSource is Load for a program that doesn't come from a file, like one
+// read from standard input. path is only used to report locations in src, and
+// the modules it imports are found relative to dir.
+func (l *Loader) LoadSource(path string, src string, dir string) (*ast.Program, []Error) {
+	return l.load(path, lexer.NewFromSource(path, src), dir)
+}
+
+// load parses the program that lex reads from path and loads the modules it
+// imports, relative to dir.
+func (l *Loader) load(path string, lex *lexer.Lexer, dir string) (*ast.Program, []Error) {
+	program, errs := l.parse(lex)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	l.loading = append(l.loading, path)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	if errs := l.Import(program, dir); len(errs) > 0 {
+		return nil, errs
+	}
+	return program, nil
+}
+
+// Import loads the modules that the import statements in program refer to,
+// with paths relative to dir. Load does this for the programs it loads; Import
+// is for programs that don't come from a file, like lines typed into a REPL.
+func (l *Loader) Import(program *ast.Program, dir string) []Error {
+	for _, stmt := range program.Statements {
+		imp, ok := stmt.(*ast.ImportStatement)
+		if !ok {
+			continue
+		}
+
+		path, err := l.find(imp.Path, dir)
+		if err != "" {
+			return []Error{{Kind: "import", Message: err, Location: imp.ImportToken.Location}}
+		}
+
+		mod, errs := l.loadModule(path, imp.ImportToken.Location)
+		if len(errs) > 0 {
+			return errs
+		}
+		imp.Module = mod
+	}
+	return nil
+}
+
+// find returns the cleaned absolute path of the file that an import of path
+// from a file in dir refers to, or a message saying why there isn't one.
+func (l *Loader) find(path string, dir string) (string, string) {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), ""
+	}
+
+	// A path that is explicitly relative is never searched for, so that it
+	// is reported as unreadable if it isn't there.
+	local := filepath.Join(dir, path)
+	slashed := filepath.ToSlash(path)
+	if strings.HasPrefix(slashed, "./") || strings.HasPrefix(slashed, "../") {
+		return local, ""
+	}
+
+	candidates := []string{local}
+	if m := l.Manifest; m != nil {
+		if m.Name != "" && strings.HasPrefix(slashed, m.Name+"/") {
+			candidates = append(candidates, filepath.Join(m.Dir(), strings.TrimPrefix(slashed, m.Name+"/")))
+		}
+		for _, root := range m.Roots {
+			if !filepath.IsAbs(root) {
+				root = filepath.Join(m.Dir(), root)
+			}
+			candidates = append(candidates, filepath.Join(root, path))
+		}
+	}
+	for _, root := range l.Path {
+		candidates = append(candidates, filepath.Join(root, path))
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, ""
+		}
+	}
+
+	// With nowhere else to look, the import is reported as unreadable.
+	if len(candidates) == 1 {
+		return local, ""
+	}
+	return "", fmt.Sprintf("cannot find %s; tried %s", path, strings.Join(candidates, ", "))
+}
+
+// loadModule loads the module in the file at path, which is imported at loc.
+func (l *Loader) loadModule(path string, loc token.Location) (*ast.Module, []Error) {
+	for i, loading := range l.loading {
+		if loading == path {
+			cycle := append(append([]string{}, l.loading[i:]...), path)
+			msg := fmt.Sprintf("import cycle: %s", strings.Join(cycle, " -> "))
+			return nil, []Error{{Kind: "import", Message: msg, Location: loc}}
+		}
+	}
+
+	if mod, ok := l.modules[path]; ok {
+		return mod, nil
+	}
+
+	lex, errs := l.read(path, loc)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	program, errs := l.parse(lex)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	l.loading = append(l.loading, path)
+	errs = l.Import(program, filepath.Dir(path))
+	l.loading = l.loading[:len(l.loading)-1]
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if rerrs := resolver.New().Resolve(program); len(rerrs) > 0 {
+		for _, rerr := range rerrs {
+			errs = append(errs, Error{Kind: "name", Message: rerr.Message, Location: rerr.Location})
+		}
+		return nil, errs
+	}
+
+	// A module is worth its exports, not a value, so it can't return one.
+	ast.Walk(program, func(n ast.Node) bool {
+		if ret, ok := n.(*ast.ReturnStatement); ok && len(errs) == 0 {
+			msg := "cannot return from the top level of a module"
+			errs = append(errs, Error{Kind: "import", Message: msg, Location: ret.ReturnToken.Location})
+		}
+		_, isFn := n.(*ast.FunctionLiteral)
+		_, isMacro := n.(*ast.MacroLiteral)
+		return !isFn && !isMacro
+	}, nil)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	mod := &ast.Module{Path: path, Program: program}
+	l.modules[path] = mod
+	return mod, nil
+}
+
+// Edge is an import of the file at To by the file at From.
+type Edge struct {
+	From string
+	To   string
+}
+
+// Graph returns the imports made by program, which was loaded from the file at
+// path, and by the modules it imports. Each file's imports are listed together,
+// in the order they are first made, the first time the file is reached.
+func Graph(path string, program *ast.Program) []Edge {
+	edges := []Edge{}
+	seen := map[string]bool{}
+
+	var visit func(from string, program *ast.Program)
+	visit = func(from string, program *ast.Program) {
+		if seen[from] {
+			return
+		}
+		seen[from] = true
+
+		mods := []*ast.Module{}
+		listed := map[string]bool{}
+		for _, stmt := range program.Statements {
+			imp, ok := stmt.(*ast.ImportStatement)
+			if !ok || imp.Module == nil || listed[imp.Module.Path] {
+				continue
+			}
+			listed[imp.Module.Path] = true
+			edges = append(edges, Edge{From: from, To: imp.Module.Path})
+			mods = append(mods, imp.Module)
+		}
+		for _, mod := range mods {
+			visit(mod.Path, mod.Program)
+		}
+	}
+
+	visit(path, program)
+	return edges
+}
+
+// read returns a lexer for the file at path. Files that can't be read are
+// reported at loc.
+func (l *Loader) read(path string, loc token.Location) (*lexer.Lexer, []Error) {
+	lex, err := lexer.NewFromPath(path)
+	if err != nil {
+		if perr, ok := err.(*os.PathError); ok {
+			err = perr.Err
+		}
+		return nil, []Error{{Kind: "import", Message: fmt.Sprintf("cannot read %s: %v", path, err), Location: loc}}
+	}
+	return lex, nil
+}
+
+// parse parses the program that lex reads and expands its macros.
+func (l *Loader) parse(lex *lexer.Lexer) (*ast.Program, []Error) {
+	p := parser.New(lex)
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		errs := []Error{}
+		for _, perr := range p.Errors() {
+			errs = append(errs, Error{Kind: "parse", Message: perr.Message, Location: perr.Location})
+		}
+		return nil, errs
+	}
+
+	macros := eval.Macros{}
+	merrs := eval.DefineMacros(program, macros)
+	if len(merrs) == 0 {
+		merrs = eval.ExpandMacros(program, macros)
+	}
+	if len(merrs) > 0 {
+		errs := []Error{}
+		for _, merr := range merrs {
+			errs = append(errs, Error{Kind: "macro", Message: merr.Message, Location: merr.Location})
+		}
+		return nil, errs
+	}
+
+	return program, nil
+}
@@ -0,0 +1,251 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+)
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.monkey":       `import "lib/a.monkey" as a; import "lib/b.monkey" as b; a.x + b.y`,
+		"lib/a.monkey":      `import "shared.monkey" as shared; let x = shared.z;`,
+		"lib/b.monkey":      `import "./shared.monkey" as shared; let y = shared.z;`,
+		"lib/shared.monkey": `let z = 1;`,
+	})
+
+	program, errs := New().Load(filepath.Join(dir, "main.monkey"))
+	if len(errs) > 0 {
+		t.Fatalf("loader errors: %v", errs)
+	}
+
+	a := program.Statements[0].(*ast.ImportStatement).Module
+	b := program.Statements[1].(*ast.ImportStatement).Module
+	if a == nil || a.Path != filepath.Join(dir, "lib", "a.monkey") {
+		t.Fatalf("expected a to be loaded from lib/a.monkey, got %+v", a)
+	}
+	if b == nil || b.Path != filepath.Join(dir, "lib", "b.monkey") {
+		t.Fatalf("expected b to be loaded from lib/b.monkey, got %+v", b)
+	}
+
+	// Both modules import the same file, which is only loaded once.
+	fromA := a.Program.Statements[0].(*ast.ImportStatement).Module
+	fromB := b.Program.Statements[0].(*ast.ImportStatement).Module
+	if fromA == nil || fromA != fromB {
+		t.Errorf("expected a and b to share the module for shared.monkey, got %p and %p", fromA, fromB)
+	}
+
+	// Modules are resolved by the loader; the program is left to the caller.
+	if a.Program.NumSlots != 2 {
+		t.Errorf("expected a to need 2 slots, got %d", a.Program.NumSlots)
+	}
+	if program.NumSlots != 0 {
+		t.Errorf("expected the program not to be resolved, got %d slots", program.NumSlots)
+	}
+}
+
+func TestLoadSource(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"lib.monkey": "#!/usr/bin/env monkey run\nlet x = 1;"})
+
+	src := "#!/usr/bin/env monkey run\nimport \"lib.monkey\" as lib;\nlet = lib.x;"
+	_, errs := New().LoadSource("<stdin>", src, dir)
+	if len(errs) == 0 {
+		t.Fatalf("expected errors, got none")
+	}
+	loc := errs[0].Location
+	if errs[0].Kind != "parse" || loc.Path != "<stdin>" || loc.LineN != 3 || loc.CharN != 5 {
+		t.Errorf("expected a parse error at <stdin> 3:5, got %s error at %s %d:%d", errs[0].Kind, loc.Path, loc.LineN, loc.CharN)
+	}
+
+	src = "#!/usr/bin/env monkey run\nimport \"lib.monkey\" as lib;\nlib.x"
+	program, errs := New().LoadSource("<stdin>", src, dir)
+	if len(errs) > 0 {
+		t.Fatalf("loader errors: %v", errs)
+	}
+	mod := program.Statements[0].(*ast.ImportStatement).Module
+	if mod == nil || mod.Path != filepath.Join(dir, "lib.monkey") {
+		t.Errorf("expected lib to be loaded from %s, got %+v", dir, mod)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"lib.monkey": "let x = 1;"})
+
+	l := New()
+	load := func() *ast.Module {
+		program := &ast.Program{Statements: []ast.Statement{
+			&ast.ImportStatement{Path: "lib.monkey", Name: &ast.Identifier{Value: "lib"}},
+		}}
+		if errs := l.Import(program, dir); len(errs) > 0 {
+			t.Fatalf("loader errors: %v", errs)
+		}
+		return program.Statements[0].(*ast.ImportStatement).Module
+	}
+
+	first, second := load(), load()
+	if first == nil || first != second {
+		t.Errorf("expected imports by the same loader to share a module, got %p and %p", first, second)
+	}
+	if exports := first.Exports(); len(exports) != 1 || exports[0].Value != "x" {
+		t.Errorf("expected lib to export x, got %v", exports)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"shop/src/main.monkey":   "1",
+		"shop/src/near.monkey":   "1",
+		"shop/lib/near.monkey":   "1",
+		"shop/lib/money.monkey":  "1",
+		"shop/util/fmt.monkey":   "1",
+		"shop/vendor/fmt.monkey": "1",
+		"path/ext.monkey":        "1",
+		"path/money.monkey":      "1",
+	})
+	at := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+
+	l := New()
+	l.Manifest = &Manifest{Path: at("shop/monkey.toml"), Name: "shop", Roots: []string{"lib", "vendor"}}
+	l.Path = []string{at("path")}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"near.monkey", "shop/src/near.monkey"}, // The importing file's directory comes first.
+		{"money.monkey", "shop/lib/money.monkey"},
+		{"fmt.monkey", "shop/vendor/fmt.monkey"},
+		{"shop/util/fmt.monkey", "shop/util/fmt.monkey"},
+		{"ext.monkey", "path/ext.monkey"},
+		{"../lib/money.monkey", "shop/lib/money.monkey"},
+		{at("path/money.monkey"), "path/money.monkey"},
+	}
+
+	for _, tt := range tests {
+		path, err := l.find(tt.path, at("shop/src"))
+		if err != "" || path != at(tt.expected) {
+			t.Errorf("%s: expected %s, got %q (%s)", tt.path, at(tt.expected), path, err)
+		}
+	}
+
+	// Explicitly relative paths are never searched for.
+	if path, err := l.find("./money.monkey", at("shop/src")); err != "" || path != at("shop/src/money.monkey") {
+		t.Errorf("./money.monkey: expected %s, got %q (%s)", at("shop/src/money.monkey"), path, err)
+	}
+
+	tried := []string{at("shop/src/nope.monkey"), at("shop/lib/nope.monkey"), at("shop/vendor/nope.monkey"), at("path/nope.monkey")}
+	expected := "cannot find nope.monkey; tried " + strings.Join(tried, ", ")
+	if _, err := l.find("nope.monkey", at("shop/src")); err != expected {
+		t.Errorf("expected %q, got %q", expected, err)
+	}
+
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ImportStatement{Path: "nope.monkey", Name: &ast.Identifier{Value: "nope"}},
+	}}
+	if errs := l.Import(program, at("shop/src")); len(errs) != 1 || errs[0].Kind != "import" || errs[0].Message != expected {
+		t.Errorf("expected import error %q, got %v", expected, errs)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.monkey": `import "b.monkey" as b; import "a.monkey" as a; import "b.monkey" as b2;`,
+		"a.monkey":    `import "c.monkey" as c; import "b.monkey" as b;`,
+		"b.monkey":    `import "c.monkey" as c;`,
+		"c.monkey":    `let c = 1;`,
+	})
+	at := func(name string) string { return filepath.Join(dir, name) }
+
+	program, errs := New().Load(at("main.monkey"))
+	if len(errs) > 0 {
+		t.Fatalf("loader errors: %v", errs)
+	}
+
+	expected := []Edge{
+		{at("main.monkey"), at("b.monkey")},
+		{at("main.monkey"), at("a.monkey")},
+		{at("b.monkey"), at("c.monkey")},
+		{at("a.monkey"), at("c.monkey")},
+		{at("a.monkey"), at("b.monkey")},
+	}
+	if actual := Graph(at("main.monkey"), program); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"cycle.monkey":    `import "a.monkey" as a;`,
+		"a.monkey":        `let one = 1; import "b.monkey" as b;`,
+		"b.monkey":        `import "a.monkey" as a;`,
+		"self.monkey":     `import "self.monkey" as me;`,
+		"missing.monkey":  `import "nope.monkey" as nope;`,
+		"return.monkey":   `import "returns.monkey" as r;`,
+		"returns.monkey":  `let f = fn() { return 1; }; if (true) { return 2; }`,
+		"parse.monkey":    `import "bad.monkey" as bad;`,
+		"bad.monkey":      `let = 1;`,
+		"names.monkey":    `let secret = 1; import "peek.monkey" as peek;`,
+		"peek.monkey":     `let x = secret;`,
+		"macros.monkey":   `let twice = macro(x) { quote(unquote(x) + unquote(x)) }; import "usemacro.monkey" as m;`,
+		"usemacro.monkey": `let y = twice(1);`,
+	})
+	at := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		file    string
+		kind    string
+		message string
+		path    string // File the error is reported in.
+		line    uint
+		char    uint
+	}{
+		{"cycle.monkey", "import", "import cycle: " + at("a.monkey") + " -> " + at("b.monkey") + " -> " + at("a.monkey"), "b.monkey", 1, 1},
+		{"self.monkey", "import", "import cycle: " + at("self.monkey") + " -> " + at("self.monkey"), "self.monkey", 1, 1},
+		{"missing.monkey", "import", "cannot read " + at("nope.monkey") + ": no such file or directory", "missing.monkey", 1, 1},
+		{"return.monkey", "import", "cannot return from the top level of a module", "returns.monkey", 1, 41},
+		{"parse.monkey", "parse", "expected next token to be IDENTIFIER, got = '=' instead", "bad.monkey", 1, 5},
+		{"names.monkey", "name", "identifier not found: secret", "peek.monkey", 1, 9},
+		{"macros.monkey", "name", "identifier not found: twice", "usemacro.monkey", 1, 9},
+	}
+
+	for _, tt := range tests {
+		_, errs := New().Load(at(tt.file))
+		if len(errs) == 0 {
+			t.Errorf("%s: expected errors, got none", tt.file)
+			continue
+		}
+
+		// The loader stops at the first file that fails, so every error is
+		// of the same kind; only the first is checked.
+		err := errs[0]
+		if err.Kind != tt.kind || err.Message != tt.message {
+			t.Errorf("%s: expected %s error %q, got %s error %q", tt.file, tt.kind, tt.message, err.Kind, err.Message)
+		}
+		loc := err.Location
+		if loc.Path != at(tt.path) || loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("%s: expected error at %s %d:%d, got %s %d:%d", tt.file, tt.path, tt.line, tt.char, loc.Path, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+// writeFiles writes files, which map paths to their contents, to a new
+// directory, and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for path, src := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.TrimSpace(src)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
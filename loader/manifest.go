@@ -0,0 +1,252 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// ManifestFile is the name of the file at the root of a Monkey project that
+// declares the project's module name and the roots that imports are searched
+// for in.
+const ManifestFile = "monkey.toml"
+
+// Manifest is a project's monkey.toml. It's a small subset of TOML: comments,
+// and top-level keys set to strings or to arrays of strings, like
+//
+//	# The shop's scripts.
+//	name = "shop"
+//	roots = ["lib", "vendor"]
+type Manifest struct {
+	Path  string   // Absolute path of the manifest file.
+	Name  string   // Imports of paths under Name are relative to the project root.
+	Roots []string // Directories, relative to the project root, to search for imports.
+}
+
+// Dir returns the project root, which is the directory the manifest is in.
+func (m *Manifest) Dir() string {
+	return filepath.Dir(m.Path)
+}
+
+// FindManifest looks for a manifest in dir and each directory above it, and
+// loads the first one it finds. It returns nil if there isn't one.
+func FindManifest(dir string) (*Manifest, []Error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, []Error{{Kind: "manifest", Message: err.Error(), Location: token.Location{Path: dir}}}
+	}
+
+	for {
+		path := filepath.Join(dir, ManifestFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return LoadManifest(path)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadManifest reads and parses the manifest at path.
+func LoadManifest(path string) (*Manifest, []Error) {
+	abspath, err := filepath.Abs(path)
+	if err == nil {
+		var src []byte
+		if src, err = os.ReadFile(abspath); err == nil {
+			return ParseManifest(abspath, string(src))
+		}
+	}
+
+	if perr, ok := err.(*os.PathError); ok {
+		err = perr.Err
+	}
+	msg := fmt.Sprintf("cannot read %s: %v", path, err)
+	return nil, []Error{{Kind: "manifest", Message: msg, Location: token.Location{Path: path}}}
+}
+
+// ParseManifest parses src as the manifest at path, which should be absolute.
+func ParseManifest(path string, src string) (*Manifest, []Error) {
+	m := &Manifest{Path: path}
+	errs := []Error{}
+	seen := map[string]bool{}
+
+	for i, line := range strings.Split(src, "\n") {
+		s := &manifestScanner{line: line, loc: token.Location{Path: path, LineN: uint(i + 1)}}
+		s.skipSpace()
+		if s.done() {
+			continue
+		}
+
+		key, keyLoc := s.key()
+		if key == "" {
+			errs = append(errs, s.errorf("expected a key, got %q", s.rest()))
+			continue
+		}
+		s.skipSpace()
+		if !s.accept('=') {
+			errs = append(errs, s.errorf("expected = after %s", key))
+			continue
+		}
+		s.skipSpace()
+
+		if seen[key] {
+			errs = append(errs, Error{Kind: "manifest", Message: "duplicate key: " + key, Location: keyLoc})
+			continue
+		}
+		seen[key] = true
+
+		var err *Error
+		switch key {
+		case "name":
+			m.Name, err = s.string()
+			if err == nil && (m.Name == "" || m.Name != filepath.ToSlash(filepath.Clean(m.Name)) || filepath.IsAbs(m.Name)) {
+				err = &Error{Kind: "manifest", Message: fmt.Sprintf("bad module name: %q", m.Name), Location: keyLoc}
+			}
+		case "roots":
+			m.Roots, err = s.strings()
+		default:
+			err = &Error{Kind: "manifest", Message: "unknown key: " + key, Location: keyLoc}
+		}
+		if err == nil {
+			s.skipSpace()
+			if !s.done() {
+				e := s.errorf("unexpected %q after value of %s", s.rest(), key)
+				err = &e
+			}
+		}
+		if err != nil {
+			errs = append(errs, *err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return m, nil
+}
+
+// manifestScanner scans a line of a manifest.
+type manifestScanner struct {
+	line string
+	pos  int
+	loc  token.Location // Location of the line, whose CharN is set as needed.
+}
+
+func (s *manifestScanner) peek() byte {
+	if s.pos < len(s.line) {
+		return s.line[s.pos]
+	}
+	return 0
+}
+
+// done reports whether the rest of the line is empty or a comment.
+func (s *manifestScanner) done() bool {
+	return s.pos >= len(s.line) || s.peek() == '#'
+}
+
+func (s *manifestScanner) rest() string {
+	return strings.TrimSpace(s.line[s.pos:])
+}
+
+func (s *manifestScanner) skipSpace() {
+	for s.peek() == ' ' || s.peek() == '\t' || s.peek() == '\r' {
+		s.pos++
+	}
+}
+
+func (s *manifestScanner) accept(ch byte) bool {
+	if s.peek() == ch {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+// key scans a bare key, and returns it with its location.
+func (s *manifestScanner) key() (string, token.Location) {
+	loc := s.here()
+	start := s.pos
+	for ch := s.peek(); ch == '_' || ch == '-' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'; ch = s.peek() {
+		s.pos++
+	}
+	return s.line[start:s.pos], loc
+}
+
+// string scans a double-quoted string.
+func (s *manifestScanner) string() (string, *Error) {
+	if s.peek() != '"' {
+		err := s.errorf("expected a string, got %q", s.rest())
+		return "", &err
+	}
+
+	start := s.pos
+	for s.pos++; s.pos < len(s.line) && s.line[s.pos] != '"'; s.pos++ {
+		if s.line[s.pos] == '\\' {
+			s.pos++
+		}
+	}
+	if s.pos >= len(s.line) {
+		s.pos = start
+		err := s.errorf("unterminated string")
+		return "", &err
+	}
+	s.pos++
+
+	str, uerr := strconv.Unquote(s.line[start:s.pos])
+	if uerr != nil {
+		s.pos = start
+		err := s.errorf("bad string %s", s.line[start:])
+		return "", &err
+	}
+	return str, nil
+}
+
+// strings scans an array of strings, which has to fit on one line.
+func (s *manifestScanner) strings() ([]string, *Error) {
+	if !s.accept('[') {
+		err := s.errorf("expected an array of strings, got %q", s.rest())
+		return nil, &err
+	}
+
+	strs := []string{}
+	for {
+		s.skipSpace()
+		if s.accept(']') {
+			return strs, nil
+		}
+		if s.done() {
+			err := s.errorf("unterminated array")
+			return nil, &err
+		}
+
+		str, err := s.string()
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, str)
+
+		s.skipSpace()
+		if !s.accept(',') && s.peek() != ']' && !s.done() {
+			err := s.errorf("expected , or ] in array, got %q", s.rest())
+			return nil, &err
+		}
+	}
+}
+
+// here returns the location of the character being scanned.
+func (s *manifestScanner) here() token.Location {
+	loc := s.loc
+	loc.CharN = uint(s.pos + 1)
+	return loc
+}
+
+func (s *manifestScanner) errorf(format string, a ...interface{}) Error {
+	return Error{Kind: "manifest", Message: fmt.Sprintf(format, a...), Location: s.here()}
+}
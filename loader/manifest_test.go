@@ -0,0 +1,96 @@
+package loader
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	input := `
+# The shop's scripts.
+name = "shop/scripts"
+
+roots = [ "lib", "vendor/monkey",] # Searched in order.
+`
+	m, errs := ParseManifest("/src/shop/monkey.toml", input)
+	if len(errs) > 0 {
+		t.Fatalf("manifest errors: %v", errs)
+	}
+
+	expected := &Manifest{Path: "/src/shop/monkey.toml", Name: "shop/scripts", Roots: []string{"lib", "vendor/monkey"}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %+v, got %+v", expected, m)
+	}
+	if m.Dir() != "/src/shop" {
+		t.Errorf("expected project root /src/shop, got %s", m.Dir())
+	}
+
+	if m, errs := ParseManifest("/monkey.toml", "# Nothing to see.\n"); len(errs) > 0 || m.Name != "" || m.Roots != nil {
+		t.Errorf("expected an empty manifest, got %+v, %v", m, errs)
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{`name = shop`, `expected a string, got "shop"`, 1, 8},
+		{`name = "shop`, "unterminated string", 1, 8},
+		{`name = "/shop"`, `bad module name: "/shop"`, 1, 1},
+		{`name = "shop/../x"`, `bad module name: "shop/../x"`, 1, 1},
+		{`name "shop"`, "expected = after name", 1, 6},
+		{"\n  = 1", `expected a key, got "= 1"`, 2, 3},
+		{`version = "1"`, "unknown key: version", 1, 1},
+		{"name = \"a\"\nname = \"b\"", "duplicate key: name", 2, 1},
+		{`roots = "lib"`, `expected an array of strings, got "\"lib\""`, 1, 9},
+		{`roots = ["lib" "x"]`, `expected , or ] in array, got "\"x\"]"`, 1, 16},
+		{`roots = ["lib", 1]`, `expected a string, got "1]"`, 1, 17},
+		{`roots = ["lib"`, "unterminated array", 1, 15},
+		{`roots = [ # lib`, "unterminated array", 1, 11},
+		{`name = "a" b`, `unexpected "b" after value of name`, 1, 12},
+		{"[project]", `expected a key, got "[project]"`, 1, 1},
+	}
+
+	for i, tt := range tests {
+		_, errs := ParseManifest("/monkey.toml", tt.input)
+		if len(errs) != 1 {
+			t.Errorf("[%d] expected 1 error, got %v", i, errs)
+			continue
+		}
+
+		err := errs[0]
+		if err.Kind != "manifest" || err.Message != tt.message {
+			t.Errorf("[%d] expected manifest error %q, got %s error %q", i, tt.message, err.Kind, err.Message)
+		}
+		if loc := err.Location; loc.Path != "/monkey.toml" || loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got %s line %d col %d", i, tt.line, tt.char, loc.Path, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestFindManifest(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"shop/monkey.toml":       `name = "shop"`,
+		"shop/src/deep/x.monkey": "1",
+		"other/src/x.monkey":     "1",
+		"broken/monkey.toml":     "name =",
+		"broken/src/main.monkey": "1",
+	})
+
+	m, errs := FindManifest(filepath.Join(dir, "shop", "src", "deep"))
+	if len(errs) > 0 || m == nil || m.Name != "shop" || m.Path != filepath.Join(dir, "shop", ManifestFile) {
+		t.Errorf("expected the manifest for shop, got %+v, %v", m, errs)
+	}
+
+	if m, errs := FindManifest(filepath.Join(dir, "other", "src")); len(errs) > 0 || m != nil {
+		t.Errorf("expected no manifest, got %+v, %v", m, errs)
+	}
+
+	if _, errs := FindManifest(filepath.Join(dir, "broken", "src")); len(errs) != 1 || errs[0].Location.Path != filepath.Join(dir, "broken", ManifestFile) {
+		t.Errorf("expected an error in the broken manifest, got %v", errs)
+	}
+}
@@ -0,0 +1,74 @@
+package object
+
+import "github.com/MichaelDiBernardo/monkey/ast"
+
+// Environment holds the values of the names bound in one function call, or at
+// the top level of a program, in the slots the resolver assigned them.
+// Environments nest; a binding with a depth of n is found in the environment n
+// levels out from this one.
+type Environment struct {
+	slots []Object
+	outer *Environment
+
+	// Arithmetic holds the settings that arithmetic run in this environment
+	// uses. Enclosed environments start out with their outer one's.
+	Arithmetic Arithmetic
+
+	// Permissions holds what builtins called in this environment may do.
+	// Enclosed environments start out with their outer one's.
+	Permissions Permissions
+
+	// Args holds the arguments the program was run with, which it refers to
+	// as args. Enclosed environments share their outer one's.
+	Args *Array
+
+	// Modules holds the modules that have been imported so far, by path, so
+	// that each is only run once. Enclosed environments share their outer
+	// one's.
+	Modules map[string]*Module
+}
+
+// NewEnvironment returns an environment with room for size slots. It grows as
+// needed if more are set.
+func NewEnvironment(size int) *Environment {
+	return &Environment{slots: make([]Object, size), Arithmetic: DefaultArithmetic, Modules: map[string]*Module{}}
+}
+
+// NewEnclosedEnvironment returns an empty environment with room for size slots,
+// nested in outer.
+func NewEnclosedEnvironment(outer *Environment, size int) *Environment {
+	env := NewEnvironment(size)
+	env.outer = outer
+	env.Arithmetic = outer.Arithmetic
+	env.Permissions = outer.Permissions
+	env.Args = outer.Args
+	env.Modules = outer.Modules
+	return env
+}
+
+// Get returns the value in the slot b refers to, or false if nothing has been
+// stored there yet.
+func (e *Environment) Get(b ast.Binding) (Object, bool) {
+	env := e.at(b.Depth)
+	if b.Slot >= len(env.slots) || env.slots[b.Slot] == nil {
+		return nil, false
+	}
+	return env.slots[b.Slot], true
+}
+
+func (e *Environment) Set(b ast.Binding, val Object) Object {
+	env := e.at(b.Depth)
+	for b.Slot >= len(env.slots) {
+		env.slots = append(env.slots, nil)
+	}
+	env.slots[b.Slot] = val
+	return val
+}
+
+func (e *Environment) at(depth int) *Environment {
+	env := e
+	for i := 0; i < depth; i++ {
+		env = env.outer
+	}
+	return env
+}
@@ -1,6 +1,15 @@
 package object
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
 
 // / ObjectType enumerates the types of objects that our evaluator will work
 // / with.
@@ -10,6 +19,25 @@ const (
 	O_INTEGER = iota
 	O_BOOLEAN
 	O_NULL
+	O_RETURN_VALUE
+	O_ERROR
+	O_FUNCTION
+	O_COMPILED_FUNCTION
+	O_CLOSURE
+	O_QUOTE
+	O_MACRO
+	O_ARRAY
+	O_BREAK
+	O_CONTINUE
+	O_ITERATOR
+	O_HASH
+	O_CELL
+	O_BIGINT
+	O_DECIMAL
+	O_RATIONAL
+	O_BUILTIN
+	O_MODULE
+	O_STRING
 )
 
 // String returns a mostly-human-readable string enum value for the
@@ -22,6 +50,44 @@ func (ot ObjectType) String() string {
 		return "BOOLEAN"
 	case O_NULL:
 		return "NULL"
+	case O_RETURN_VALUE:
+		return "RETURN_VALUE"
+	case O_ERROR:
+		return "ERROR"
+	case O_FUNCTION:
+		return "FUNCTION"
+	case O_COMPILED_FUNCTION:
+		return "COMPILED_FUNCTION"
+	case O_CLOSURE:
+		return "CLOSURE"
+	case O_QUOTE:
+		return "QUOTE"
+	case O_MACRO:
+		return "MACRO"
+	case O_ARRAY:
+		return "ARRAY"
+	case O_BREAK:
+		return "BREAK"
+	case O_CONTINUE:
+		return "CONTINUE"
+	case O_ITERATOR:
+		return "ITERATOR"
+	case O_HASH:
+		return "HASH"
+	case O_CELL:
+		return "CELL"
+	case O_BIGINT:
+		return "BIGINT"
+	case O_DECIMAL:
+		return "DECIMAL"
+	case O_RATIONAL:
+		return "RATIONAL"
+	case O_BUILTIN:
+		return "BUILTIN"
+	case O_MODULE:
+		return "MODULE"
+	case O_STRING:
+		return "STRING"
 	default:
 		return "UNKNOWN"
 	}
@@ -48,6 +114,154 @@ func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+// BigInt is an integer too large for an Integer. Integer arithmetic gives one
+// when it overflows and the engine is set to OverflowPromote, and BigInt
+// arithmetic gives an Integer again whenever its result fits in one.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (bi *BigInt) Type() ObjectType {
+	return O_BIGINT
+}
+
+func (bi *BigInt) Inspect() string {
+	return bi.Value.String()
+}
+
+// Decimal is an exact decimal number: Value scaled down by Scale decimal places.
+// Decimals keep the number of places they're written or computed with, so
+// 12.50d prints as 12.50d, though it is equal to 12.5d.
+type Decimal struct {
+	Value *big.Int // Unscaled value; 1250 for 12.50d.
+	Scale int      // Number of digits after the decimal point.
+}
+
+func (d *Decimal) Type() ObjectType {
+	return O_DECIMAL
+}
+
+func (d *Decimal) Inspect() string {
+	return ast.FormatDecimal(d.Value, d.Scale) + "d"
+}
+
+// Rat returns the exact value of d as a fraction.
+func (d *Decimal) Rat() *big.Rat {
+	denom := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.Scale)), nil)
+	return new(big.Rat).SetFrac(d.Value, denom)
+}
+
+// Rational is an exact fraction that isn't a whole number. The rational
+// builtin makes them from integer division, and rational arithmetic gives an
+// Integer or BigInt instead whenever its result is whole.
+type Rational struct {
+	Value *big.Rat
+}
+
+func (r *Rational) Type() ObjectType {
+	return O_RATIONAL
+}
+
+func (r *Rational) Inspect() string {
+	return r.Value.RatString()
+}
+
+// String is an immutable string of UTF-8 text.
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType {
+	return O_STRING
+}
+
+// Inspect quotes s, so that it can be told apart from other values when it's
+// inside an array or a hash.
+func (s *String) Inspect() string {
+	return ast.QuoteString(s.Value)
+}
+
+// Overflow chooses what integer arithmetic does when its result doesn't fit in
+// an Integer. The zero value is OverflowPromote.
+type Overflow int
+
+const (
+	OverflowPromote Overflow = iota // Give a BigInt instead.
+	OverflowError                   // Fail with a runtime error.
+	OverflowWrap                    // Wrap around, like Go's int64 does.
+)
+
+var overflowNames = []string{"promote", "error", "wrap"}
+
+func (o Overflow) String() string {
+	if int(o) < len(overflowNames) {
+		return overflowNames[o]
+	}
+	return "unknown"
+}
+
+// ParseOverflow returns the Overflow named by s: error, wrap or promote.
+func ParseOverflow(s string) (Overflow, error) {
+	for i, name := range overflowNames {
+		if s == name {
+			return Overflow(i), nil
+		}
+	}
+	return OverflowPromote, fmt.Errorf("expected promote, error or wrap, got %q", s)
+}
+
+// Rounding chooses how decimal results with more places than they can keep are
+// rounded. The zero value is RoundHalfEven.
+type Rounding int
+
+const (
+	RoundHalfEven Rounding = iota // To the nearest, and ties to the even neighbour.
+	RoundHalfUp                   // To the nearest, and ties away from zero.
+	RoundHalfDown                 // To the nearest, and ties toward zero.
+	RoundUp                       // Away from zero.
+	RoundDown                     // Toward zero, truncating.
+	RoundCeiling                  // Toward positive infinity.
+	RoundFloor                    // Toward negative infinity.
+)
+
+var roundingNames = []string{"half-even", "half-up", "half-down", "up", "down", "ceiling", "floor"}
+
+func (r Rounding) String() string {
+	if int(r) < len(roundingNames) {
+		return roundingNames[r]
+	}
+	return "unknown"
+}
+
+// ParseRounding returns the Rounding named by s, like half-even or floor.
+func ParseRounding(s string) (Rounding, error) {
+	for i, name := range roundingNames {
+		if s == name {
+			return Rounding(i), nil
+		}
+	}
+	return RoundHalfEven, fmt.Errorf("expected one of %s, got %q", strings.Join(roundingNames, ", "), s)
+}
+
+// Arithmetic holds the settings that an engine's arithmetic runs with.
+type Arithmetic struct {
+	Overflow Overflow // What integer arithmetic does when it overflows.
+	Places   int      // Decimal places that decimal division keeps.
+	Rounding Rounding // How decimal division rounds away the places it can't keep.
+}
+
+// DefaultArithmetic is what engines use unless they're told otherwise.
+var DefaultArithmetic = Arithmetic{Overflow: OverflowPromote, Places: 10, Rounding: RoundHalfEven}
+
+// Permissions holds the directories that an engine's builtins may use files
+// under. The zero value allows nothing, so that untrusted programs can be run
+// with it.
+type Permissions struct {
+	Read  []string // Absolute, symlink-free directories whose files can be read.
+	Write []string // Absolute, symlink-free directories whose files can be written.
+	Env   bool     // Whether environment variables can be read.
+}
+
 // Integer is an object that represents a 64-bit signed integer.
 type Boolean struct {
 	Value bool
@@ -64,6 +278,14 @@ func (b *Boolean) Inspect() string {
 var TRUE_OBJ = &Boolean{Value: true}
 var FALSE_OBJ = &Boolean{Value: false}
 
+// NativeBoolToBooleanObject returns the Boolean singleton for b.
+func NativeBoolToBooleanObject(b bool) *Boolean {
+	if b {
+		return TRUE_OBJ
+	}
+	return FALSE_OBJ
+}
+
 // Null is an object that represents ... null.
 type Null struct{}
 
@@ -76,3 +298,362 @@ func (n *Null) Inspect() string {
 }
 
 var NULL_OBJ = &Null{}
+
+// ReturnValue wraps the value of a return statement while it unwinds the
+// blocks it was returned from.
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType {
+	return O_RETURN_VALUE
+}
+
+func (rv *ReturnValue) Inspect() string {
+	return rv.Value.Inspect()
+}
+
+// LoopControl is the signal a break or continue statement sends to the loop
+// it is in, while it unwinds the blocks in between.
+type LoopControl struct {
+	Break bool // Whether the loop should end, rather than skip ahead.
+}
+
+func (lc *LoopControl) Type() ObjectType {
+	if lc.Break {
+		return O_BREAK
+	}
+	return O_CONTINUE
+}
+
+func (lc *LoopControl) Inspect() string {
+	if lc.Break {
+		return "break"
+	}
+	return "continue"
+}
+
+var BREAK_OBJ = &LoopControl{Break: true}
+var CONTINUE_OBJ = &LoopControl{Break: false}
+
+// Array is an ordered list of objects.
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType {
+	return O_ARRAY
+}
+
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, el := range a.Elements {
+		elements = append(elements, el.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashKey identifies the key of a hash pair. Keys that are equal in Monkey
+// have equal HashKeys.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Text  string // The exact key, for keys that don't fit in Value.
+}
+
+// Hashable is implemented by the objects that can be used as hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (bi *BigInt) HashKey() HashKey {
+	return HashKey{Type: bi.Type(), Text: bi.Value.String()}
+}
+
+// HashKey of a decimal depends only on its value, so that 1.5d and 1.50d are
+// the same key. Decimals are never the same key as integers or rationals.
+func (d *Decimal) HashKey() HashKey {
+	return HashKey{Type: d.Type(), Text: d.Rat().RatString()}
+}
+
+func (r *Rational) HashKey() HashKey {
+	return HashKey{Type: r.Type(), Text: r.Value.RatString()}
+}
+
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Text: s.Value}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+// HashPair is a key in a hash along with the value stored under it.
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps hashable keys to values. Its pairs are kept in the order their
+// keys were first set, so that hashes always print the same way.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
+}
+
+// Get returns the value stored under key, or false if there isn't one.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Set stores value under key, replacing any value already stored there.
+func (h *Hash) Set(key Hashable, value Object) {
+	hk := key.HashKey()
+	if _, ok := h.Pairs[hk]; !ok {
+		h.keys = append(h.keys, hk)
+	}
+	h.Pairs[hk] = HashPair{Key: key, Value: value}
+}
+
+// Ordered returns the pairs of h in the order their keys were first set.
+func (h *Hash) Ordered() []HashPair {
+	pairs := []HashPair{}
+	for _, hk := range h.keys {
+		pairs = append(pairs, h.Pairs[hk])
+	}
+	return pairs
+}
+
+func (h *Hash) Type() ObjectType {
+	return O_HASH
+}
+
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, pair := range h.Ordered() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Iterator is the state of a for loop that the VM is running: the elements it
+// is iterating over, and the index of the next one.
+type Iterator struct {
+	Elements []Object
+	Next     int
+}
+
+func (it *Iterator) Type() ObjectType {
+	return O_ITERATOR
+}
+
+func (it *Iterator) Inspect() string {
+	return fmt.Sprintf("Iterator[%p]", it)
+}
+
+// Error is a runtime error raised while running a Monkey program. Message
+// should be legible by the program author.
+type Error struct {
+	Message  string
+	Location token.Location
+	Exit     *Exit // Set if the program called exit, rather than failing.
+}
+
+func (e *Error) Type() ObjectType {
+	return O_ERROR
+}
+
+func (e *Error) Inspect() string {
+	return fmt.Sprintf("ERROR: %s (at line %d, col %d)", e.Message, e.Location.LineN, e.Location.CharN)
+}
+
+// Error lets engines that report failures as Go errors hand back an *Error.
+func (e *Error) Error() string {
+	return e.Inspect()
+}
+
+// Exit is what a builtin returns, as its error, to end the program with an
+// exit code. Engines stop the program the way they do for a runtime error,
+// with an *Error whose Exit is set.
+type Exit struct {
+	Code int
+}
+
+func (e *Exit) Error() string {
+	return fmt.Sprintf("exit %d", e.Code)
+}
+
+// Function is a function literal closed over the environment it was defined
+// in.
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	NumSlots   int // Size of the environment each call needs.
+}
+
+func (f *Function) Type() ObjectType {
+	return O_FUNCTION
+}
+
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+
+	return out.String()
+}
+
+// BuiltinFunction is the Go implementation of a builtin. It is passed the
+// arithmetic settings and permissions of the engine that calls it. Errors it
+// returns are reported at the call.
+type BuiltinFunction func(arith Arithmetic, perms Permissions, args ...Object) (Object, error)
+
+// Builtin is a function that is provided by the interpreter rather than
+// written in Monkey.
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType {
+	return O_BUILTIN
+}
+
+func (b *Builtin) Inspect() string {
+	return fmt.Sprintf("builtin %s", b.Name)
+}
+
+// Module is an imported Monkey file, once it has been run. Its members are the
+// values that the names bound at its top level had when it finished running.
+// The builtin modules, like strings, are modules too, of builtin functions.
+type Module struct {
+	Path    string // Cleaned absolute path of the file, or a builtin module's name.
+	Members map[string]Object
+}
+
+func (m *Module) Type() ObjectType {
+	return O_MODULE
+}
+
+func (m *Module) Inspect() string {
+	return fmt.Sprintf("module %s", m.Path)
+}
+
+// CompiledFunction is a function literal that has been compiled to bytecode.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Lines         code.LineTable // Source locations of Instructions.
+	NumLocals     int
+	NumParameters int
+	LocalNames    []string // Name bound to each local slot, for error messages.
+
+	// Module is the path of the module that this function is the body of, if
+	// it's one. Exports are the names of the module's members, in the order
+	// that OpModule pops their values.
+	Module  string
+	Exports []string
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return O_COMPILED_FUNCTION
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a compiled function along with the free variables it captured
+// when it was created.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType {
+	return O_CLOSURE
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Cell holds the value of a local that closures can assign to, so that the
+// function that binds it and every closure that captures it share one slot.
+// Cells only exist in the VM.
+type Cell struct {
+	Name  string // Name of the local, for error messages.
+	Value Object // nil until the local is bound.
+}
+
+func (c *Cell) Type() ObjectType {
+	return O_CELL
+}
+
+func (c *Cell) Inspect() string {
+	return fmt.Sprintf("Cell[%p]", c)
+}
+
+// Quote is an unevaluated piece of Monkey source, as produced by quote().
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType {
+	return O_QUOTE
+}
+
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro is a macro literal. Its body is evaluated before the program is run,
+// with its parameters bound to quotes of the arguments it is called with.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	NumSlots   int // Size of the environment each expansion needs.
+}
+
+func (m *Macro) Type() ObjectType {
+	return O_MACRO
+}
+
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(m.Body.String())
+
+	return out.String()
+}
@@ -0,0 +1,18 @@
+package ops
+
+// Limits on the size of the values that programs make. Without them, a typo
+// like 3 ** 100000000, or a script that can't be trusted, would take all of
+// the memory or time of the process running it rather than fail with an
+// error. Every operator and builtin that can make a value grow checks the
+// limit for its kind of value before making it.
+const (
+	// MaxBigIntBits is the most bits an integer result may have, and so
+	// also the largest count an integer may be shifted left by.
+	MaxBigIntBits = 1 << 20
+
+	// MaxStringLen is the longest string, in bytes, that may be made.
+	MaxStringLen = 1 << 28
+
+	// MaxPlaces is the most decimal places a decimal may be rounded to.
+	MaxPlaces = 1 << 16
+)
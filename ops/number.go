@@ -0,0 +1,239 @@
+package ops
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// numberInfix applies op to two numbers that aren't both integers. Decimals
+// and rationals are exact, so the operands are converted to whichever of
+// their types can hold both of them exactly:
+//
+//	integer and decimal:  decimal
+//	integer and rational: rational
+//	decimal and rational: rational
+//
+// Decimal +, - and * are exact, and keep as many places as they need. Decimal
+// division is rounded to arith.Places places, as arith.Rounding says; divide
+// rationals instead to keep the exact quotient. Comparisons compare exact
+// values, so 1.50d == 1.5d, and 2.0d == 2.
+//
+// ** takes an integer exponent, which can only be negative for a rational
+// base. Decimals support %, which truncates like integer % does; rationals
+// don't.
+func numberInfix(op token.TokenType, lhs, rhs object.Object, arith object.Arithmetic) (object.Object, error) {
+	switch op {
+	case token.LANGLE, token.RANGLE, token.LANGLE_EQ, token.RANGLE_EQ, token.EQ, token.NEQ:
+		return compareNumbers(op, toRat(lhs).Cmp(toRat(rhs))), nil
+	case token.POWER:
+		return numberPower(lhs, rhs)
+	}
+
+	if lhs.Type() == object.O_RATIONAL || rhs.Type() == object.O_RATIONAL {
+		return rationalInfix(op, lhs, rhs)
+	}
+	return decimalInfix(op, toDecimal(lhs), toDecimal(rhs), arith)
+}
+
+func compareNumbers(op token.TokenType, cmp int) object.Object {
+	switch op {
+	case token.LANGLE:
+		return object.NativeBoolToBooleanObject(cmp < 0)
+	case token.RANGLE:
+		return object.NativeBoolToBooleanObject(cmp > 0)
+	case token.LANGLE_EQ:
+		return object.NativeBoolToBooleanObject(cmp <= 0)
+	case token.RANGLE_EQ:
+		return object.NativeBoolToBooleanObject(cmp >= 0)
+	case token.EQ:
+		return object.NativeBoolToBooleanObject(cmp == 0)
+	default:
+		return object.NativeBoolToBooleanObject(cmp != 0)
+	}
+}
+
+func decimalInfix(op token.TokenType, l, r *object.Decimal, arith object.Arithmetic) (object.Object, error) {
+	switch op {
+	case token.PLUS, token.MINUS:
+		lv, rv, scale := alignDecimals(l, r)
+		if op == token.PLUS {
+			return &object.Decimal{Value: lv.Add(lv, rv), Scale: scale}, nil
+		}
+		return &object.Decimal{Value: lv.Sub(lv, rv), Scale: scale}, nil
+	case token.ASTERISK:
+		return &object.Decimal{Value: new(big.Int).Mul(l.Value, r.Value), Scale: l.Scale + r.Scale}, nil
+	case token.RSLASH:
+		if r.Value.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return Round(new(big.Rat).Quo(l.Rat(), r.Rat()), arith.Places, arith.Rounding), nil
+	case token.PERCENT:
+		if r.Value.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		lv, rv, scale := alignDecimals(l, r)
+		return &object.Decimal{Value: lv.Rem(lv, rv), Scale: scale}, nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", l.Type(), op, r.Type())
+	}
+}
+
+// alignDecimals returns the unscaled values of l and r scaled to the larger of
+// their scales, along with that scale. The values are copies.
+func alignDecimals(l, r *object.Decimal) (*big.Int, *big.Int, int) {
+	scale := l.Scale
+	if r.Scale > scale {
+		scale = r.Scale
+	}
+	return rescale(l, scale), rescale(r, scale), scale
+}
+
+// rescale returns the unscaled value of d with scale places, which must be no
+// fewer than d has.
+func rescale(d *object.Decimal, scale int) *big.Int {
+	return new(big.Int).Mul(d.Value, pow10(scale-d.Scale))
+}
+
+func rationalInfix(op token.TokenType, lhs, rhs object.Object) (object.Object, error) {
+	l, r := toRat(lhs), toRat(rhs)
+	result := new(big.Rat)
+
+	switch op {
+	case token.PLUS:
+		result.Add(l, r)
+	case token.MINUS:
+		result.Sub(l, r)
+	case token.ASTERISK:
+		result.Mul(l, r)
+	case token.RSLASH:
+		if r.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result.Quo(l, r)
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+	}
+
+	return Rational(result), nil
+}
+
+// numberPower raises a decimal or rational to an integer power. Decimal
+// powers are exact, with as many places as they need.
+func numberPower(lhs, rhs object.Object) (object.Object, error) {
+	exp, ok := rhs.(*object.Integer)
+	if !ok || !isNumber(lhs) || isInteger(lhs) {
+		if rhs.Type() == object.O_BIGINT {
+			return nil, fmt.Errorf("exponent too large: %s", rhs.Inspect())
+		}
+		return nil, fmt.Errorf("unknown operator: %s %s %s", lhs.Type(), token.POWER, rhs.Type())
+	}
+
+	switch base := lhs.(type) {
+	case *object.Decimal:
+		if exp.Value < 0 {
+			return nil, fmt.Errorf("negative exponent: %d", exp.Value)
+		}
+		value, ok := Pow(base.Value, big.NewInt(exp.Value))
+		if !ok {
+			return nil, fmt.Errorf("exponent too large: %d", exp.Value)
+		}
+		return &object.Decimal{Value: value, Scale: base.Scale * int(exp.Value)}, nil
+	default:
+		r := toRat(base)
+		n := exp.Value
+		if n < 0 {
+			if r.Sign() == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			r, n = new(big.Rat).Inv(r), -n
+		}
+		e := big.NewInt(n)
+		num, numOK := Pow(r.Num(), e)
+		denom, denomOK := Pow(r.Denom(), e)
+		if !numOK || !denomOK {
+			return nil, fmt.Errorf("exponent too large: %d", exp.Value)
+		}
+		return Rational(new(big.Rat).SetFrac(num, denom)), nil
+	}
+}
+
+// Rational returns r as an Integer or BigInt if it is whole, or as a Rational
+// if it isn't.
+func Rational(r *big.Rat) object.Object {
+	if r.IsInt() {
+		return Integer(new(big.Int).Set(r.Num()))
+	}
+	return &object.Rational{Value: r}
+}
+
+// Round returns r rounded to a decimal with places places, as rounding says.
+func Round(r *big.Rat, places int, rounding object.Rounding) *object.Decimal {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(places)))
+	num, denom := scaled.Num(), scaled.Denom()
+
+	// Quo truncates, so the remainder has the sign of num, and q is only ever
+	// too close to zero.
+	q, rem := new(big.Int).QuoRem(num, denom, new(big.Int))
+	if rem.Sign() == 0 {
+		return &object.Decimal{Value: q, Scale: places}
+	}
+
+	negative := num.Sign() < 0
+	half := new(big.Int).Lsh(rem.Abs(rem), 1).Cmp(denom) // Compares the remainder to a half.
+
+	var away bool
+	switch rounding {
+	case object.RoundHalfUp:
+		away = half >= 0
+	case object.RoundHalfDown:
+		away = half > 0
+	case object.RoundUp:
+		away = true
+	case object.RoundDown:
+		away = false
+	case object.RoundCeiling:
+		away = !negative
+	case object.RoundFloor:
+		away = negative
+	default:
+		away = half > 0 || half == 0 && q.Bit(0) == 1
+	}
+
+	if away && negative {
+		q.Sub(q, big.NewInt(1))
+	} else if away {
+		q.Add(q, big.NewInt(1))
+	}
+	return &object.Decimal{Value: q, Scale: places}
+}
+
+func isNumber(obj object.Object) bool {
+	return isInteger(obj) || obj.Type() == object.O_DECIMAL || obj.Type() == object.O_RATIONAL
+}
+
+// toDecimal returns obj, an integer or decimal, as a decimal.
+func toDecimal(obj object.Object) *object.Decimal {
+	if d, ok := obj.(*object.Decimal); ok {
+		return d
+	}
+	return &object.Decimal{Value: toBig(obj), Scale: 0}
+}
+
+// toRat returns the exact value of obj, which must be a number.
+func toRat(obj object.Object) *big.Rat {
+	switch obj := obj.(type) {
+	case *object.Decimal:
+		return obj.Rat()
+	case *object.Rational:
+		return obj.Value
+	default:
+		return new(big.Rat).SetInt(toBig(obj))
+	}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
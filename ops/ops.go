@@ -0,0 +1,485 @@
+// Package ops implements the semantics of Monkey's prefix and infix operators.
+// Both the tree-walking evaluator and the VM defer to it, so that the two
+// engines can't disagree on what an operator does.
+package ops
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"path/filepath"
+
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// Compound maps each compound assignment operator, like +=, to the infix
+// operator it applies to the current value of its target.
+var Compound = map[token.TokenType]token.TokenType{
+	token.PLUS_ASSIGN:     token.PLUS,
+	token.MINUS_ASSIGN:    token.MINUS,
+	token.ASTERISK_ASSIGN: token.ASTERISK,
+	token.RSLASH_ASSIGN:   token.RSLASH,
+}
+
+// Prefix applies the prefix operator op to rhs. arith.Overflow decides what
+// happens when negating an integer overflows. The returned error is legible by
+// the program author; callers are expected to attach a location to it.
+func Prefix(op token.TokenType, rhs object.Object, arith object.Arithmetic) (object.Object, error) {
+	if op == token.BANG {
+		return object.NativeBoolToBooleanObject(!IsTruthy(rhs)), nil
+	}
+
+	switch rhs := rhs.(type) {
+	case *object.Integer:
+		switch op {
+		case token.MINUS:
+			if rhs.Value == math.MinInt64 {
+				return overflowed(op, nil, rhs.Value, rhs.Value, arith.Overflow)
+			}
+			return &object.Integer{Value: -rhs.Value}, nil
+		case token.TILDE:
+			return &object.Integer{Value: ^rhs.Value}, nil
+		}
+	case *object.BigInt:
+		switch op {
+		case token.MINUS:
+			return Integer(new(big.Int).Neg(rhs.Value)), nil
+		case token.TILDE:
+			return Integer(new(big.Int).Not(rhs.Value)), nil
+		}
+	case *object.Decimal:
+		if op == token.MINUS {
+			return &object.Decimal{Value: new(big.Int).Neg(rhs.Value), Scale: rhs.Scale}, nil
+		}
+	case *object.Rational:
+		if op == token.MINUS {
+			return &object.Rational{Value: new(big.Rat).Neg(rhs.Value)}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operator: %s%s", op, rhs.Type())
+}
+
+// Infix applies the infix operator op to lhs and rhs, with the settings in
+// arith. arith.Overflow decides what happens when integer arithmetic overflows;
+// shifts and bitwise operators work on the bits of an Integer, and never
+// overflow. Operators that mix integers, decimals and rationals follow the
+// rules of numberInfix. The returned error is legible by the program author;
+// callers are expected to attach a location to it.
+func Infix(op token.TokenType, lhs, rhs object.Object, arith object.Arithmetic) (object.Object, error) {
+	switch {
+	case lhs.Type() == object.O_INTEGER && rhs.Type() == object.O_INTEGER:
+		return integerInfix(op, lhs.(*object.Integer).Value, rhs.(*object.Integer).Value, arith.Overflow)
+	case isInteger(lhs) && isInteger(rhs):
+		return bigInfix(op, toBig(lhs), toBig(rhs))
+	case isNumber(lhs) && isNumber(rhs):
+		return numberInfix(op, lhs, rhs, arith)
+	case lhs.Type() == object.O_STRING && rhs.Type() == object.O_STRING:
+		return stringInfix(op, lhs.(*object.String).Value, rhs.(*object.String).Value)
+	case op == token.EQ:
+		return object.NativeBoolToBooleanObject(lhs == rhs), nil
+	case op == token.NEQ:
+		return object.NativeBoolToBooleanObject(lhs != rhs), nil
+	case lhs.Type() != rhs.Type():
+		return nil, fmt.Errorf("type mismatch: %s %s %s", lhs.Type(), op, rhs.Type())
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", lhs.Type(), op, rhs.Type())
+	}
+}
+
+// stringInfix concatenates and compares strings. Strings are ordered by their
+// code points, which is the order of their UTF-8 bytes.
+func stringInfix(op token.TokenType, l, r string) (object.Object, error) {
+	switch op {
+	case token.PLUS:
+		if len(l)+len(r) > MaxStringLen {
+			return nil, fmt.Errorf("string concatenation result is too long")
+		}
+		return &object.String{Value: l + r}, nil
+	case token.EQ:
+		return object.NativeBoolToBooleanObject(l == r), nil
+	case token.NEQ:
+		return object.NativeBoolToBooleanObject(l != r), nil
+	case token.LANGLE:
+		return object.NativeBoolToBooleanObject(l < r), nil
+	case token.RANGLE:
+		return object.NativeBoolToBooleanObject(l > r), nil
+	case token.LANGLE_EQ:
+		return object.NativeBoolToBooleanObject(l <= r), nil
+	case token.RANGLE_EQ:
+		return object.NativeBoolToBooleanObject(l >= r), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: STRING %s STRING", op)
+	}
+}
+
+func integerInfix(op token.TokenType, l, r int64, overflow object.Overflow) (object.Object, error) {
+	switch op {
+	case token.PLUS:
+		sum := l + r
+		if (l > 0 && r > 0 && sum < 0) || (l < 0 && r < 0 && sum >= 0) {
+			return overflowed(op, &l, r, sum, overflow)
+		}
+		return &object.Integer{Value: sum}, nil
+	case token.MINUS:
+		diff := l - r
+		if (l >= 0 && r < 0 && diff < 0) || (l < 0 && r > 0 && diff >= 0) {
+			return overflowed(op, &l, r, diff, overflow)
+		}
+		return &object.Integer{Value: diff}, nil
+	case token.ASTERISK:
+		if mulOverflows(l, r) {
+			return overflowed(op, &l, r, l*r, overflow)
+		}
+		return &object.Integer{Value: l * r}, nil
+	case token.RSLASH:
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			return overflowed(op, &l, r, l, overflow)
+		}
+		return &object.Integer{Value: l / r}, nil
+	case token.PERCENT:
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return &object.Integer{Value: l % r}, nil
+	case token.POWER:
+		if r < 0 {
+			return nil, fmt.Errorf("negative exponent: %d", r)
+		}
+		if powerOverflows(l, r) {
+			return overflowed(op, &l, r, Power(l, r), overflow)
+		}
+		return &object.Integer{Value: Power(l, r)}, nil
+	case token.AMPERSAND:
+		return &object.Integer{Value: l & r}, nil
+	case token.PIPE:
+		return &object.Integer{Value: l | r}, nil
+	case token.CARET:
+		return &object.Integer{Value: l ^ r}, nil
+	case token.LSHIFT, token.RSHIFT:
+		if r < 0 {
+			return nil, fmt.Errorf("negative shift count: %d", r)
+		}
+		// >> is an arithmetic shift, so it keeps the sign of l.
+		if op == token.LSHIFT {
+			shifted := l << uint64(r)
+			if shiftOverflows(l, r) {
+				return overflowed(op, &l, r, shifted, overflow)
+			}
+			return &object.Integer{Value: shifted}, nil
+		}
+		return &object.Integer{Value: l >> uint64(r)}, nil
+	case token.LANGLE:
+		return object.NativeBoolToBooleanObject(l < r), nil
+	case token.RANGLE:
+		return object.NativeBoolToBooleanObject(l > r), nil
+	case token.LANGLE_EQ:
+		return object.NativeBoolToBooleanObject(l <= r), nil
+	case token.RANGLE_EQ:
+		return object.NativeBoolToBooleanObject(l >= r), nil
+	case token.EQ:
+		return object.NativeBoolToBooleanObject(l == r), nil
+	case token.NEQ:
+		return object.NativeBoolToBooleanObject(l != r), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", object.ObjectType(object.O_INTEGER), op, object.ObjectType(object.O_INTEGER))
+	}
+}
+
+// overflowed returns the result of an integer operation that overflowed,
+// following overflow: an error, the wrapped result, or the exact result as a
+// BigInt. lhs is nil for a prefix operator.
+func overflowed(op token.TokenType, lhs *int64, rhs, wrapped int64, overflow object.Overflow) (object.Object, error) {
+	switch overflow {
+	case object.OverflowWrap:
+		return &object.Integer{Value: wrapped}, nil
+	case object.OverflowPromote:
+		if lhs == nil {
+			return Prefix(op, &object.BigInt{Value: big.NewInt(rhs)}, object.Arithmetic{Overflow: overflow})
+		}
+		return bigInfix(op, big.NewInt(*lhs), big.NewInt(rhs))
+	default:
+		if lhs == nil {
+			return nil, fmt.Errorf("integer overflow: %s%d", op, rhs)
+		}
+		return nil, fmt.Errorf("integer overflow: %d %s %d", *lhs, op, rhs)
+	}
+}
+
+// bigInfix applies op to two integers that are too large for, or whose result
+// may be too large for, an Integer.
+func bigInfix(op token.TokenType, l, r *big.Int) (object.Object, error) {
+	result := new(big.Int)
+
+	switch op {
+	case token.PLUS:
+		result.Add(l, r)
+	case token.MINUS:
+		result.Sub(l, r)
+	case token.ASTERISK:
+		result.Mul(l, r)
+	case token.RSLASH, token.PERCENT:
+		if r.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		// Quo and Rem truncate, like Integer division does.
+		if op == token.RSLASH {
+			result.Quo(l, r)
+		} else {
+			result.Rem(l, r)
+		}
+	case token.POWER:
+		if r.Sign() < 0 {
+			return nil, fmt.Errorf("negative exponent: %s", r)
+		}
+		power, ok := Pow(l, r)
+		if !ok {
+			return nil, fmt.Errorf("exponent too large: %s", r)
+		}
+		result = power
+	case token.AMPERSAND:
+		result.And(l, r)
+	case token.PIPE:
+		result.Or(l, r)
+	case token.CARET:
+		result.Xor(l, r)
+	case token.LSHIFT, token.RSHIFT:
+		if r.Sign() < 0 {
+			return nil, fmt.Errorf("negative shift count: %s", r)
+		}
+		if !r.IsUint64() || r.Uint64() > MaxBigIntBits {
+			return nil, fmt.Errorf("shift count too large: %s", r)
+		}
+		if op == token.LSHIFT {
+			result.Lsh(l, uint(r.Uint64()))
+		} else {
+			result.Rsh(l, uint(r.Uint64()))
+		}
+	case token.LANGLE:
+		return object.NativeBoolToBooleanObject(l.Cmp(r) < 0), nil
+	case token.RANGLE:
+		return object.NativeBoolToBooleanObject(l.Cmp(r) > 0), nil
+	case token.LANGLE_EQ:
+		return object.NativeBoolToBooleanObject(l.Cmp(r) <= 0), nil
+	case token.RANGLE_EQ:
+		return object.NativeBoolToBooleanObject(l.Cmp(r) >= 0), nil
+	case token.EQ:
+		return object.NativeBoolToBooleanObject(l.Cmp(r) == 0), nil
+	case token.NEQ:
+		return object.NativeBoolToBooleanObject(l.Cmp(r) != 0), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", object.ObjectType(object.O_BIGINT), op, object.ObjectType(object.O_BIGINT))
+	}
+
+	return Integer(result), nil
+}
+
+// Pow returns base ** exp, for an exp that isn't negative, unless the result
+// would have more than MaxBigIntBits bits, which is checked before it is worked
+// out: the result has at most exp times as many bits as base. ok is false if
+// the result is too large.
+func Pow(base, exp *big.Int) (result *big.Int, ok bool) {
+	if bits := base.BitLen(); bits > 1 && exp.Cmp(big.NewInt(MaxBigIntBits/int64(bits))) > 0 {
+		return nil, false
+	}
+	return new(big.Int).Exp(base, exp, nil), true
+}
+
+// Integer returns n as an Integer if it fits in one, or as a BigInt if it
+// doesn't.
+func Integer(n *big.Int) object.Object {
+	if n.IsInt64() {
+		return &object.Integer{Value: n.Int64()}
+	}
+	return &object.BigInt{Value: n}
+}
+
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.O_INTEGER || obj.Type() == object.O_BIGINT
+}
+
+// toBig returns the value of obj, an Integer or BigInt, as a big.Int.
+func toBig(obj object.Object) *big.Int {
+	if integer, ok := obj.(*object.Integer); ok {
+		return big.NewInt(integer.Value)
+	}
+	return obj.(*object.BigInt).Value
+}
+
+// mulOverflows reports whether l * r overflows an int64.
+func mulOverflows(l, r int64) bool {
+	if l == 0 || r == 0 {
+		return false
+	}
+	p := l * r
+	return p/r != l || (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64)
+}
+
+// shiftOverflows reports whether l << r overflows an int64, which it does if
+// shifting the result back doesn't give l. r must not be negative.
+func shiftOverflows(l, r int64) bool {
+	return (l<<uint64(r))>>uint64(r) != l
+}
+
+// powerOverflows reports whether base ** exp overflows an int64. exp must not
+// be negative.
+func powerOverflows(base, exp int64) bool {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			if mulOverflows(result, base) {
+				return true
+			}
+			result *= base
+		}
+		exp >>= 1
+		// Squaring base only matters if there are more bits of exp to go,
+		// in which case the result is at least as large as the square.
+		if exp > 0 {
+			if mulOverflows(base, base) {
+				return true
+			}
+			base *= base
+		}
+	}
+	return false
+}
+
+// Power returns base raised to exp, which must not be negative, by repeated
+// squaring. It wraps around on overflow.
+func Power(base, exp int64) int64 {
+	result := int64(1)
+	for ; exp > 0; exp >>= 1 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+	}
+	return result
+}
+
+// Elements returns the elements that a for loop over obj iterates over; a
+// string's elements are its characters, as strings. The returned error is
+// legible by the program author.
+func Elements(obj object.Object) ([]object.Object, error) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return obj.Elements, nil
+	case *object.String:
+		chars := []object.Object{}
+		for _, r := range obj.Value {
+			chars = append(chars, &object.String{Value: string(r)})
+		}
+		return chars, nil
+	default:
+		return nil, fmt.Errorf("cannot iterate over %s", obj.Type())
+	}
+}
+
+// Index looks up index in container, for an index expression. Strings are
+// indexed by character, not by byte. Indexes outside of an array or string,
+// and keys that aren't in a hash, give null. The returned error is legible by
+// the program author.
+func Index(container, index object.Object) (object.Object, error) {
+	switch container := container.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(container.Elements)) {
+			return object.NULL_OBJ, nil
+		}
+		return container.Elements[i.Value], nil
+	case *object.String:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("string index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value >= 0 {
+			n := int64(0)
+			for _, r := range container.Value {
+				if n == i.Value {
+					return &object.String{Value: string(r)}, nil
+				}
+				n++
+			}
+		}
+		return object.NULL_OBJ, nil
+	case *object.Hash:
+		key, err := HashKey(index)
+		if err != nil {
+			return nil, err
+		}
+		if val, ok := container.Get(key); ok {
+			return val, nil
+		}
+		return object.NULL_OBJ, nil
+	default:
+		return nil, fmt.Errorf("index operator not supported: %s", container.Type())
+	}
+}
+
+// Member looks up the member called name in module, for a member expression.
+// The returned error is legible by the program author.
+func Member(module object.Object, name string) (object.Object, error) {
+	mod, ok := module.(*object.Module)
+	if !ok {
+		return nil, fmt.Errorf("member access not supported: %s", module.Type())
+	}
+	if val, ok := mod.Members[name]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("module %s has no member %s", filepath.Base(mod.Path), name)
+}
+
+// SetIndex stores value at index in container, for an assignment to an index
+// expression. Arrays can't grow by assigning past their end. The returned
+// error is legible by the program author.
+func SetIndex(container, index, value object.Object) error {
+	switch container := container.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(container.Elements)) {
+			return fmt.Errorf("index out of range: %d", i.Value)
+		}
+		container.Elements[i.Value] = value
+		return nil
+	case *object.Hash:
+		key, err := HashKey(index)
+		if err != nil {
+			return err
+		}
+		container.Set(key, value)
+		return nil
+	default:
+		return fmt.Errorf("index assignment not supported: %s", container.Type())
+	}
+}
+
+// HashKey returns obj as a hash key, or an error legible by the program
+// author if obj can't be used as one.
+func HashKey(obj object.Object) (object.Hashable, error) {
+	key, ok := obj.(object.Hashable)
+	if !ok {
+		return nil, fmt.Errorf("unusable as hash key: %s", obj.Type())
+	}
+	return key, nil
+}
+
+// IsTruthy reports whether obj counts as true in a condition. Everything but
+// false and null is truthy.
+func IsTruthy(obj object.Object) bool {
+	switch obj {
+	case object.FALSE_OBJ, object.NULL_OBJ:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,188 @@
+// Package optimizer rewrites Monkey ASTs into cheaper, equivalent ASTs before
+// they are evaluated.
+package optimizer
+
+import (
+	"fmt"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// Optimize folds constant prefix and infix expressions over integer and boolean
+// literals, and prunes the dead branch of if-expressions whose condition is
+// constant. program is modified in place and returned.
+//
+// A folded literal takes the location of the expression it replaces, and
+// expressions that would fail at runtime (e.g. division by zero, or overflow)
+// are left alone so that the engine can report them where they were written,
+// or handle them as it's been told to. Decimals aren't folded either, since
+// how decimal division rounds is only known at runtime.
+func Optimize(program *ast.Program) *ast.Program {
+	return ast.Modify(program, fold).(*ast.Program)
+}
+
+// folding is the arithmetic that folded expressions are computed with. Overflow
+// is an error, so that expressions that overflow are left for the engine.
+var folding = object.Arithmetic{Overflow: object.OverflowError}
+
+func fold(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.PrefixExpression:
+		return foldPrefix(n)
+	case *ast.InfixExpression:
+		return foldInfix(n)
+	case *ast.IfExpression:
+		return pruneIf(n)
+	}
+	return node
+}
+
+func foldPrefix(pe *ast.PrefixExpression) ast.Node {
+	rhs, ok := literalValue(pe.RHS)
+	if !ok {
+		return pe
+	}
+
+	val, err := ops.Prefix(pe.OperatorToken.Type, rhs, folding)
+	if err != nil {
+		return pe
+	}
+	return newLiteral(val, pe.OperatorToken.Location, pe)
+}
+
+func foldInfix(ie *ast.InfixExpression) ast.Node {
+	if op := ie.OperatorToken.Type; op == token.AND || op == token.OR {
+		return foldLogical(ie)
+	}
+
+	lhs, ok := literalValue(ie.LHS)
+	if !ok {
+		return ie
+	}
+	rhs, ok := literalValue(ie.RHS)
+	if !ok {
+		return ie
+	}
+
+	val, err := ops.Infix(ie.OperatorToken.Type, lhs, rhs, folding)
+	if err != nil {
+		return ie
+	}
+	return newLiteral(val, ie.OperatorToken.Location, ie)
+}
+
+// literalValue returns the value of exp if it is an integer, boolean or string
+// literal.
+func literalValue(exp ast.Expression) (object.Object, bool) {
+	switch lit := exp.(type) {
+	case *ast.IntegerLiteral:
+		if lit.Big != nil {
+			return &object.BigInt{Value: lit.Big}, true
+		}
+		return &object.Integer{Value: lit.Value}, true
+	case *ast.BooleanLiteral:
+		return object.NativeBoolToBooleanObject(lit.Value), true
+	case *ast.StringLiteral:
+		return &object.String{Value: lit.Value}, true
+	}
+	return nil, false
+}
+
+// newLiteral returns a literal for val at loc, or orig if val can't be written
+// as one.
+func newLiteral(val object.Object, loc token.Location, orig ast.Node) ast.Node {
+	switch val := val.(type) {
+	case *object.Integer:
+		return newInteger(val.Value, loc)
+	case *object.BigInt:
+		tok := token.Token{Type: token.INT, Literal: val.Value.String(), Location: loc}
+		return &ast.IntegerLiteral{IntToken: tok, Big: val.Value}
+	case *object.Boolean:
+		return newBoolean(val.Value, loc)
+	case *object.String:
+		tok := token.Token{Type: token.STRING, Literal: val.Value, Location: loc}
+		return &ast.StringLiteral{StringToken: tok, Value: val.Value}
+	}
+	return orig
+}
+
+// foldLogical folds an && or || whose left-hand side is a literal that decides
+// the result, or whose sides are both literals. The right-hand side of the
+// former is dropped, since it would never run.
+func foldLogical(ie *ast.InfixExpression) ast.Node {
+	lhs, ok := constantTruthiness(ie.LHS)
+	if !ok {
+		return ie
+	}
+
+	loc := ie.OperatorToken.Location
+	if lhs == (ie.OperatorToken.Type == token.OR) {
+		return newBoolean(lhs, loc)
+	}
+	if rhs, ok := constantTruthiness(ie.RHS); ok {
+		return newBoolean(rhs, loc)
+	}
+	return ie
+}
+
+// pruneIf drops the branch of ie that can never run. When the branch that
+// always runs is a single expression, the whole if-expression is replaced by
+// that expression.
+func pruneIf(ie *ast.IfExpression) ast.Node {
+	truthy, ok := constantTruthiness(ie.Condition)
+	if !ok || ie.Consequence == nil {
+		return ie
+	}
+
+	if truthy {
+		ie.Alternative = nil
+	} else if ie.Alternative != nil {
+		ie.Condition = newBoolean(true, ie.Condition.Token().Location)
+		ie.Consequence, ie.Alternative = ie.Alternative, nil
+	} else {
+		ie.Consequence = &ast.BlockStatement{StartToken: ie.Consequence.StartToken, Statements: []ast.Statement{}}
+		return ie
+	}
+
+	if len(ie.Consequence.Statements) == 1 {
+		if es, ok := ie.Consequence.Statements[0].(*ast.ExpressionStatement); ok && es.Value != nil {
+			return es.Value
+		}
+	}
+
+	return ie
+}
+
+// constantTruthiness reports whether exp is a literal, and if so, whether it is
+// truthy.
+func constantTruthiness(exp ast.Expression) (truthy bool, ok bool) {
+	switch lit := exp.(type) {
+	case *ast.BooleanLiteral:
+		return lit.Value, true
+	case *ast.IntegerLiteral, *ast.DecimalLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+func newInteger(value int64, loc token.Location) *ast.IntegerLiteral {
+	literal := fmt.Sprintf("%d", value)
+	return &ast.IntegerLiteral{
+		IntToken: token.Token{Type: token.INT, Literal: literal, Location: loc},
+		Value:    value,
+	}
+}
+
+func newBoolean(value bool, loc token.Location) *ast.BooleanLiteral {
+	tt := token.FALSE
+	if value {
+		tt = token.TRUE
+	}
+	return &ast.BooleanLiteral{
+		BoolToken: token.Token{Type: tt, Literal: fmt.Sprintf("%t", value), Location: loc},
+		Value:     value,
+	}
+}
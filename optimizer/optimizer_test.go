@@ -0,0 +1,116 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/parser"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"60 * 60 * 24", "86400"},
+		{"1 + 2 * 3 - 4 / 2", "5"},
+		{"-5 + 2", "-3"},
+		{"-(5 + 2)", "-7"},
+		{"!!true", "true"},
+		{"!false == true", "true"},
+		{"!5", "false"},
+		{"1 < 2", "true"},
+		{"1 > 2", "false"},
+		{"3 == 3", "true"},
+		{"3 != 3", "false"},
+		{"true != false", "true"},
+		{"x + 2 * 3", "(x + 6)"},
+		{"1 + 2 + x", "(3 + x)"},
+		{"x + 1 + 2", "((x + 1) + 2)"},
+		{"true + 1", "(true + 1)"},
+		{"1 / 0", "(1 / 0)"},
+		{"10 / (5 - 5)", "(10 / 0)"},
+		{"7 % 4 + 2 ** 3", "11"},
+		{"1 % 0", "(1 % 0)"},
+		{"2 ** (1 - 2)", "(2 ** -1)"},
+		{"1 <= 2", "true"},
+		{"~0 & (12 | 3) ^ 1", "14"},
+		{"1 << 3 >> 1", "4"},
+		{"1 << -1", "(1 << -1)"},
+		{"9223372036854775807 + 1", "(9223372036854775807 + 1)"},
+		{"18446744073709551616 + 1", "18446744073709551617"},
+		{"18446744073709551616 / 4294967296", "4294967296"},
+		{"true == 1", "false"},
+		{"1 >= 2", "false"},
+		{"false && x", "false"},
+		{"1 || x", "true"},
+		{"true && 0", "true"},
+		{"true && x", "(true && x)"},
+		{"x || true", "(x || true)"},
+		{`"mon" + "key" + "\n"`, `"monkey\n"`},
+		{`"a" < "b" && x`, "(true && x)"},
+		{`"a" + 1`, `("a" + 1)`},
+		{`if ("") { x } else { y }`, "x"},
+		{"let day = 60 * 60 * 24;", "let day = 86400;"},
+		{"fn(x) { return x * (2 + 2); }", "fn(x) {return (x * 4);}"},
+		{"f(1 + 1, !true)", "f(2, false)"},
+		{"if (1 < 2) { x } else { y }", "x"},
+		{"if (1 > 2) { x } else { y }", "y"},
+		{"if (true) { let a = 1; a }", "iftrue {let a = 1;a}"},
+		{"if (false) { let a = 1; a } else { let b = 2; b }", "iftrue {let b = 2;b}"},
+		{"if (false) { x }", "iffalse {}"},
+		{"if (3) { x } else { y }", "x"},
+		{"if (x) { 1 + 1 } else { 2 + 2 }", "ifx {2}else {4}"},
+	}
+
+	for i, tt := range tests {
+		program := Optimize(parse(t, tt.input))
+
+		if act := program.String(); act != tt.expected {
+			t.Errorf("[%d] %q: expected %q, got %q", i, tt.input, tt.expected, act)
+		}
+	}
+}
+
+func TestOptimizePreservesLocations(t *testing.T) {
+	input := `let x = 5;
+let y = x / (3 - 3);
+-(2 * 8)`
+	program := Optimize(parse(t, input))
+
+	// The divisor is folded and takes the location of its operator...
+	let := program.Statements[1].(*ast.LetStatement)
+	div := let.Value.(*ast.InfixExpression)
+	zero := div.RHS.(*ast.IntegerLiteral)
+
+	checkLocation(t, zero.Token().Location, 2, 16)
+
+	// ...while the division itself is left alone, so that errors raised by it
+	// are still reported at its operator.
+	checkLocation(t, div.Token().Location, 2, 11)
+
+	neg := program.Statements[2].(*ast.ExpressionStatement).Value.(*ast.IntegerLiteral)
+	checkLocation(t, neg.Token().Location, 3, 1)
+
+	if neg.Token().Type != token.INT || neg.Token().Literal != "-16" {
+		t.Errorf("expected INT token -16, got %s %s", neg.Token().Type, neg.Token().Literal)
+	}
+}
+
+func checkLocation(t *testing.T, loc token.Location, line uint, char uint) {
+	t.Helper()
+	if loc.LineN != line || loc.CharN != char {
+		t.Errorf("expected location line %d col %d, got line %d col %d", line, char, loc.LineN, loc.CharN)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/MichaelDiBernardo/monkey/ast"
 	"github.com/MichaelDiBernardo/monkey/lexer"
@@ -22,6 +24,10 @@ func (pe *ParseError) String() string {
 	return fmt.Sprintf(msg, pe.Message, pe.Location.LineN, pe.Location.CharN)
 }
 
+func (pe *ParseError) Error() string {
+	return pe.String()
+}
+
 type (
 	// prefixParseFn is a Pratt prefix-parse function. It is called when parsing
 	// a prefix operation.
@@ -37,24 +43,51 @@ type Precedence int
 const (
 	_ Precedence = iota
 	P_LOWEST
+	P_ASSIGN
+	P_OR
+	P_AND
+	P_BITOR
+	P_BITXOR
+	P_BITAND
 	P_EQUALS
 	P_LESSGREATER
+	P_SHIFT
 	P_SUM
 	P_PRODUCT
 	P_PREFIX
+	P_POWER
 	P_CALL
+	P_INDEX
 )
 
 var precedences = map[token.TokenType]Precedence{
-	token.EQ:       P_EQUALS,
-	token.NEQ:      P_EQUALS,
-	token.LANGLE:   P_LESSGREATER,
-	token.RANGLE:   P_LESSGREATER,
-	token.PLUS:     P_SUM,
-	token.MINUS:    P_SUM,
-	token.RSLASH:   P_PRODUCT,
-	token.ASTERISK: P_PRODUCT,
-	token.LPAREN:   P_CALL,
+	token.ASSIGN:          P_ASSIGN,
+	token.PLUS_ASSIGN:     P_ASSIGN,
+	token.MINUS_ASSIGN:    P_ASSIGN,
+	token.ASTERISK_ASSIGN: P_ASSIGN,
+	token.RSLASH_ASSIGN:   P_ASSIGN,
+	token.OR:              P_OR,
+	token.AND:             P_AND,
+	token.PIPE:            P_BITOR,
+	token.CARET:           P_BITXOR,
+	token.AMPERSAND:       P_BITAND,
+	token.EQ:              P_EQUALS,
+	token.NEQ:             P_EQUALS,
+	token.LANGLE:          P_LESSGREATER,
+	token.RANGLE:          P_LESSGREATER,
+	token.LANGLE_EQ:       P_LESSGREATER,
+	token.RANGLE_EQ:       P_LESSGREATER,
+	token.LSHIFT:          P_SHIFT,
+	token.RSHIFT:          P_SHIFT,
+	token.PLUS:            P_SUM,
+	token.MINUS:           P_SUM,
+	token.RSLASH:          P_PRODUCT,
+	token.ASTERISK:        P_PRODUCT,
+	token.PERCENT:         P_PRODUCT,
+	token.POWER:           P_POWER,
+	token.LPAREN:          P_CALL,
+	token.LBRACKET:        P_INDEX,
+	token.DOT:             P_INDEX,
 }
 
 func precedenceOfTokenType(tt token.TokenType) Precedence {
@@ -74,6 +107,14 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// loopDepth is the number of loops around the current token in the
+	// function being parsed. break and continue are only allowed in loops.
+	loopDepth int
+
+	// blockDepth is the number of blocks around the current token. Imports
+	// are only allowed outside of them.
+	blockDepth int
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -84,13 +125,19 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENTIFIER, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.DECIMAL, p.parseDecimalLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -101,7 +148,25 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.RANGLE, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NEQ, p.parseInfixExpression)
+	p.registerInfix(token.LANGLE_EQ, p.parseInfixExpression)
+	p.registerInfix(token.RANGLE_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.LSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.RSHIFT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.RSLASH_ASSIGN, p.parseAssignExpression)
 
 	return p
 }
@@ -163,6 +228,18 @@ func (p *Parser) addErrorForMismatchedToken(tok token.Token, expectedType token.
 
 func (p *Parser) addErrorForMissingPrefixFn(tt token.TokenType) {
 	msg := fmt.Sprintf("unexpected token type %s while parsing prefix expression", tt)
+
+	// The lexer gives back strings it can't read as illegal tokens.
+	if lit := p.curToken.Literal; tt == token.ILLEGAL && strings.HasPrefix(lit, `"`) {
+		// A string is closed by a quote that isn't escaped.
+		body := strings.TrimSuffix(lit[1:], `"`)
+		escapes := len(body) - len(strings.TrimRight(body, `\`))
+		if len(body) < len(lit)-1 && escapes%2 == 0 {
+			msg = fmt.Sprintf("bad escape in string %s", lit)
+		} else {
+			msg = fmt.Sprintf("unterminated string %s", lit)
+		}
+	}
 	p.errors = append(p.errors, ParseError{Message: msg, Location: p.curToken.Location})
 }
 
@@ -172,6 +249,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -188,6 +273,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	ident := p.curToken
 	stmt.Name = &ast.Identifier{IdentToken: ident, Value: ident.Literal}
 
+	if p.advanceIfPeekTokenIs(token.COLON) {
+		p.nextToken()
+		stmt.Name.Type = p.parseType()
+	}
+
 	if !p.advanceIfPeekTokenIs(token.ASSIGN) {
 		p.addErrorForMismatchedToken(p.peekToken, token.ASSIGN)
 		return nil
@@ -217,6 +307,139 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{WhileToken: p.curToken}
+
+	if !p.advanceIfPeekTokenIs(token.LPAREN) {
+		p.addErrorForMismatchedToken(p.peekToken, token.LPAREN)
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(P_LOWEST)
+
+	if !p.advanceIfPeekTokenIs(token.RPAREN) {
+		p.addErrorForMismatchedToken(p.peekToken, token.RPAREN)
+		return nil
+	}
+
+	if stmt.Body = p.parseLoopBody(); stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{ForToken: p.curToken}
+
+	if !p.advanceIfPeekTokenIs(token.LPAREN) {
+		p.addErrorForMismatchedToken(p.peekToken, token.LPAREN)
+		return nil
+	}
+
+	if !p.advanceIfPeekTokenIs(token.IDENTIFIER) {
+		p.addErrorForMismatchedToken(p.peekToken, token.IDENTIFIER)
+		return nil
+	}
+
+	stmt.Variable = &ast.Identifier{IdentToken: p.curToken, Value: p.curToken.Literal}
+
+	if !p.advanceIfPeekTokenIs(token.IN) {
+		p.addErrorForMismatchedToken(p.peekToken, token.IN)
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(P_LOWEST)
+
+	if !p.advanceIfPeekTokenIs(token.RPAREN) {
+		p.addErrorForMismatchedToken(p.peekToken, token.RPAREN)
+		return nil
+	}
+
+	if stmt.Body = p.parseLoopBody(); stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// parseLoopBody parses the block that the peek token starts, as the body of
+// a loop.
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	if !p.advanceIfPeekTokenIs(token.LBRACE) {
+		p.addErrorForMismatchedToken(p.peekToken, token.LBRACE)
+		return nil
+	}
+
+	p.loopDepth++
+	body := p.parseBlockStatement()
+	p.loopDepth--
+
+	// Semicolons are optional after loops.
+	if p.peekToken.Is(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return body
+}
+
+// parseLoopControlStatement parses a break or continue statement.
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+
+	if p.peekToken.Is(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if p.loopDepth == 0 {
+		msg := fmt.Sprintf("%s outside of loop", tok.Literal)
+		p.errors = append(p.errors, ParseError{Message: msg, Location: tok.Location})
+		return nil
+	}
+
+	if tok.Is(token.BREAK) {
+		return &ast.BreakStatement{BreakToken: tok}
+	}
+	return &ast.ContinueStatement{ContinueToken: tok}
+}
+
+// parseImportStatement parses an import of the module at a path, like
+// `import "lib/money.monkey" as money`.
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{ImportToken: p.curToken}
+
+	if !p.advanceIfPeekTokenIs(token.STRING) {
+		p.addErrorForMismatchedToken(p.peekToken, token.STRING)
+		return nil
+	}
+	stmt.Path = p.curToken.Literal
+
+	if !p.advanceIfPeekTokenIs(token.AS) {
+		p.addErrorForMismatchedToken(p.peekToken, token.AS)
+		return nil
+	}
+
+	if !p.advanceIfPeekTokenIs(token.IDENTIFIER) {
+		p.addErrorForMismatchedToken(p.peekToken, token.IDENTIFIER)
+		return nil
+	}
+	stmt.Name = &ast.Identifier{IdentToken: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekToken.Is(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if p.blockDepth > 0 {
+		msg := "import is only allowed at the top level"
+		p.errors = append(p.errors, ParseError{Message: msg, Location: stmt.ImportToken.Location})
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	// Assign these outside the struct declaration, because parseExpression
 	// advances curToken.
@@ -242,11 +465,13 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
 	for !p.curToken.Is(token.RBRACE) && !p.curToken.Is(token.EOF) {
 		stmt := p.parseStatement()
 		block.Statements = append(block.Statements, stmt)
 		p.nextToken()
 	}
+	p.blockDepth--
 
 	return block
 }
@@ -267,16 +492,95 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.BooleanLiteral{BoolToken: p.curToken, Value: boolval}
 }
 
+// parseIntegerLiteral parses an integer literal. Literals too large for an
+// int64 keep their value in Big instead.
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	intval, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if err == nil {
+		return &ast.IntegerLiteral{IntToken: p.curToken, Value: intval}
+	}
 
-	if err != nil {
-		msg := fmt.Sprintf("could not parse %s as integer literal", p.curToken.Literal)
+	if bigval, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+		return &ast.IntegerLiteral{IntToken: p.curToken, Big: bigval}
+	}
+
+	msg := fmt.Sprintf("could not parse %s as integer literal", p.curToken.Literal)
+	p.errors = append(p.errors, ParseError{Message: msg, Location: p.curToken.Location})
+	return nil
+}
+
+// parseDecimalLiteral parses a decimal literal. Monkey has no floating point
+// numbers, so a number with a fractional part must have the d suffix.
+func (p *Parser) parseDecimalLiteral() ast.Expression {
+	lit := p.curToken.Literal
+	if !strings.HasSuffix(lit, "d") {
+		msg := fmt.Sprintf("decimal literal %s is missing its d suffix", lit)
 		p.errors = append(p.errors, ParseError{Message: msg, Location: p.curToken.Location})
 		return nil
 	}
 
-	return &ast.IntegerLiteral{IntToken: p.curToken, Value: intval}
+	value, scale, ok := ast.ParseDecimal(lit)
+	if !ok {
+		msg := fmt.Sprintf("could not parse %s as decimal literal", lit)
+		p.errors = append(p.errors, ParseError{Message: msg, Location: p.curToken.Location})
+		return nil
+	}
+	return &ast.DecimalLiteral{DecimalToken: p.curToken, Value: value, Scale: scale}
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{StringToken: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{LBToken: p.curToken, Elements: []ast.Expression{}}
+
+	if p.advanceIfPeekTokenIs(token.RBRACKET) {
+		return array
+	}
+
+	p.nextToken()
+	array.Elements = append(array.Elements, p.parseExpression(P_LOWEST))
+
+	for p.advanceIfPeekTokenIs(token.COMMA) {
+		p.nextToken()
+		array.Elements = append(array.Elements, p.parseExpression(P_LOWEST))
+	}
+
+	if !p.advanceIfPeekTokenIs(token.RBRACKET) {
+		p.addErrorForMismatchedToken(p.peekToken, token.RBRACKET)
+		return nil
+	}
+
+	return array
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{LBToken: p.curToken, Keys: []ast.Expression{}, Values: []ast.Expression{}}
+
+	for !p.peekToken.Is(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(P_LOWEST)
+
+		if !p.advanceIfPeekTokenIs(token.COLON) {
+			p.addErrorForMismatchedToken(p.peekToken, token.COLON)
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(P_LOWEST)
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		if !p.peekToken.Is(token.RBRACE) && !p.advanceIfPeekTokenIs(token.COMMA) {
+			p.addErrorForMismatchedToken(p.peekToken, token.COMMA)
+			return nil
+		}
+	}
+
+	p.nextToken()
+	return hash
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
@@ -289,16 +593,51 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 
 	fn.Parameters = p.parseFunctionParameters()
 
+	if p.advanceIfPeekTokenIs(token.ARROW) {
+		p.nextToken()
+		fn.ReturnType = p.parseType()
+	}
+
 	if !p.advanceIfPeekTokenIs(token.LBRACE) {
 		p.addErrorForMismatchedToken(p.peekToken, token.LBRACE)
 		return nil
 	}
 
-	fn.Body = p.parseBlockStatement()
+	fn.Body = p.parseFunctionBody()
 
 	return fn
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{MacroToken: p.curToken}
+
+	if !p.advanceIfPeekTokenIs(token.LPAREN) {
+		p.addErrorForMismatchedToken(p.peekToken, token.LPAREN)
+		return nil
+	}
+
+	macro.Parameters = p.parseFunctionParameters()
+
+	if !p.advanceIfPeekTokenIs(token.LBRACE) {
+		p.addErrorForMismatchedToken(p.peekToken, token.LBRACE)
+		return nil
+	}
+
+	macro.Body = p.parseFunctionBody()
+
+	return macro
+}
+
+// parseFunctionBody parses the body of a function or macro. Loops around the
+// function don't extend into its body.
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	outerLoopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = outerLoopDepth }()
+
+	return p.parseBlockStatement()
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	params := []*ast.Identifier{}
 	p.nextToken()
@@ -311,7 +650,12 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 			break
 		}
 
-		params = append(params, p.parseIdentifier().(*ast.Identifier))
+		param := p.parseIdentifier().(*ast.Identifier)
+		if p.advanceIfPeekTokenIs(token.COLON) {
+			p.nextToken()
+			param.Type = p.parseType()
+		}
+		params = append(params, param)
 
 		if p.advanceIfPeekTokenIs(token.COMMA) {
 			p.nextToken()
@@ -325,6 +669,52 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return params
 }
 
+// parseType parses the type annotation that starts at the current token: a
+// type name, or a function type like `fn(int, bool) -> int`.
+func (p *Parser) parseType() ast.TypeExpression {
+	switch p.curToken.Type {
+	case token.IDENTIFIER:
+		return &ast.NamedType{NameToken: p.curToken, Name: p.curToken.Literal}
+	case token.FUNCTION:
+		return p.parseFunctionType()
+	default:
+		msg := fmt.Sprintf("expected a type, got %s '%s' instead", p.curToken.Type, p.curToken.Literal)
+		p.errors = append(p.errors, ParseError{Message: msg, Location: p.curToken.Location})
+		return nil
+	}
+}
+
+func (p *Parser) parseFunctionType() ast.TypeExpression {
+	ft := &ast.FunctionType{FnToken: p.curToken, Parameters: []ast.TypeExpression{}}
+
+	if !p.advanceIfPeekTokenIs(token.LPAREN) {
+		p.addErrorForMismatchedToken(p.peekToken, token.LPAREN)
+		return nil
+	}
+
+	if !p.advanceIfPeekTokenIs(token.RPAREN) {
+		p.nextToken()
+		ft.Parameters = append(ft.Parameters, p.parseType())
+
+		for p.advanceIfPeekTokenIs(token.COMMA) {
+			p.nextToken()
+			ft.Parameters = append(ft.Parameters, p.parseType())
+		}
+
+		if !p.advanceIfPeekTokenIs(token.RPAREN) {
+			p.addErrorForMismatchedToken(p.peekToken, token.RPAREN)
+			return nil
+		}
+	}
+
+	if p.advanceIfPeekTokenIs(token.ARROW) {
+		p.nextToken()
+		ft.Return = p.parseType()
+	}
+
+	return ft
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		OperatorToken: p.curToken,
@@ -344,13 +734,43 @@ func (p *Parser) parseInfixExpression(lhs ast.Expression) ast.Expression {
 		Operator:      p.curToken.Literal,
 	}
 
+	// ** is right-associative, and binds tighter than a prefix operator on its
+	// left: -2 ** 2 is -(2 ** 2).
 	prec := precedenceOfTokenType(p.curToken.Type)
+	if p.curToken.Type == token.POWER {
+		prec--
+	}
 	p.nextToken()
 	expression.RHS = p.parseExpression(prec)
 
 	return expression
 }
 
+// parseAssignExpression parses an assignment to lhs. Assignments are
+// right-associative, so `a = b = 1` assigns 1 to b and then to a.
+func (p *Parser) parseAssignExpression(lhs ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		OperatorToken: p.curToken,
+		Operator:      p.curToken.Literal,
+		Target:        lhs,
+	}
+
+	switch lhs.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case nil:
+		return nil
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", lhs.String())
+		p.errors = append(p.errors, ParseError{Message: msg, Location: p.curToken.Location})
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(P_ASSIGN - 1)
+
+	return expression
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -439,6 +859,33 @@ func (p *Parser) parseCallExpression(lhs ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseIndexExpression(lhs ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{LBToken: p.curToken, Left: lhs}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(P_LOWEST)
+
+	if !p.advanceIfPeekTokenIs(token.RBRACKET) {
+		p.addErrorForMismatchedToken(p.peekToken, token.RBRACKET)
+		return nil
+	}
+
+	return exp
+}
+
+// parseMemberExpression parses a member of a module, like `money.round`.
+func (p *Parser) parseMemberExpression(lhs ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{DotToken: p.curToken, Left: lhs}
+
+	if !p.advanceIfPeekTokenIs(token.IDENTIFIER) {
+		p.addErrorForMismatchedToken(p.peekToken, token.IDENTIFIER)
+		return nil
+	}
+	exp.Member = &ast.Identifier{IdentToken: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
 func (p *Parser) parseExpression(precedence Precedence) ast.Expression {
 	pfn := p.prefixParseFns[p.curToken.Type]
 
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/MichaelDiBernardo/monkey/ast"
@@ -83,6 +84,70 @@ func TestIntegerExpression(t *testing.T) {
 	testIntegerLiteral(t, stmt.Value, 52)
 }
 
+func TestBigIntegerExpression(t *testing.T) {
+	input := "9223372036854775807; 9223372036854775808;"
+	program := checkParseProgram(t, input, 2)
+
+	small := program.Statements[0].(*ast.ExpressionStatement).Value
+	testIntegerLiteral(t, small, 9223372036854775807)
+
+	big, ok := program.Statements[1].(*ast.ExpressionStatement).Value.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("expected *ast.IntegerLiteral, got %T", program.Statements[1])
+	}
+	if big.Big == nil || big.Big.String() != "9223372036854775808" {
+		t.Errorf("expected big value 9223372036854775808, got %v", big.Big)
+	}
+	if big.String() != "9223372036854775808" {
+		t.Errorf("expected String() 9223372036854775808, got %q", big.String())
+	}
+}
+
+func TestDecimalExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		value string
+		scale int
+	}{
+		{"12.50d", "1250", 2},
+		{"3d", "3", 0},
+		{"0.05d", "5", 2},
+		{"-1.5d", "15", 1}, // The minus is a prefix operator.
+	}
+
+	for i, tt := range tests {
+		program := checkParseProgram(t, tt.input, 1)
+		exp := program.Statements[0].(*ast.ExpressionStatement).Value
+		if pe, ok := exp.(*ast.PrefixExpression); ok {
+			exp = pe.RHS
+		}
+
+		dec, ok := exp.(*ast.DecimalLiteral)
+		if !ok {
+			t.Fatalf("[%d] expected *ast.DecimalLiteral, got %T", i, exp)
+		}
+		if dec.Value.String() != tt.value || dec.Scale != tt.scale {
+			t.Errorf("[%d] expected value %s scale %d, got value %s scale %d", i, tt.value, tt.scale, dec.Value, dec.Scale)
+		}
+		if want := strings.TrimPrefix(tt.input, "-"); dec.String() != want {
+			t.Errorf("[%d] expected String() %q, got %q", i, want, dec.String())
+		}
+	}
+}
+
+func TestDecimalErrors(t *testing.T) {
+	p := New(lexer.NewFromString("let price = 12.50;"))
+	p.ParseProgram()
+
+	errs := p.Errors()
+	if len(errs) == 0 {
+		t.Fatalf("expected parse errors")
+	}
+	if want := "decimal literal 12.50 is missing its d suffix"; errs[0].Message != want {
+		t.Errorf("expected message %q, got %q", want, errs[0].Message)
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	input := "true;"
 	program := checkParseProgram(t, input, 1)
@@ -233,6 +298,315 @@ func TestParseFunctionLiteral(t *testing.T) {
 	testInfixExpression(t, bodystmt.Value, "x", "+", "y")
 }
 
+func TestParseMacroLiteral(t *testing.T) {
+	input := "macro(x, y) { x + y; }"
+	program := checkParseProgram(t, input, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("stmt was bad type %T", program.Statements[0])
+	}
+
+	ml, ok := stmt.Value.(*ast.MacroLiteral)
+
+	if !ok {
+		t.Fatalf("expected *ast.MacroLiteral, got %T", stmt.Value)
+	}
+
+	if ml.MacroToken.Type != token.MACRO {
+		t.Errorf("expected MacroToken type %s, got %s", token.MACRO, ml.MacroToken.Type)
+	}
+
+	if exp, act := 2, len(ml.Parameters); exp != act {
+		t.Fatalf("expected %d params, got %d", exp, act)
+	}
+
+	testIdentifier(t, ml.Parameters[0], "x")
+	testIdentifier(t, ml.Parameters[1], "y")
+
+	if exp, act := 1, len(ml.Body.Statements); exp != act {
+		t.Fatalf("expected %d statements in macro body, got %d", exp, act)
+	}
+
+	bodystmt, ok := ml.Body.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("bodystmt was bad type %T", ml.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodystmt.Value, "x", "+", "y")
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let x = 5;", "let x = 5;"},
+		{"fn(a: int, b) { a }", "fn(a: int, b) {a}"},
+		{"fn(a: int) -> bool { a > 0 }", "fn(a: int) -> bool {(a > 0)}"},
+		{"let f: fn(int, bool) -> int = g;", "let f: fn(int, bool) -> int = g;"},
+		{"let f: fn() = g;", "let f: fn() = g;"},
+		{"fn(f: fn(int) -> int) -> fn(int) -> int { f }", "fn(f: fn(int) -> int) -> fn(int) -> int {f}"},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.NewFromString(tt.input))
+		program := p.ParseProgram()
+
+		failIfParserHasErrors(t, p)
+		if act := program.String(); act != tt.expected {
+			t.Errorf("[%d] expected %q, got %q", i, tt.expected, act)
+		}
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{"let x: 5 = 5;", "expected a type, got INT '5' instead"},
+		{"fn(a: ) { a }", "expected a type, got ) ')' instead"},
+		{"let f: fn(int = g;", "expected next token to be ), got = '=' instead"},
+		{"a -> b", "unexpected token type -> while parsing prefix expression"},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.NewFromString(tt.input))
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Errorf("[%d] expected parse errors for %q", i, tt.input)
+			continue
+		}
+		if errs[0].Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, errs[0].Message)
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x }", "while(x < 10) {x}"},
+		{"while (true) { break; };", "whiletrue {break;}"},
+		{"for (x in xs) { continue }", "for (x in xs) {continue;}"},
+		{"for (x in [1, 2]) { while (x) { break } }", "for (x in [1, 2]) {whilex {break;}}"},
+		{"while (a) { if (b) { break; } else { continue; } }", "whilea {ifb {break;}else {continue;}}"},
+		{"[]", "[]"},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.NewFromString(tt.input))
+		program := p.ParseProgram()
+
+		failIfParserHasErrors(t, p)
+		if act := program.String(); act != tt.expected {
+			t.Errorf("[%d] expected %q, got %q", i, tt.expected, act)
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"break;", "break outside of loop", 1, 1},
+		{"if (true) {\n  continue\n}", "continue outside of loop", 2, 3},
+		{"while (true) { fn() { break; } }", "break outside of loop", 1, 23},
+		{"for (1 in xs) { }", "expected next token to be IDENTIFIER, got INT '1' instead", 1, 6},
+		{"for (x of xs) { }", "expected next token to be IN, got IDENTIFIER 'of' instead", 1, 8},
+		{"while true { }", "expected next token to be (, got TRUE 'true' instead", 1, 7},
+		{"[1, 2", "expected next token to be ], got EOF '\x00' instead", 1, 6},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.NewFromString(tt.input))
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Errorf("[%d] expected parse errors for %q", i, tt.input)
+			continue
+		}
+		if errs[0].Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, errs[0].Message)
+		}
+		if loc := errs[0].Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	program := checkParseProgram(t, `import "lib/money.monkey" as money; money.round(money.total)`, 2)
+
+	stmt, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("expected *ast.ImportStatement, got %T", program.Statements[0])
+	}
+	if stmt.Path != "lib/money.monkey" {
+		t.Errorf("expected path %q, got %q", "lib/money.monkey", stmt.Path)
+	}
+	if stmt.Name.Value != "money" {
+		t.Errorf("expected name money, got %q", stmt.Name.Value)
+	}
+
+	exp := program.Statements[1].(*ast.ExpressionStatement).Value
+	if want := "(money.round)((money.total))"; exp.String() != want {
+		t.Errorf("expected %q, got %q", want, exp.String())
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		value    string
+		expected string
+	}{
+		{`"hello world"`, "hello world", `"hello world"`},
+		{`""`, "", `""`},
+		{`"say \"hi\"\n"`, "say \"hi\"\n", `"say \"hi\"\n"`},
+		{`"🐒\u{7}\\"`, "🐒\a\\", `"🐒\u{7}\\"`},
+	}
+
+	for i, tt := range tests {
+		program := checkParseProgram(t, tt.input, 1)
+		str, ok := program.Statements[0].(*ast.ExpressionStatement).Value.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("[%d] expected *ast.StringLiteral, got %T", i, program.Statements[0].(*ast.ExpressionStatement).Value)
+		}
+		if str.Value != tt.value {
+			t.Errorf("[%d] expected value %q, got %q", i, tt.value, str.Value)
+		}
+		if str.String() != tt.expected {
+			t.Errorf("[%d] expected %s, got %s", i, tt.expected, str.String())
+		}
+	}
+
+	program := checkParseProgram(t, `"a" + "b"[0]`, 1)
+	if actual := program.String(); actual != `("a" + ("b"[0]))` {
+		t.Errorf("expected (\"a\" + (\"b\"[0])), got %s", actual)
+	}
+
+	errTests := []struct {
+		input   string
+		message string
+	}{
+		{`"open`, `unterminated string "open`},
+		{`"open \"`, `unterminated string "open \"`},
+		{`"bad \q"`, `bad escape in string "bad \q"`},
+		{`"ok \\"; "bad \u{d800}"`, `bad escape in string "bad \u{d800}"`},
+	}
+	for i, tt := range errTests {
+		p := New(lexer.NewFromString(tt.input))
+		p.ParseProgram()
+		if errs := p.Errors(); len(errs) == 0 || errs[0].Message != tt.message {
+			t.Errorf("[%d] expected error %q, got %v", i, tt.message, errs)
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"import lib as lib", "expected next token to be STRING, got IDENTIFIER 'lib' instead", 1, 8},
+		{`import "lib.monkey"`, "expected next token to be AS, got EOF '\x00' instead", 1, 20},
+		{`import "lib.monkey" as "lib"`, "expected next token to be IDENTIFIER, got STRING 'lib' instead", 1, 24},
+		{`import "lib.monkey as lib`, "expected next token to be STRING, got ILLEGAL '\"lib.monkey as lib' instead", 1, 8},
+		{"if (true) {\n  import \"lib.monkey\" as lib\n}", "import is only allowed at the top level", 2, 3},
+		{"lib.1", "expected next token to be IDENTIFIER, got INT '1' instead", 1, 5},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.NewFromString(tt.input))
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Errorf("[%d] expected parse errors for %q", i, tt.input)
+			continue
+		}
+		if errs[0].Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, errs[0].Message)
+		}
+		if loc := errs[0].Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "(x = 5)"},
+		{"x += 1; x -= 2; x *= 3; x /= 4", "(x += 1)(x -= 2)(x *= 3)(x /= 4)"},
+		{"a = b = c", "(a = (b = c))"},
+		{"xs[0] = 1", "((xs[0]) = 1)"},
+		{"h[k][1] += f(x = 2)", "(((h[k])[1]) += f((x = 2)))"},
+		{"let h = {}; {1: true, x: [2]}", "let h = {};{1: true, x: [2]}"},
+		{"(x) = 1", "(x = 1)"},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.NewFromString(tt.input))
+		program := p.ParseProgram()
+
+		failIfParserHasErrors(t, p)
+		if act := program.String(); act != tt.expected {
+			t.Errorf("[%d] expected %q, got %q", i, tt.expected, act)
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"1 = 2", "cannot assign to 1", 1, 3},
+		{"a + b = 2", "cannot assign to (a + b)", 1, 7},
+		{"f() += 1", "cannot assign to f()", 1, 5},
+		{"{1 2}", "expected next token to be :, got INT '2' instead", 1, 4},
+		{"{1: 2 3: 4}", "expected next token to be ,, got INT '3' instead", 1, 7},
+		{"xs[1", "expected next token to be ], got EOF '\x00' instead", 1, 5},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.NewFromString(tt.input))
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Errorf("[%d] expected parse errors for %q", i, tt.input)
+			continue
+		}
+		if errs[0].Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, errs[0].Message)
+		}
+		if loc := errs[0].Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
 func TestParseCallExpression(t *testing.T) {
 	input := "sum(1, 2 * 3, 4 + 5);"
 	program := checkParseProgram(t, input, 1)
@@ -484,6 +858,74 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * [1, 2][b * c] * d",
+			"((a * ([1, 2][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"x = y == z",
+			"(x = (y == z))",
+		},
+		{
+			"x = y += 1 + 2",
+			"(x = (y += (1 + 2)))",
+		},
+		{
+			"a || b && c || d",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"a <= b == c >= d && !e",
+			"(((a <= b) == (c >= d)) && (!e))",
+		},
+		{
+			"x = a || b",
+			"(x = (a || b))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2 * 3",
+			"((-(2 ** 2)) * 3)",
+		},
+		{
+			"a ** -b",
+			"(a ** (-b))",
+		},
+		{
+			"a[0] ** f(1)",
+			"((a[0]) ** f(1))",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"(a & (b == c))",
+		},
+		{
+			"a || b | c && d & e",
+			"(a || ((b | c) && (d & e)))",
+		},
+		{
+			"1 << 2 + 3 < 4 >> 1",
+			"((1 << (2 + 3)) < (4 >> 1))",
+		},
+		{
+			"~a & ~-b",
+			"((~a) & (~(-b)))",
+		},
 	}
 
 	for i, ot := range tests {
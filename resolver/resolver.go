@@ -0,0 +1,254 @@
+// Package resolver binds every identifier in a Monkey AST to the slot its value
+// lives in at runtime, so that the evaluator can index arrays instead of
+// looking names up by string.
+//
+// Every function call, and the top level of the program, gets its own array of
+// slots; blocks share the slots of the function they're in. A name is bound to
+// the same slot for the whole of its scope, so binding it again with let
+// overwrites the value that closures see, just like the map-based environments
+// this replaces.
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/builtins"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// ResolveError is emitted by the resolver when a name is used incorrectly.
+// Message should be legible by the program author.
+type ResolveError struct {
+	Message  string
+	Location token.Location
+}
+
+// String() should be legible by the program author.
+func (re *ResolveError) String() string {
+	msg := "%s (at line %d, col %d)"
+	return fmt.Sprintf(msg, re.Message, re.Location.LineN, re.Location.CharN)
+}
+
+func (re *ResolveError) Error() string {
+	return re.String()
+}
+
+// scope is the set of names bound in one function, or at the top level.
+type scope struct {
+	outer *scope
+
+	slots   map[string]int  // Every name bound anywhere in the scope.
+	defined map[string]bool // Names whose binding has been seen so far.
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, slots: map[string]int{}, defined: map[string]bool{}}
+}
+
+// declare gives name a slot in s, unless it already has one.
+func (s *scope) declare(name string) int {
+	slot, ok := s.slots[name]
+	if !ok {
+		slot = len(s.slots)
+		s.slots[name] = slot
+	}
+	return slot
+}
+
+// Resolver resolves programs against a set of globals that persists between
+// calls to Resolve, so that each line entered in a REPL can see the names bound
+// by the lines before it.
+type Resolver struct {
+	globals *scope
+	current *scope
+	errors  []ResolveError
+}
+
+func New() *Resolver {
+	globals := newScope(nil)
+	return &Resolver{globals: globals, current: globals}
+}
+
+// Resolve binds each identifier in program, and sets the number of slots that
+// program and each of its functions need. It returns the names that were used
+// incorrectly; a program with errors must not be evaluated.
+//
+// A name can't be used before it is bound in the same function. A function can
+// use a name that is bound later in an enclosing function, so that functions
+// bound with let can call each other; the evaluator reports an error if the
+// name still isn't bound when the function is called.
+func (r *Resolver) Resolve(program *ast.Program) []ResolveError {
+	r.errors = []ResolveError{}
+	r.current = r.globals
+
+	r.declareLets(program)
+	r.resolveStatements(program.Statements)
+	program.NumSlots = len(r.globals.slots)
+
+	return r.errors
+}
+
+// declareLets gives every name bound by a let, an import or a for loop in node
+// a slot in the current scope. Function and macro literals have their own
+// scopes and are skipped.
+func (r *Resolver) declareLets(node ast.Node) {
+	ast.Walk(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			r.current.declare(n.Name.Value)
+		case *ast.ImportStatement:
+			r.current.declare(n.Name.Value)
+		case *ast.ForStatement:
+			r.current.declare(n.Variable.Value)
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		}
+		return true
+	}, nil)
+}
+
+func (r *Resolver) resolveStatements(stmts []ast.Statement) {
+	for _, s := range stmts {
+		r.resolve(s)
+	}
+}
+
+func (r *Resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		// Functions are bound before their bodies are resolved so that they
+		// can call themselves; anything else can't see its own name.
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			r.define(node.Name)
+			r.resolve(node.Value)
+		} else {
+			r.resolve(node.Value)
+			r.define(node.Name)
+		}
+	case *ast.ImportStatement:
+		// The module itself is resolved on its own by the loader.
+		r.define(node.Name)
+	case *ast.ForStatement:
+		r.resolve(node.Iterable)
+		r.define(node.Variable)
+		r.resolve(node.Body)
+	case *ast.MemberExpression:
+		// Members name a module's exports, which are looked up at runtime.
+		r.resolve(node.Left)
+	case *ast.AssignExpression:
+		// Assigning to a name doesn't bind it; it has to be bound already.
+		if ident, ok := node.Target.(*ast.Identifier); ok {
+			r.bind(ident, "cannot assign to undeclared identifier: %s")
+			if ident.Binding.Builtin {
+				r.errorf(ident.IdentToken.Location, "cannot assign to builtin: %s", ident.Value)
+			}
+		} else {
+			r.resolve(node.Target)
+		}
+		r.resolve(node.Value)
+	case *ast.Identifier:
+		r.bind(node, "identifier not found: %s")
+	case *ast.FunctionLiteral:
+		node.NumSlots = r.resolveFunction(node.Parameters, node.Body)
+	case *ast.MacroLiteral:
+		node.NumSlots = r.resolveFunction(node.Parameters, node.Body)
+	case *ast.CallExpression:
+		if node.CalleeName() == "quote" {
+			r.resolveQuote(node)
+			return
+		}
+		r.resolveChildren(node)
+	default:
+		r.resolveChildren(node)
+	}
+}
+
+// resolveChildren resolves each of node's direct children.
+func (r *Resolver) resolveChildren(node ast.Node) {
+	ast.Walk(node, func(n ast.Node) bool {
+		if n == node {
+			return true
+		}
+		r.resolve(n)
+		return false
+	}, nil)
+}
+
+// resolveQuote resolves the arguments of the unquote calls in a quote. The
+// rest of the quote isn't evaluated where it's written, so its names are
+// left for whatever it is expanded into to bind.
+func (r *Resolver) resolveQuote(quote *ast.CallExpression) {
+	for _, arg := range quote.Arguments {
+		ast.Walk(arg, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpression); ok && call.CalleeName() == "unquote" {
+				for _, uarg := range call.Arguments {
+					r.resolve(uarg)
+				}
+				return false
+			}
+			return true
+		}, nil)
+	}
+}
+
+// define marks the name bound by a let as usable from here on.
+func (r *Resolver) define(name *ast.Identifier) {
+	r.current.defined[name.Value] = true
+	name.Binding = ast.Binding{Slot: r.current.slots[name.Value], Resolved: true}
+}
+
+// bind resolves ident to the slot of the name it refers to, or to a builtin
+// if no scope binds the name. notFound is the format of the error reported if
+// the name isn't bound anywhere.
+func (r *Resolver) bind(ident *ast.Identifier, notFound string) {
+	depth := 0
+	for s := r.current; s != nil; s = s.outer {
+		slot, ok := s.slots[ident.Value]
+		if !ok {
+			depth++
+			continue
+		}
+
+		if depth == 0 && !s.defined[ident.Value] {
+			r.errorf(ident.IdentToken.Location, "identifier used before definition: %s", ident.Value)
+			return
+		}
+
+		ident.Binding = ast.Binding{Depth: depth, Slot: slot, Resolved: true}
+		return
+	}
+
+	if index, ok := builtins.Lookup(ident.Value); ok {
+		ident.Binding = ast.Binding{Slot: index, Resolved: true, Builtin: true}
+		return
+	}
+
+	r.errorf(ident.IdentToken.Location, notFound, ident.Value)
+}
+
+// resolveFunction resolves the parameters and body of a function or macro in a
+// new scope, and returns the number of slots that a call to it needs.
+func (r *Resolver) resolveFunction(params []*ast.Identifier, body *ast.BlockStatement) int {
+	r.current = newScope(r.current)
+	defer func() { r.current = r.current.outer }()
+
+	// Parameters take the first slots, in order, so that calls can fill them
+	// in without looking at the function's body.
+	for _, param := range params {
+		if _, ok := r.current.slots[param.Value]; ok {
+			r.errorf(param.IdentToken.Location, "duplicate parameter: %s", param.Value)
+			continue
+		}
+		r.current.declare(param.Value)
+		r.define(param)
+	}
+
+	r.declareLets(body)
+	r.resolve(body)
+	return len(r.current.slots)
+}
+
+func (r *Resolver) errorf(loc token.Location, format string, a ...interface{}) {
+	r.errors = append(r.errors, ResolveError{Message: fmt.Sprintf(format, a...), Location: loc})
+}
@@ -0,0 +1,257 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/parser"
+)
+
+func TestBindings(t *testing.T) {
+	input := `
+let a = 1;
+let f = fn(x, y) {
+  let z = x + y;
+  let g = fn(w) { w + z + a + f };
+  let a = z;
+  a
+};
+let a = 2;
+`
+	program := parse(t, input)
+	if errs := New().Resolve(program); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	type use struct {
+		name  string
+		depth int
+		slot  int
+	}
+	expected := []use{
+		{"a", 0, 0},
+		{"f", 0, 1},
+		{"x", 0, 0}, {"y", 0, 1},
+		{"z", 0, 2}, {"x", 0, 0}, {"y", 0, 1},
+		{"g", 0, 3},
+		{"w", 0, 0}, {"w", 0, 0}, {"z", 1, 2}, {"a", 1, 4}, {"f", 2, 1},
+		{"a", 0, 4}, {"z", 0, 2},
+		{"a", 0, 4},
+		{"a", 0, 0},
+	}
+
+	var actual []use
+	ast.Walk(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			if !ident.Binding.Resolved {
+				t.Errorf("%s at line %d was not resolved", ident.Value, ident.IdentToken.Location.LineN)
+			}
+			actual = append(actual, use{ident.Value, ident.Binding.Depth, ident.Binding.Slot})
+		}
+		return true
+	}, nil)
+
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d identifiers, got %d: %v", len(expected), len(actual), actual)
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("[%d] expected %v, got %v", i, expected[i], actual[i])
+		}
+	}
+
+	if program.NumSlots != 2 {
+		t.Errorf("expected program to need 2 slots, got %d", program.NumSlots)
+	}
+
+	f := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if f.NumSlots != 5 {
+		t.Errorf("expected f to need 5 slots, got %d", f.NumSlots)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"x", "identifier not found: x", 1, 1},
+		{"let a = 1;\nlet b = fn() { a + c };", "identifier not found: c", 2, 20},
+		{"let a = a;", "identifier used before definition: a", 1, 9},
+		{"a;\nlet a = 1;", "identifier used before definition: a", 1, 1},
+		{"let a = 1;\nfn() { let b = a; let a = 2; }", "identifier used before definition: a", 2, 16},
+		{"fn(a, b,\n a) { a }", "duplicate parameter: a", 2, 2},
+		{"let a = 1;\n  b = a;", "cannot assign to undeclared identifier: b", 2, 3},
+		{"let f = fn() { x += 1 };", "cannot assign to undeclared identifier: x", 1, 16},
+		{"xs[0] = 1;", "identifier not found: xs", 1, 1},
+		{"x = 1; let x = 2;", "identifier used before definition: x", 1, 1},
+		{"let half = 1;\n rational += half;", "cannot assign to builtin: rational", 2, 2},
+	}
+
+	for i, tt := range tests {
+		errs := New().Resolve(parse(t, tt.input))
+
+		if len(errs) != 1 {
+			t.Errorf("[%d] expected 1 error, got %d: %v", i, len(errs), errs)
+			continue
+		}
+
+		if errs[0].Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, errs[0].Message)
+		}
+
+		if loc := errs[0].Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestLaterFunctionsCanBeCalled(t *testing.T) {
+	input := `
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+`
+	if errs := New().Resolve(parse(t, input)); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+func TestQuotesOnlyResolveUnquotes(t *testing.T) {
+	program := parse(t, "let m = macro(a) { let b = a; quote(b + c + unquote(b)) };")
+	if errs := New().Resolve(program); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	resolved := map[string]bool{}
+	ast.Walk(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok && ident.Binding.Resolved {
+			resolved[ident.Value] = true
+		}
+		return true
+	}, nil)
+
+	if len(resolved) != 3 || !resolved["m"] || !resolved["a"] || !resolved["b"] {
+		t.Errorf("expected only m, a and b to be resolved, got %v", resolved)
+	}
+
+	m := program.Statements[0].(*ast.LetStatement).Value.(*ast.MacroLiteral)
+	if m.NumSlots != 2 {
+		t.Errorf("expected m to need 2 slots, got %d", m.NumSlots)
+	}
+}
+
+func TestLoopVariables(t *testing.T) {
+	program := parse(t, "for (x in [1]) { let y = x; } let f = fn(xs) { for (x in xs) { x } };")
+	if errs := New().Resolve(program); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	if program.NumSlots != 3 {
+		t.Errorf("expected program to need 3 slots, got %d", program.NumSlots)
+	}
+
+	f := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if f.NumSlots != 2 {
+		t.Errorf("expected f to need 2 slots, got %d", f.NumSlots)
+	}
+}
+
+func TestAssignmentsDontBind(t *testing.T) {
+	program := parse(t, "let x = 1; let f = fn() { x = x + 1; let y = 0; y += x };")
+	if errs := New().Resolve(program); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	if program.NumSlots != 2 {
+		t.Errorf("expected program to need 2 slots, got %d", program.NumSlots)
+	}
+
+	f := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if f.NumSlots != 1 {
+		t.Errorf("expected f to need 1 slot, got %d", f.NumSlots)
+	}
+
+	assign := f.Body.Statements[0].(*ast.ExpressionStatement).Value.(*ast.AssignExpression)
+	if b := assign.Target.(*ast.Identifier).Binding; b.Depth != 1 || b.Slot != 0 {
+		t.Errorf("expected x to be bound to depth 1 slot 0, got %+v", b)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	program := parse(t, "let f = fn(decimal) { decimal(rational, 2) };")
+	if errs := New().Resolve(program); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	f := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	call := f.Body.Statements[0].(*ast.ExpressionStatement).Value.(*ast.CallExpression)
+
+	// A parameter hides the builtin with the same name.
+	if b := call.Function.(*ast.Identifier).Binding; b.Builtin || b.Slot != 0 {
+		t.Errorf("expected decimal to be bound to the parameter, got %+v", b)
+	}
+	if b := call.Arguments[0].(*ast.Identifier).Binding; !b.Builtin || !b.Resolved {
+		t.Errorf("expected rational to be bound to a builtin, got %+v", b)
+	}
+}
+
+func TestImports(t *testing.T) {
+	program := parse(t, `let f = fn() { money.round }; import "money.monkey" as money; money.total.x`)
+	if errs := New().Resolve(program); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	name := program.Statements[1].(*ast.ImportStatement).Name
+	if b := name.Binding; !b.Resolved || b.Slot != 1 {
+		t.Errorf("expected money to be bound to slot 1, got %+v", b)
+	}
+
+	// Only the module is bound; members are looked up in it at runtime.
+	member := program.Statements[2].(*ast.ExpressionStatement).Value.(*ast.MemberExpression)
+	if member.Member.Binding.Resolved {
+		t.Errorf("expected member x not to be resolved")
+	}
+	if b := member.Left.(*ast.MemberExpression).Left.(*ast.Identifier).Binding; b.Slot != 1 {
+		t.Errorf("expected money to be bound to slot 1, got %+v", b)
+	}
+
+	errs := New().Resolve(parse(t, `money.round; import "money.monkey" as money;`))
+	if len(errs) != 1 || errs[0].Message != "identifier used before definition: money" {
+		t.Errorf("expected money to be used before definition, got %v", errs)
+	}
+}
+
+func TestGlobalsPersist(t *testing.T) {
+	r := New()
+
+	first := parse(t, "let x = 1; let y = 2;")
+	if errs := r.Resolve(first); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	second := parse(t, "let z = y; x")
+	if errs := r.Resolve(second); len(errs) > 0 {
+		t.Fatalf("resolver errors: %v", errs)
+	}
+
+	if second.NumSlots != 3 {
+		t.Errorf("expected 3 global slots, got %d", second.NumSlots)
+	}
+
+	x := second.Statements[1].(*ast.ExpressionStatement).Value.(*ast.Identifier)
+	if x.Binding.Slot != 0 {
+		t.Errorf("expected x in slot 0, got %d", x.Binding.Slot)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
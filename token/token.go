@@ -10,11 +10,14 @@ type TokenType string
 
 const NO_FILEPATH = "<input>"
 
+// STDIN_FILEPATH is the path of a program that was read from standard input.
+const STDIN_FILEPATH = "<stdin>"
+
 // A location in a Monkey program text.
 type Location struct {
-	Path  string // Full path to filename of program.
-	LineN uint   // 1-indexed line number
-	CharN uint   // 1-indexed character number in line
+	Path  string `json:"path"` // Full path to filename of program.
+	LineN uint   `json:"line"` // 1-indexed line number
+	CharN uint   `json:"char"` // 1-indexed character number in line
 }
 
 // Increment the line number this location is tracking.
@@ -30,9 +33,9 @@ func (l *Location) NextChar() {
 
 // A Monkey-language token.
 type Token struct {
-	Type     TokenType
-	Literal  string
-	Location Location
+	Type     TokenType `json:"type"`
+	Literal  string    `json:"literal"`
+	Location Location  `json:"location"`
 }
 
 const (
@@ -41,6 +44,8 @@ const (
 
 	IDENTIFIER TokenType = "IDENTIFIER"
 	INT        TokenType = "INT"
+	DECIMAL    TokenType = "DECIMAL"
+	STRING     TokenType = "STRING"
 
 	ASSIGN   TokenType = "="
 	EQ       TokenType = "=="
@@ -49,35 +54,74 @@ const (
 	MINUS    TokenType = "-"
 	ASTERISK TokenType = "*"
 	BANG     TokenType = "!"
+	PERCENT  TokenType = "%"
+	POWER    TokenType = "**"
+	AND      TokenType = "&&"
+	OR       TokenType = "||"
+
+	AMPERSAND TokenType = "&"
+	PIPE      TokenType = "|"
+	CARET     TokenType = "^"
+	TILDE     TokenType = "~"
+	LSHIFT    TokenType = "<<"
+	RSHIFT    TokenType = ">>"
+
+	PLUS_ASSIGN     TokenType = "+="
+	MINUS_ASSIGN    TokenType = "-="
+	ASTERISK_ASSIGN TokenType = "*="
+	RSLASH_ASSIGN   TokenType = "/="
 
 	COMMA     TokenType = ","
 	SEMICOLON TokenType = ";"
-
-	LPAREN TokenType = "("
-	RPAREN TokenType = ")"
-	LBRACE TokenType = "{"
-	RBRACE TokenType = "}"
-	LANGLE TokenType = "<"
-	RANGLE TokenType = ">"
-	RSLASH TokenType = "/"
+	COLON     TokenType = ":"
+	DOT       TokenType = "."
+	ARROW     TokenType = "->"
+
+	LPAREN    TokenType = "("
+	RPAREN    TokenType = ")"
+	LBRACE    TokenType = "{"
+	RBRACE    TokenType = "}"
+	LBRACKET  TokenType = "["
+	RBRACKET  TokenType = "]"
+	LANGLE    TokenType = "<"
+	RANGLE    TokenType = ">"
+	LANGLE_EQ TokenType = "<="
+	RANGLE_EQ TokenType = ">="
+	RSLASH    TokenType = "/"
 
 	FUNCTION TokenType = "FUNCTION"
+	MACRO    TokenType = "MACRO"
 	LET      TokenType = "LET"
 	IF       TokenType = "IF"
 	ELSE     TokenType = "ELSE"
 	RETURN   TokenType = "RETURN"
 	TRUE     TokenType = "TRUE"
 	FALSE    TokenType = "FALSE"
+	WHILE    TokenType = "WHILE"
+	FOR      TokenType = "FOR"
+	IN       TokenType = "IN"
+	BREAK    TokenType = "BREAK"
+	CONTINUE TokenType = "CONTINUE"
+	IMPORT   TokenType = "IMPORT"
+	AS       TokenType = "AS"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"true":   TRUE,
-	"false":  FALSE,
+	"fn":       FUNCTION,
+	"macro":    MACRO,
+	"let":      LET,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"true":     TRUE,
+	"false":    FALSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"import":   IMPORT,
+	"as":       AS,
 }
 
 // One char literals are detected at the read head, so location is not modified
@@ -97,12 +141,10 @@ func NewTwoCharToken(tokenType TokenType, literal string, location Location) Tok
 
 // Given a token type, a literal, and a location from the lexer, this will
 // return a Token composed of those bits. This function expects a location that
-// has CharN pointing to the whitespace at the _end_ of the multichar literal;
-// it will adjust the location to point to its start.
+// points to the first char of the multichar literal; the lexer has to save it
+// before scanning, since the literal may end at a newline.
 func NewMultiCharToken(tokenType TokenType, literal string, location Location) Token {
-	tok := Token{Type: tokenType, Literal: literal, Location: location}
-	tok.Location.CharN -= uint(len(tok.Literal))
-	return tok
+	return Token{Type: tokenType, Literal: literal, Location: location}
 }
 
 // Given a literal, checks if it is a keyword. Otherwise, it is an identifier.
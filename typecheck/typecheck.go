@@ -0,0 +1,428 @@
+// Package typecheck finds type errors in Monkey programs before they run.
+//
+// Type annotations are optional. Annotated names and the expressions built from
+// literals have static types, and the checker infers the types of expressions
+// from them locally; everything else is treated as dynamically typed, with the
+// type Any, and is left for the evaluator to check at runtime.
+package typecheck
+
+import (
+	"fmt"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/ops"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// TypeError is emitted by the checker when an expression's type doesn't fit
+// where it's used. Message should be legible by the program author.
+type TypeError struct {
+	Message  string
+	Location token.Location
+}
+
+// String() should be legible by the program author.
+func (te *TypeError) String() string {
+	msg := "%s (at line %d, col %d)"
+	return fmt.Sprintf(msg, te.Message, te.Location.LineN, te.Location.CharN)
+}
+
+// Check returns the type errors in program.
+func Check(program *ast.Program) []TypeError {
+	c := &checker{errors: []TypeError{}, types: map[ast.TypeExpression]Type{}, assigned: assignedNames(program)}
+	c.scope = newScope(nil)
+	c.declare(program, nil)
+	c.statements(program.Statements)
+	return c.errors
+}
+
+// binding is the type of a name bound in a scope. A name that is bound more
+// than once in the same scope can hold values of different types, so its type
+// is Any.
+type binding struct {
+	typ   Type
+	count int
+}
+
+// scope is the set of names bound in one function, or at the top level.
+// Blocks share the scope of the function they're in.
+type scope struct {
+	outer *scope
+	names map[string]*binding
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, names: map[string]*binding{}}
+}
+
+func (s *scope) bind(name string) *binding {
+	b, ok := s.names[name]
+	if !ok {
+		b = &binding{typ: Any}
+		s.names[name] = b
+	}
+	b.count++
+	return b
+}
+
+func (s *scope) lookup(name string) Type {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			return b.typ
+		}
+	}
+	return Any
+}
+
+type checker struct {
+	scope   *scope
+	returns Type // Return type of the function being checked; nil at the top level.
+	errors  []TypeError
+
+	types    map[ast.TypeExpression]Type // Annotations that have been resolved.
+	assigned map[string]bool             // Names that are assigned to anywhere in the program.
+}
+
+// assignedNames returns the names that are the target of an assignment
+// anywhere in program. Unannotated names among them can hold values of any
+// type, whatever they're bound to.
+func assignedNames(program *ast.Program) map[string]bool {
+	names := map[string]bool{}
+	ast.Walk(program, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignExpression); ok {
+			if ident, ok := assign.Target.(*ast.Identifier); ok {
+				names[ident.Value] = true
+			}
+		}
+		return true
+	}, nil)
+	return names
+}
+
+func (c *checker) errorf(loc token.Location, format string, a ...interface{}) {
+	c.errors = append(c.errors, TypeError{Message: fmt.Sprintf(format, a...), Location: loc})
+}
+
+// declare binds params and every name bound by a let in body in the current
+// scope. Names that are only bound once get their type up front when it is
+// known without checking anything, so that functions can call ones that are
+// bound after them. Unannotated names that are assigned to are left as Any.
+func (c *checker) declare(body ast.Node, params []*ast.Identifier) {
+	known := map[string]Type{}
+
+	for _, param := range params {
+		c.scope.bind(param.Value)
+		if param.Type != nil || !c.assigned[param.Value] {
+			known[param.Value] = c.annotation(param.Type)
+		}
+	}
+
+	ast.Walk(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			c.scope.bind(n.Name.Value)
+			if n.Name.Type != nil {
+				known[n.Name.Value] = c.annotation(n.Name.Type)
+			} else if fn, ok := n.Value.(*ast.FunctionLiteral); ok && !c.assigned[n.Name.Value] {
+				known[n.Name.Value] = c.signature(fn)
+			}
+		case *ast.ImportStatement:
+			c.scope.bind(n.Name.Value)
+		case *ast.ForStatement:
+			c.scope.bind(n.Variable.Value)
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		}
+		return true
+	}, nil)
+
+	for name, typ := range known {
+		if b := c.scope.names[name]; b.count == 1 {
+			b.typ = typ
+		}
+	}
+}
+
+// statements checks stmts, and returns the type of the value they evaluate to.
+func (c *checker) statements(stmts []ast.Statement) Type {
+	var typ Type = Any
+	for _, s := range stmts {
+		typ = c.check(s)
+	}
+	return typ
+}
+
+// check checks node and returns its type. Statements other than expression
+// statements have the type Any.
+func (c *checker) check(node ast.Node) Type {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return c.check(node.Value)
+	case *ast.BlockStatement:
+		return c.statements(node.Statements)
+	case *ast.LetStatement:
+		c.checkLet(node)
+	case *ast.WhileStatement:
+		c.check(node.Condition)
+		c.check(node.Body)
+	case *ast.ForStatement:
+		c.check(node.Iterable)
+		c.check(node.Body)
+	case *ast.ReturnStatement:
+		typ := c.check(node.Value)
+		if c.returns != nil && !Consistent(typ, c.returns) {
+			c.errorf(node.Value.Token().Location, "cannot return %s from function returning %s", typ, c.returns)
+		}
+	case *ast.Identifier:
+		return c.scope.lookup(node.Value)
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.DecimalLiteral:
+		return Decimal
+	case *ast.StringLiteral:
+		return Str
+	case *ast.BooleanLiteral:
+		return Bool
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			c.check(el)
+		}
+	case *ast.HashLiteral:
+		for i, key := range node.Keys {
+			c.check(key)
+			c.check(node.Values[i])
+		}
+	case *ast.IndexExpression:
+		c.check(node.Left)
+		c.check(node.Index)
+	case *ast.MemberExpression:
+		c.check(node.Left)
+	case *ast.AssignExpression:
+		return c.checkAssign(node)
+	case *ast.PrefixExpression:
+		return c.checkPrefix(node)
+	case *ast.InfixExpression:
+		return c.checkInfix(node)
+	case *ast.IfExpression:
+		c.check(node.Condition)
+		consequence := c.check(node.Consequence)
+		if node.Alternative == nil {
+			return Any
+		}
+		if alternative := c.check(node.Alternative); alternative != consequence {
+			return Any
+		}
+		return consequence
+	case *ast.FunctionLiteral:
+		return c.checkFunction(node)
+	case *ast.CallExpression:
+		return c.checkCall(node)
+	}
+	return Any
+}
+
+func (c *checker) checkLet(node *ast.LetStatement) {
+	typ := c.check(node.Value)
+
+	if node.Name.Type != nil {
+		declared := c.annotation(node.Name.Type)
+		if !Consistent(typ, declared) {
+			c.errorf(node.Value.Token().Location, "cannot assign %s to %s of type %s", typ, node.Name.Value, declared)
+		}
+		return
+	}
+
+	if b := c.scope.names[node.Name.Value]; b != nil && b.count == 1 && !c.assigned[node.Name.Value] {
+		b.typ = typ
+	}
+}
+
+func (c *checker) checkPrefix(node *ast.PrefixExpression) Type {
+	rhs := c.check(node.RHS)
+
+	switch node.OperatorToken.Type {
+	case token.BANG:
+		return Bool
+	case token.MINUS, token.TILDE:
+		if rhs == Any || rhs == Int || rhs == Decimal && node.OperatorToken.Type == token.MINUS {
+			return rhs
+		}
+		c.errorf(node.OperatorToken.Location, "unknown operator: %s%s", node.Operator, rhs)
+	}
+	return Any
+}
+
+func (c *checker) checkAssign(node *ast.AssignExpression) Type {
+	// The target of a plain assignment isn't read, so it's only checked if
+	// it's an index expression.
+	var target Type = Any
+	if ident, ok := node.Target.(*ast.Identifier); ok {
+		target = c.scope.lookup(ident.Value)
+	} else {
+		c.check(node.Target)
+	}
+
+	typ := c.check(node.Value)
+	if op, ok := ops.Compound[node.OperatorToken.Type]; ok {
+		typ = c.infix(op, target, typ, node.OperatorToken.Location)
+	}
+
+	if ident, ok := node.Target.(*ast.Identifier); ok && !Consistent(typ, target) {
+		c.errorf(node.Value.Token().Location, "cannot assign %s to %s of type %s", typ, ident.Value, target)
+	}
+	return typ
+}
+
+func (c *checker) checkInfix(node *ast.InfixExpression) Type {
+	lhs := c.check(node.LHS)
+	rhs := c.check(node.RHS)
+	return c.infix(node.OperatorToken.Type, lhs, rhs, node.OperatorToken.Location)
+}
+
+// infix returns the type of applying op to lhs and rhs, following the rules of
+// ops.Infix. Errors are reported at loc.
+func (c *checker) infix(op token.TokenType, lhs, rhs Type, loc token.Location) Type {
+	// && and || only test the truthiness of their operands, so any types do.
+	if op == token.AND || op == token.OR {
+		return Bool
+	}
+
+	comparison := op == token.EQ || op == token.NEQ || op == token.LANGLE || op == token.RANGLE ||
+		op == token.LANGLE_EQ || op == token.RANGLE_EQ
+
+	switch {
+	case lhs == Any || rhs == Any:
+		if comparison {
+			return Bool
+		}
+		return Any
+	case lhs == Int && rhs == Int:
+		if comparison {
+			return Bool
+		}
+		return Int
+	case lhs == Str && rhs == Str:
+		if comparison {
+			return Bool
+		}
+		if op == token.PLUS {
+			return Str
+		}
+		c.errorf(loc, "unknown operator: %s %s %s", lhs, op, rhs)
+		return Any
+	case isNumeric(lhs) && isNumeric(rhs):
+		// Integers and decimals mix, and give decimals.
+		switch op {
+		case token.PLUS, token.MINUS, token.ASTERISK, token.RSLASH, token.PERCENT:
+			return Decimal
+		case token.POWER:
+			if rhs == Int {
+				return Decimal
+			}
+		default:
+			if comparison {
+				return Bool
+			}
+		}
+		c.errorf(loc, "unknown operator: %s %s %s", lhs, op, rhs)
+		return Any
+	case op == token.EQ || op == token.NEQ:
+		return Bool
+	case !Consistent(lhs, rhs):
+		c.errorf(loc, "type mismatch: %s %s %s", lhs, op, rhs)
+	default:
+		c.errorf(loc, "unknown operator: %s %s %s", lhs, op, rhs)
+	}
+	return Any
+}
+
+func isNumeric(typ Type) bool {
+	return typ == Int || typ == Decimal
+}
+
+func (c *checker) checkFunction(fn *ast.FunctionLiteral) Type {
+	sig := c.signature(fn)
+
+	outerScope, outerReturns := c.scope, c.returns
+	c.scope, c.returns = newScope(c.scope), sig.Return
+	defer func() { c.scope, c.returns = outerScope, outerReturns }()
+
+	c.declare(fn.Body, fn.Parameters)
+	typ := c.statements(fn.Body.Statements)
+
+	// The value of the body's final expression is returned too.
+	if n := len(fn.Body.Statements); n > 0 {
+		if es, ok := fn.Body.Statements[n-1].(*ast.ExpressionStatement); ok && !Consistent(typ, sig.Return) {
+			c.errorf(es.Value.Token().Location, "cannot return %s from function returning %s", typ, sig.Return)
+		}
+	}
+
+	return sig
+}
+
+func (c *checker) checkCall(node *ast.CallExpression) Type {
+	callee := c.check(node.Function)
+
+	args := []Type{}
+	for _, arg := range node.Arguments {
+		args = append(args, c.check(arg))
+	}
+
+	switch fn := callee.(type) {
+	case *Func:
+		if want, got := len(fn.Params), len(args); want != got {
+			c.errorf(node.LPToken.Location, "wrong number of arguments: want=%d, got=%d", want, got)
+			return fn.Return
+		}
+		for i, arg := range args {
+			if !Consistent(arg, fn.Params[i]) {
+				c.errorf(node.Arguments[i].Token().Location, "cannot use %s as %s in argument %d", arg, fn.Params[i], i+1)
+			}
+		}
+		return fn.Return
+	case Basic:
+		if fn != Any {
+			c.errorf(node.LPToken.Location, "not a function: %s", fn)
+		}
+	}
+	return Any
+}
+
+// signature returns the type of fn, as given by its annotations.
+func (c *checker) signature(fn *ast.FunctionLiteral) *Func {
+	sig := &Func{Params: []Type{}, Return: c.annotation(fn.ReturnType)}
+	for _, param := range fn.Parameters {
+		sig.Params = append(sig.Params, c.annotation(param.Type))
+	}
+	return sig
+}
+
+// annotation returns the type that te names, or Any if te is nil. Each
+// annotation's errors are only reported the first time it is resolved.
+func (c *checker) annotation(te ast.TypeExpression) Type {
+	if te == nil {
+		return Any
+	}
+	if typ, ok := c.types[te]; ok {
+		return typ
+	}
+
+	var typ Type = Any
+	switch te := te.(type) {
+	case *ast.NamedType:
+		if basic, ok := basics[te.Name]; ok {
+			typ = basic
+		} else {
+			c.errorf(te.NameToken.Location, "unknown type: %s", te.Name)
+		}
+	case *ast.FunctionType:
+		fn := &Func{Params: []Type{}, Return: c.annotation(te.Return)}
+		for _, param := range te.Parameters {
+			fn.Params = append(fn.Params, c.annotation(param))
+		}
+		typ = fn
+	}
+
+	c.types[te] = typ
+	return typ
+}
@@ -0,0 +1,135 @@
+package typecheck
+
+import (
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/ast"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/parser"
+)
+
+func TestWellTyped(t *testing.T) {
+	inputs := []string{
+		"1 + 2 * 3",
+		"let x: int = 5; x * 2",
+		"let b: bool = !5; b == true",
+		"let f = fn(a: int, b: int) -> int { a + b }; f(1, 2) * 3",
+		"let f = fn(a, b) { a + b }; f(true, 1)",
+		"let f = fn(a: int) -> int { if (a > 0) { return a; } 0 }; f(1)",
+		"let g = fn(h: fn(int) -> int) -> int { h(1) }; g(fn(x) { x })",
+		"let isEven = fn(n: int) -> bool { if (n == 0) { true } else { isOdd(n - 1) } };" +
+			"let isOdd = fn(n: int) -> bool { if (n == 0) { false } else { isEven(n - 1) } };" +
+			"isEven(4)",
+		"let x = 1; let x = true; x + 1",
+		"let a: any = true; a + 1",
+		"1 == true",
+		"fn(x: int) { let y = x; y + 1 }",
+		"let x = 1; x = true; !x",
+		"let n: int = 0; n += 2; n * 3",
+		"let f = fn() { 1 }; f = 2; f + 1",
+		"let h = {1: true}; h[1] = 5; h[1] + 1",
+		"let b: bool = 1 && true; let c: bool = 2 <= 3 || b; 7 % 2 ** 3",
+		"let price: decimal = 12.50d * 3 - 1; let cheap: bool = price < 40; -price / 2 ** 2",
+		"let total: decimal = 0d; total += rational(1, 3); total",
+		`let name: str = "monkey"; let greeting: str = "hi, " + name; let first: bool = name < greeting; !name`,
+	}
+
+	for i, input := range inputs {
+		if errs := Check(parse(t, input)); len(errs) > 0 {
+			t.Errorf("[%d] %q: expected no errors, got %v", i, input, errs)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"true + 1", "type mismatch: bool + int", 1, 6},
+		{"true + false", "unknown operator: bool + bool", 1, 6},
+		{"-true", "unknown operator: -bool", 1, 1},
+		{"let x: int = true;", "cannot assign bool to x of type int", 1, 14},
+		{"let x = 5;\nx + true", "type mismatch: int + bool", 2, 3},
+		{"let f = fn(a: int) { a }; f(true)", "cannot use bool as int in argument 1", 1, 29},
+		{"let f = fn(a: int) { a }; f(1, 2)", "wrong number of arguments: want=1, got=2", 1, 28},
+		{"let f = fn() -> int { true };", "cannot return bool from function returning int", 1, 23},
+		{"let f = fn() -> int { return !1; };", "cannot return bool from function returning int", 1, 30},
+		{"let f = fn(a: int) -> bool { a > 0 }; f(1) + 1", "type mismatch: bool + int", 1, 44},
+		{"let x = 5; x(1)", "not a function: int", 1, 13},
+		{"let x: integer = 5;", "unknown type: integer", 1, 8},
+		{"let f: fn(int) -> int = fn(a: bool) -> int { 1 };", "cannot assign fn(bool) -> int to f of type fn(int) -> int", 1, 25},
+		{"let g = fn(h: fn(int) -> int) { h(1) }; g(fn(x: bool) { x })", "cannot use fn(bool) -> any as fn(int) -> int in argument 1", 1, 43},
+		{"let f = fn(a: int) -> int { a }; let g = fn() { f(true) };", "cannot use bool as int in argument 1", 1, 51},
+		{"let x: int = 1;\nx = true", "cannot assign bool to x of type int", 2, 5},
+		{"let b: bool = true;\nb += 1", "type mismatch: bool + int", 2, 3},
+		{"let x: int = 1; let f = fn() { x = false };", "cannot assign bool to x of type int", 1, 36},
+		{"let x: int = 1 >= 2;", "cannot assign bool to x of type int", 1, 16},
+		{"(1 || 2) % 2", "type mismatch: bool % int", 1, 10},
+		{"~true", "unknown operator: ~bool", 1, 1},
+		{"let m: int = 1 << 2 & 3 < 4;", "type mismatch: int & bool", 1, 21},
+		{"let n: int = 1 + 0.5d;", "cannot assign decimal to n of type int", 1, 16},
+		{"1.5d << 1", "unknown operator: decimal << int", 1, 6},
+		{"2 ** 0.5d", "unknown operator: int ** decimal", 1, 3},
+		{"~1.5d", "unknown operator: ~decimal", 1, 1},
+		{"1.5d + true", "type mismatch: decimal + bool", 1, 6},
+		{`let s: str = 1;`, "cannot assign int to s of type str", 1, 14},
+		{`"a" + 1`, "type mismatch: str + int", 1, 5},
+		{`"a" * "b"`, "unknown operator: str * str", 1, 5},
+		{`-"a"`, "unknown operator: -str", 1, 1},
+	}
+
+	for i, tt := range tests {
+		errs := Check(parse(t, tt.input))
+
+		if len(errs) != 1 {
+			t.Errorf("[%d] %q: expected 1 error, got %v", i, tt.input, errs)
+			continue
+		}
+
+		if errs[0].Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, errs[0].Message)
+		}
+
+		if loc := errs[0].Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestConsistent(t *testing.T) {
+	intToInt := &Func{Params: []Type{Int}, Return: Int}
+	anyToAny := &Func{Params: []Type{Any}, Return: Any}
+	boolToInt := &Func{Params: []Type{Bool}, Return: Int}
+
+	tests := []struct {
+		a, b     Type
+		expected bool
+	}{
+		{Int, Int, true},
+		{Int, Bool, false},
+		{Any, Bool, true},
+		{Str, Any, true},
+		{intToInt, anyToAny, true},
+		{intToInt, boolToInt, false},
+		{intToInt, Int, false},
+		{intToInt, &Func{Params: []Type{}, Return: Int}, false},
+	}
+
+	for i, tt := range tests {
+		if act := Consistent(tt.a, tt.b); act != tt.expected {
+			t.Errorf("[%d] Consistent(%s, %s): expected %t, got %t", i, tt.a, tt.b, tt.expected, act)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
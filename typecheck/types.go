@@ -0,0 +1,86 @@
+package typecheck
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Type is the static type of a Monkey expression.
+type Type interface {
+	String() string
+}
+
+// Basic is a type that is referred to by name.
+type Basic string
+
+const (
+	// Any is the type of everything the checker can't or won't figure out,
+	// like unannotated parameters. It is consistent with every other type.
+	Any     Basic = "any"
+	Int     Basic = "int"
+	Bool    Basic = "bool"
+	Str     Basic = "str"
+	Decimal Basic = "decimal"
+)
+
+// basics are the types that can be named in annotations.
+var basics = map[string]Basic{
+	"any":     Any,
+	"int":     Int,
+	"bool":    Bool,
+	"str":     Str,
+	"decimal": Decimal,
+}
+
+func (b Basic) String() string {
+	return string(b)
+}
+
+// Func is the type of a function.
+type Func struct {
+	Params []Type
+	Return Type
+}
+
+func (f *Func) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Params {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") -> ")
+	out.WriteString(f.Return.String())
+
+	return out.String()
+}
+
+// Consistent reports whether a value of type a can be used where b is
+// expected. Any is consistent with every type, in both directions; otherwise
+// the types must match, with Any allowed in place of any of their parts.
+func Consistent(a, b Type) bool {
+	if a == Any || b == Any {
+		return true
+	}
+
+	switch a := a.(type) {
+	case Basic:
+		return a == b
+	case *Func:
+		bf, ok := b.(*Func)
+		if !ok || len(a.Params) != len(bf.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !Consistent(a.Params[i], bf.Params[i]) {
+				return false
+			}
+		}
+		return Consistent(a.Return, bf.Return)
+	}
+
+	return false
+}
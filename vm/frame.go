@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/object"
+)
+
+// Frame is the activation record of one call to a closure.
+type Frame struct {
+	cl          *object.Closure
+	ip          int // Offset of the instruction being executed.
+	basePointer int // Stack pointer before the call; locals start here.
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
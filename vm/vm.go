@@ -0,0 +1,611 @@
+// Package vm executes bytecode produced by the compiler on a stack machine.
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/MichaelDiBernardo/monkey/builtins"
+	"github.com/MichaelDiBernardo/monkey/code"
+	"github.com/MichaelDiBernardo/monkey/compiler"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/ops"
+	"github.com/MichaelDiBernardo/monkey/token"
+)
+
+// The stack and the frames start small and grow as they're needed, up to
+// StackSize values and MaxFrames calls deep. The limits are only there so that
+// runaway recursion is reported as a stack overflow before it takes all of
+// memory.
+const StackSize = 1 << 22
+const GlobalsSize = 65536
+const MaxFrames = 1 << 20
+
+const initialStackSize = 2048
+
+// operators maps the instructions that apply an operator back to the operator,
+// so that their semantics can be shared with the evaluator. It's indexed by
+// opcode rather than a map, since it's looked up for every operator run.
+var operators = [...]token.TokenType{
+	code.OpAdd:          token.PLUS,
+	code.OpSub:          token.MINUS,
+	code.OpMul:          token.ASTERISK,
+	code.OpDiv:          token.RSLASH,
+	code.OpEqual:        token.EQ,
+	code.OpNotEqual:     token.NEQ,
+	code.OpGreaterThan:  token.RANGLE,
+	code.OpLessThan:     token.LANGLE,
+	code.OpMod:          token.PERCENT,
+	code.OpPow:          token.POWER,
+	code.OpGreaterEqual: token.RANGLE_EQ,
+	code.OpLessEqual:    token.LANGLE_EQ,
+	code.OpBitAnd:       token.AMPERSAND,
+	code.OpBitOr:        token.PIPE,
+	code.OpBitXor:       token.CARET,
+	code.OpShiftLeft:    token.LSHIFT,
+	code.OpShiftRight:   token.RSHIFT,
+	code.OpMinus:        token.MINUS,
+	code.OpBang:         token.BANG,
+	code.OpBitNot:       token.TILDE,
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	names       []string                  // Member names, by index.
+	modules     map[string]*object.Module // Modules that have been run, by path.
+
+	stack []object.Object
+	sp    int // Always points to the next free slot; top of stack is stack[sp-1].
+
+	frames      []*Frame
+	framesIndex int
+
+	// Arithmetic holds the settings that arithmetic runs with. It can be set
+	// before the program is run.
+	Arithmetic object.Arithmetic
+
+	// Permissions holds what builtins may do. It can be set before the
+	// program is run, and allows nothing otherwise.
+	Permissions object.Permissions
+
+	// Args holds the arguments the program was run with, which it refers to
+	// as args. It can be set before the program is run.
+	Args *object.Array
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	frames := []*Frame{NewFrame(mainClosure, 0)}
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, len(bytecode.GlobalNames)),
+		globalNames: bytecode.GlobalNames,
+		names:       bytecode.Names,
+		modules:     map[string]*object.Module{},
+		stack:       make([]object.Object, initialStackSize),
+		sp:          0,
+		frames:      frames,
+		framesIndex: 1,
+		Arithmetic:  object.DefaultArithmetic,
+	}
+}
+
+// LastPoppedStackElem returns the value of the last expression statement that
+// was run.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
+	return vm.stack[vm.sp]
+}
+
+// Run executes the program. Runtime errors are returned as *object.Error.
+func (vm *VM) Run() error {
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip := vm.currentFrame().ip
+		ins := vm.currentFrame().Instructions()
+		op := code.Opcode(ins[ip])
+
+		var err error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpTrue:
+			err = vm.push(object.TRUE_OBJ)
+
+		case code.OpFalse:
+			err = vm.push(object.FALSE_OBJ)
+
+		case code.OpNull:
+			err = vm.push(object.NULL_OBJ)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpMod, code.OpPow, code.OpEqual, code.OpNotEqual,
+			code.OpGreaterThan, code.OpLessThan, code.OpGreaterEqual, code.OpLessEqual,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+			rhs := vm.pop()
+			lhs := vm.pop()
+			result, ok := integerInfix(op, lhs, rhs)
+			if !ok {
+				result, err = ops.Infix(operators[op], lhs, rhs, vm.Arithmetic)
+			}
+			if err == nil {
+				err = vm.push(result)
+			}
+
+		case code.OpMinus, code.OpBang, code.OpBitNot:
+			rhs := vm.pop()
+			var result object.Object
+			if result, err = ops.Prefix(operators[op], rhs, vm.Arithmetic); err == nil {
+				err = vm.push(result)
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if condition := vm.pop(); !ops.IsTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+			err = vm.push(&object.Array{Elements: elements})
+
+		case code.OpIter:
+			var elements []object.Object
+			if elements, err = ops.Elements(vm.pop()); err == nil {
+				err = vm.push(&object.Iterator{Elements: elements})
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			// The iterator is left on the stack for the next iteration.
+			it, ok := vm.stack[vm.sp-1].(*object.Iterator)
+			if !ok {
+				err = fmt.Errorf("not an iterator: %s", vm.stack[vm.sp-1].Type())
+			} else if it.Next < len(it.Elements) {
+				err = vm.push(it.Elements[it.Next])
+				it.Next++
+			} else {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var hash *object.Hash
+			if hash, err = buildHash(vm.stack[vm.sp-numElements : vm.sp]); err == nil {
+				vm.sp = vm.sp - numElements
+				err = vm.push(hash)
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			container := vm.pop()
+			var result object.Object
+			if result, err = ops.Index(container, index); err == nil {
+				err = vm.push(result)
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			container := vm.pop()
+			if err = ops.SetIndex(container, index, value); err == nil {
+				err = vm.push(value)
+			}
+
+		case code.OpDup2:
+			if err = vm.push(vm.stack[vm.sp-2]); err == nil {
+				err = vm.push(vm.stack[vm.sp-2])
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if int(globalIndex) >= len(vm.globals) {
+				// Bytecode read from a file may use slots that it
+				// doesn't name.
+				globals := make([]object.Object, GlobalsSize)
+				copy(globals, vm.globals)
+				vm.globals = globals
+			}
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			if int(globalIndex) >= len(vm.globals) || vm.globals[globalIndex] == nil {
+				err = fmt.Errorf("identifier used before definition: %s", slotName(vm.globalNames, int(globalIndex)))
+			} else {
+				err = vm.push(vm.globals[globalIndex])
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			if val := vm.stack[frame.basePointer+int(localIndex)]; val == nil {
+				err = fmt.Errorf("identifier used before definition: %s", slotName(frame.cl.Fn.LocalNames, int(localIndex)))
+			} else {
+				err = vm.push(val)
+			}
+
+		case code.OpCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+			vm.stack[slot] = &object.Cell{Name: slotName(frame.cl.Fn.LocalNames, int(localIndex)), Value: vm.stack[slot]}
+
+		case code.OpGetCell:
+			var cell *object.Cell
+			if cell, err = asCell(vm.pop()); err != nil {
+				break
+			}
+			if cell.Value == nil {
+				err = fmt.Errorf("identifier used before definition: %s", cell.Name)
+			} else {
+				err = vm.push(cell.Value)
+			}
+
+		case code.OpSetCell:
+			var cell *object.Cell
+			if cell, err = asCell(vm.pop()); err == nil {
+				cell.Value = vm.pop()
+			}
+
+		case code.OpGetFree:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+			if free := vm.currentFrame().cl.Free; freeIndex >= len(free) {
+				err = fmt.Errorf("unknown free variable %d", freeIndex)
+			} else {
+				err = vm.push(free[freeIndex])
+			}
+
+		case code.OpCurrentClosure:
+			err = vm.push(vm.currentFrame().cl)
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			if int(builtinIndex) >= len(builtins.Builtins) {
+				err = fmt.Errorf("unknown builtin %d", builtinIndex)
+			} else if b := builtins.Builtins[builtinIndex]; b != builtins.Args {
+				err = vm.push(b)
+			} else if vm.Args != nil {
+				err = vm.push(vm.Args)
+			} else {
+				err = vm.push(&object.Array{Elements: []object.Object{}})
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.importModule(int(constIndex))
+
+		case code.OpModule:
+			fn := vm.currentFrame().cl.Fn
+			mod := &object.Module{Path: fn.Module, Members: map[string]object.Object{}}
+			for i, name := range fn.Exports {
+				mod.Members[name] = vm.stack[vm.sp-len(fn.Exports)+i]
+			}
+			vm.modules[mod.Path] = mod
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(mod)
+
+		case code.OpMember:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			var member object.Object
+			if member, err = ops.Member(vm.pop(), slotName(vm.names, int(nameIndex))); err == nil {
+				err = vm.push(member)
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.callFunction(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// A return at the top level ends the program.
+			if vm.framesIndex == 1 {
+				vm.push(returnValue)
+				vm.pop()
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(returnValue)
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(object.NULL_OBJ)
+
+		default:
+			def, _ := code.Lookup(byte(op))
+			err = fmt.Errorf("unhandled opcode %v", def)
+		}
+
+		if err != nil {
+			return vm.newError(err)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) callFunction(numArgs int) error {
+	if builtin, ok := vm.stack[vm.sp-1-numArgs].(*object.Builtin); ok {
+		return vm.callBuiltin(builtin, numArgs)
+	}
+
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok {
+		return fmt.Errorf("not a function: %s", vm.stack[vm.sp-1-numArgs].Type())
+	}
+
+	if want := callee.Fn.NumParameters; numArgs != want {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", want, numArgs)
+	}
+
+	basePointer := vm.sp - numArgs
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	if err := vm.growStack(basePointer + callee.Fn.NumLocals); err != nil {
+		return err
+	}
+
+	vm.pushFrame(NewFrame(callee, basePointer))
+	vm.sp = basePointer + callee.Fn.NumLocals
+
+	// Clear out whatever the stack held before, so that reading a local
+	// before it is bound is caught.
+	for i := basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	return nil
+}
+
+// importModule pushes the module whose body is the constant at constIndex. The
+// body is only run the first time the module is imported; OpModule pushes the
+// module once it's done.
+func (vm *VM) importModule(constIndex int) error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok || fn.Module == "" {
+		return fmt.Errorf("not a module: %s", vm.constants[constIndex].Inspect())
+	}
+
+	if mod, ok := vm.modules[fn.Module]; ok {
+		return vm.push(mod)
+	}
+	if err := vm.push(&object.Closure{Fn: fn}); err != nil {
+		return err
+	}
+	return vm.callFunction(0)
+}
+
+// callBuiltin calls builtin with the numArgs arguments on top of the stack, and
+// replaces them and the builtin with its result.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	result, err := builtin.Fn(vm.Arithmetic, vm.Permissions, args...)
+	if err != nil {
+		return err
+	}
+
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(result)
+}
+
+// asCell returns obj, which OpGetCell or OpSetCell popped, as the cell it
+// should be. Only precompiled files that have been tampered with hold
+// anything else there.
+func asCell(obj object.Object) (*object.Cell, error) {
+	cell, ok := obj.(*object.Cell)
+	if !ok {
+		return nil, fmt.Errorf("not a cell: %s", obj.Type())
+	}
+	return cell, nil
+}
+
+// slotName returns the name bound to slot i, for error messages.
+func slotName(names []string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// buildHash makes a hash out of elements, which alternate between keys and
+// values.
+func buildHash(elements []object.Object) (*object.Hash, error) {
+	hash := object.NewHash()
+	for i := 0; i < len(elements); i += 2 {
+		key, err := ops.HashKey(elements[i])
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(key, elements[i+1])
+	}
+	return hash, nil
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %s", vm.constants[constIndex].Type())
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
+// newError turns err into a runtime error located at the instruction that is
+// currently being executed.
+func (vm *VM) newError(err error) *object.Error {
+	if rterr, ok := err.(*object.Error); ok {
+		return rterr
+	}
+
+	frame := vm.currentFrame()
+	exit, _ := err.(*object.Exit)
+	return &object.Error{Message: err.Error(), Location: frame.cl.Fn.Lines.Lookup(frame.ip), Exit: exit}
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp == len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// growStack makes room on the stack for size values, doubling it as many
+// times as it takes.
+func (vm *VM) growStack(size int) error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	newSize := len(vm.stack)
+	for newSize < size {
+		newSize *= 2
+	}
+	if newSize > StackSize {
+		newSize = StackSize
+	}
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
+}
+
+// integerInfix applies op to lhs and rhs without going through ops.Infix, for
+// the common case in loops of two Integers whose result fits in an int64. ok is
+// false for anything else, including overflow and division by zero, which
+// ops.Infix then deals with as it always does.
+func integerInfix(op code.Opcode, lhs, rhs object.Object) (result object.Object, ok bool) {
+	l, lok := lhs.(*object.Integer)
+	r, rok := rhs.(*object.Integer)
+	if !lok || !rok {
+		return nil, false
+	}
+
+	a, b := l.Value, r.Value
+	switch op {
+	case code.OpAdd:
+		if sum := a + b; (sum > a) == (b > 0) {
+			return &object.Integer{Value: sum}, true
+		}
+	case code.OpSub:
+		if diff := a - b; (diff < a) == (b > 0) {
+			return &object.Integer{Value: diff}, true
+		}
+	case code.OpMul:
+		if a >= math.MinInt32 && a <= math.MaxInt32 && b >= math.MinInt32 && b <= math.MaxInt32 {
+			return &object.Integer{Value: a * b}, true
+		}
+	case code.OpDiv:
+		if b != 0 && b != -1 {
+			return &object.Integer{Value: a / b}, true
+		}
+	case code.OpMod:
+		if b != 0 && b != -1 {
+			return &object.Integer{Value: a % b}, true
+		}
+	case code.OpEqual:
+		return object.NativeBoolToBooleanObject(a == b), true
+	case code.OpNotEqual:
+		return object.NativeBoolToBooleanObject(a != b), true
+	case code.OpGreaterThan:
+		return object.NativeBoolToBooleanObject(a > b), true
+	case code.OpLessThan:
+		return object.NativeBoolToBooleanObject(a < b), true
+	case code.OpGreaterEqual:
+		return object.NativeBoolToBooleanObject(a >= b), true
+	case code.OpLessEqual:
+		return object.NativeBoolToBooleanObject(a <= b), true
+	}
+	return nil, false
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/MichaelDiBernardo/monkey/compiler"
+	"github.com/MichaelDiBernardo/monkey/lexer"
+	"github.com/MichaelDiBernardo/monkey/object"
+	"github.com/MichaelDiBernardo/monkey/parser"
+)
+
+func TestRuntimeErrorLocations(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+		line    uint
+		char    uint
+	}{
+		{"5 + true", "type mismatch: INTEGER + BOOLEAN", 1, 3},
+		{"let x = 1;\n-true", "unknown operator: -BOOLEAN", 2, 1},
+		{"let f = fn(x) { x };\nf(1, 2)", "wrong number of arguments: want=1, got=2", 2, 2},
+		{"let f = fn(x) {\n  x > true\n};\nf(1)", "type mismatch: INTEGER > BOOLEAN", 2, 5},
+		{"for (x in\n  true) { x }", "cannot iterate over BOOLEAN", 2, 3},
+		{"let x = true;\nx += 1", "type mismatch: BOOLEAN + INTEGER", 2, 3},
+		{"let xs = [1];\nxs[1] = 2", "index out of range: 1", 2, 3},
+		{"let h = {[1]: 2}", "unusable as hash key: ARRAY", 1, 9},
+		{"let x = 1;\nx / (x - 1)", "division by zero", 2, 3},
+		{"let big = 9223372036854775807 + 1;\nbig %\n  0", "division by zero", 2, 5},
+		{"let s = \"a\";\nstrings.split(\n  s, 1)", "argument 2 to strings.split must be STRING, got INTEGER", 2, 14},
+	}
+
+	for i, tt := range tests {
+		err := run(t, tt.input).Run()
+
+		rterr, ok := err.(*object.Error)
+		if !ok {
+			t.Errorf("[%d] expected *object.Error, got %T (%v)", i, err, err)
+			continue
+		}
+
+		if rterr.Message != tt.message {
+			t.Errorf("[%d] expected message %q, got %q", i, tt.message, rterr.Message)
+		}
+
+		if loc := rterr.Location; loc.LineN != tt.line || loc.CharN != tt.char {
+			t.Errorf("[%d] expected error at line %d col %d, got line %d col %d", i, tt.line, tt.char, loc.LineN, loc.CharN)
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	err := run(t, "let f = fn(x) { f(x + 1) }; f(0)").Run()
+
+	rterr, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("expected *object.Error, got %T (%v)", err, err)
+	}
+	if rterr.Message != "stack overflow" {
+		t.Errorf("expected stack overflow, got %q", rterr.Message)
+	}
+}
+
+func run(t *testing.T, input string) *VM {
+	p := parser.New(lexer.NewFromString(input))
+	program := p.ParseProgram()
+	if p.HasErrors() {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return New(comp.Bytecode())
+}